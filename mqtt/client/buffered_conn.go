@@ -0,0 +1,33 @@
+package client
+
+import (
+	"bufio"
+	"net"
+)
+
+// bufferedConn is a connection which reads the data buffered
+// by the reader before reading the connection.
+type bufferedConn struct {
+	net.Conn
+	// r is the buffered reader of the connection.
+	r *bufio.Reader
+}
+
+// Read reads the data from the buffered reader.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// newBufferedConn returns the connection which reads the data
+// buffered by the reader. It returns the connection as it is
+// if the reader has no buffered data.
+func newBufferedConn(conn net.Conn, r *bufio.Reader) net.Conn {
+	if r.Buffered() == 0 {
+		return conn
+	}
+
+	return &bufferedConn{
+		Conn: conn,
+		r:    r,
+	}
+}
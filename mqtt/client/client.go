@@ -1,8 +1,11 @@
 package client
 
 import (
+	"context"
 	"errors"
-	"io"
+	"fmt"
+	"math/rand"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -19,21 +22,48 @@ const (
 
 // Error values
 var (
-	ErrAlreadyConnected = errors.New("the Client has already connected to the Server")
-	ErrNotYetConnected  = errors.New("the Client has not yet connected to the Server")
-	ErrCONNACKTimeout   = errors.New("the CONNACK Packet was not received within a reasonalbe amount of time")
-	ErrPINGRESPTimeout  = errors.New("the PINGRESP Packet was not received within a reasonalbe amount of time")
-	ErrPacketIDExhaused = errors.New("Packet Identifiers are exhausted")
-	ErrInvalidPINGRESP  = errors.New("invalid PINGRESP Packet")
-	ErrInvalidSUBACK    = errors.New("invalid SUBACK Packet")
+	ErrAlreadyConnected    = errors.New("the Client has already connected to the Server")
+	ErrNotYetConnected     = errors.New("the Client has not yet connected to the Server")
+	ErrCONNACKTimeout      = errors.New("the CONNACK Packet was not received within a reasonalbe amount of time")
+	ErrPINGRESPTimeout     = errors.New("the PINGRESP Packet was not received within a reasonalbe amount of time")
+	ErrPacketIDExhaused    = errors.New("Packet Identifiers are exhausted")
+	ErrInvalidCONNACK      = errors.New("invalid CONNACK Packet")
+	ErrInvalidPINGRESP     = errors.New("invalid PINGRESP Packet")
+	ErrInvalidSUBACK       = errors.New("invalid SUBACK Packet")
+	ErrReconnectFailed     = errors.New("the Client failed to reconnect to the Server within the maximum number of retries")
+	ErrDisconnected        = errors.New("the Network Connection was disconnected before the acknowledgment arrived")
+	ErrMaxInflightExceeded = errors.New("the number of the in-flight Packets has reached the maximum")
 )
 
+// Error values which represent the Connect Return codes
+// of the CONNACK Packet refusing the connection
+var (
+	ErrUnacceptableProtocolVersion = errors.New("the Server does not support the level of the MQTT protocol requested by the Client")
+	ErrIdentifierRejected          = errors.New("the Client Identifier is not allowed by the Server")
+	ErrServerUnavailable           = errors.New("the Network Connection has been made but the MQTT service is unavailable")
+	ErrBadUserNameOrPassword       = errors.New("the data in the User Name or Password is malformed")
+	ErrNotAuthorized               = errors.New("the Client is not authorized to connect")
+)
+
+// connRetErrs contains the pairs of the Connect Return code
+// and the error value which it represents.
+var connRetErrs = map[byte]error{
+	packet.ConnRetUnacceptableProtocolVersion: ErrUnacceptableProtocolVersion,
+	packet.ConnRetIdentifierRejected:          ErrIdentifierRejected,
+	packet.ConnRetServerUnavailable:           ErrServerUnavailable,
+	packet.ConnRetBadUserNameOrPassword:       ErrBadUserNameOrPassword,
+	packet.ConnRetNotAuthorized:               ErrNotAuthorized,
+}
+
 // Client represents a Client.
 type Client struct {
 	// muConn is the Mutex for the Network Connection.
 	muConn sync.RWMutex
 	// conn is the Network Connection.
 	conn *connection
+	// connectingc is not nil while the Client is connecting to
+	// the Server. It is closed when the connection attempt ends.
+	connectingc chan struct{}
 
 	// muSess is the Mutex for the Session.
 	muSess sync.RWMutex
@@ -44,51 +74,346 @@ type Client struct {
 	// which are launched by the New method.
 	wg sync.WaitGroup
 	// disconnc is the channel which handles the signal
-	// to disconnect the Network Connection.
-	disconnc chan struct{}
+	// to disconnect the Network Connection with its cause.
+	disconnc chan error
 	// disconnEndc is the channel which ends the goroutine
 	// which disconnects the Network Connection.
 	disconnEndc chan struct{}
 
 	// errorHandler is the error handler.
 	errorHandler ErrorHandler
+	// connectHandler is called when the Server accepts the connection.
+	connectHandler ConnectHandler
+	// connectionLostHandler is called when the Network
+	// Connection is lost.
+	connectionLostHandler ConnectionLostHandler
+	// disconnectHandler is called after the Disconnect method
+	// disconnects the Network Connection.
+	disconnectHandler DisconnectHandler
+
+	// connectOpts is the options which were used
+	// for the latest successful connection.
+	connectOpts *ConnectOptions
+	// lastAddress is the address of the Server of
+	// the latest successful connection.
+	lastAddress string
+	// reconnOpts is the options for the automatic reconnection.
+	reconnOpts *ReconnectOptions
+	// reconnecting is true while the Client is trying to
+	// reconnect to the Server automatically.
+	reconnecting bool
+	// reconnEndc is the channel which handles the signal
+	// to stop the automatic reconnection.
+	reconnEndc chan struct{}
+	// store is the Store of the in-flight Packets. It is nil
+	// if the in-flight Packets are kept only in the Session.
+	store Store
+
+	// maxInflight is the maximum number of the in-flight
+	// PUBLISH and PUBREL Packets.
+	maxInflight int
+	// muInflight is the Mutex for inflightc.
+	muInflight sync.Mutex
+	// inflightc is the channel which is closed when
+	// an in-flight Packet is acknowledged.
+	inflightc chan struct{}
+
+	// dispatcher dispatches the Application Messages
+	// to the message handlers.
+	dispatcher *dispatcher
+	// defaultMessageHandler is the message handler which handles
+	// the Application Messages matching no subscription.
+	defaultMessageHandler MessageFunc
+	// manualAck is true in the manual acknowledgment mode.
+	manualAck bool
+	// streamThreshold is the Remaining Length above which the
+	// Application Message is read as a stream.
+	streamThreshold int
+	// streamHandler handles the Application Messages
+	// which are read as a stream.
+	streamHandler MessageFunc
+	// maxIncomingPacketSize is the maximum length of
+	// the Packet received from the Server.
+	maxIncomingPacketSize int
+	// offlineQueue keeps the Application Messages which
+	// are published while the Client is disconnected.
+	offlineQueue *offlineQueue
+
+	// logger records the activity of the Client.
+	logger Logger
+	// logLevel is the minimum level of the log.
+	logLevel LogLevel
 }
 
-// Connect establishes a Network Connection to the Server and
-// sends a CONNECT Packet to the Server.
+// Connect establishes a Network Connection to the Server,
+// sends a CONNECT Packet to the Server and waits for receiving
+// the CONNACK Packet from the Server. It returns an error if
+// the Server refuses the connection or the CONNACK Packet does
+// not arrive within the CONNACKTimeout.
 func (cli *Client) Connect(opts *ConnectOptions) error {
-	// Lock for the connection.
-	cli.muConn.Lock()
+	return cli.connect(context.Background(), opts, nil)
+}
+
+// ConnectContext works like Connect but establishing the Network
+// Connection, the TLS handshake and waiting for the CONNACK Packet
+// are interrupted when the context is done. In that case, it returns
+// the context's error.
+func (cli *Client) ConnectContext(ctx context.Context, opts *ConnectOptions) error {
+	return cli.connect(ctx, opts, nil)
+}
+
+// connect establishes a Network Connection to the Server and
+// restores the subscriptions of the previous Network Connection
+// if it is not nil. The addresses of the options are tried in turn
+// until the connection succeeds.
+func (cli *Client) connect(ctx context.Context, opts *ConnectOptions, prev *connection) (err error) {
+	// Initialize the options.
+	if opts == nil {
+		opts = &ConnectOptions{}
+	}
+
+	// Address and Session Present of the accepted connection.
+	var address string
+	var sessionPresent bool
+
+	// Call the connect handler after releasing the locks
+	// so that it can use the Client.
+	defer func() {
+		if err != nil {
+			cli.logf(LogLevelWarn, "failed to connect: %v", err)
+			return
+		}
+
+		cli.logf(LogLevelInfo, "connected to %s (session present: %t)", address, sessionPresent)
+
+		// Send the Application Messages queued while disconnected.
+		if cli.offlineQueue != nil {
+			cli.offlineQueue.kick()
+		}
+
+		if cli.connectHandler != nil {
+			cli.connectHandler(sessionPresent)
+		}
+	}()
+
+	// Get the addresses in the order of the attempts.
+	addresses := cli.addresses(opts)
+
+	for i, a := range addresses {
+		var next bool
+
+		sessionPresent, next, err = cli.connectAddress(ctx, opts, a, prev)
+		if err == nil {
+			address = a
+			return nil
+		}
+
+		// End the attempts unless the next address can be tried.
+		if !next || i == len(addresses)-1 || ctx.Err() != nil {
+			break
+		}
+
+		cli.logf(LogLevelWarn, "failed to connect to %s: %v", a, err)
+	}
+
+	return err
+}
+
+// addresses returns the addresses of the options in the order of
+// the connection attempts. The address of the latest successful
+// connection comes first if the options contain it.
+func (cli *Client) addresses(opts *ConnectOptions) []string {
+	if len(opts.Addresses) == 0 {
+		return []string{opts.Address}
+	}
+
+	// Copy the addresses so as not to change the options.
+	addresses := make([]string, len(opts.Addresses))
+	copy(addresses, opts.Addresses)
+
+	if opts.RandomizeAddresses {
+		rand.Shuffle(len(addresses), func(i, j int) {
+			addresses[i], addresses[j] = addresses[j], addresses[i]
+		})
+	}
+
+	// Lock for reading.
+	cli.muConn.RLock()
 
 	// Unlock.
-	defer cli.muConn.Unlock()
+	defer cli.muConn.RUnlock()
+
+	// Start from the address of the latest successful connection.
+	for i, address := range addresses {
+		if address == cli.lastAddress {
+			return append(addresses[i:], addresses[:i]...)
+		}
+	}
+
+	return addresses
+}
+
+// connectAddress establishes a Network Connection to the Server of
+// the address and returns the Session Present of the CONNACK Packet.
+// It also returns true along with the error if the Client can move
+// to the next address, which is the case where it fails to connect,
+// the CONNACK Packet does not arrive within the CONNACKTimeout or
+// the Server is unavailable.
+func (cli *Client) connectAddress(ctx context.Context, opts *ConnectOptions, address string, prev *connection) (bool, bool, error) {
+	// Lock for the connection after the connection in progress ends.
+	if err := cli.lockConn(ctx); err != nil {
+		return false, false, err
+	}
 
 	// Return an error if the Client has already connected to the Server.
 	if cli.conn != nil {
-		return ErrAlreadyConnected
-	}
+		// Unlock.
+		cli.muConn.Unlock()
 
-	// Initialize the options.
-	if opts == nil {
-		opts = &ConnectOptions{}
+		return false, false, ErrAlreadyConnected
 	}
 
-	// Establish a Network Connection.
-	conn, err := newConnection(opts.Network, opts.Address, opts.TLSConfig)
+	// Mark the connection in progress so that the other methods
+	// wait for its end without the lock held during the handshake.
+	cli.connectingc = make(chan struct{})
+
+	// Unlock.
+	cli.muConn.Unlock()
+
+	// Establish a Network Connection and wait for the CONNACK Packet.
+	conn, next, err := cli.handshake(ctx, opts, address)
+
+	// Lock for setting the Network Connection.
+	cli.muConn.Lock()
+
+	// Unlock.
+	defer cli.muConn.Unlock()
+
+	// End the connection in progress. The waiting methods
+	// proceed after the Network Connection is set up.
+	close(cli.connectingc)
+	cli.connectingc = nil
+
 	if err != nil {
-		return err
+		// Clean the Network Connection and the Session if necessary.
+		cli.clean()
+
+		return false, next, err
 	}
 
 	// Set the Network Connection to the Client.
 	cli.conn = conn
 
+	// Get the unacknowledged PUBLISH and PUBREL Packets to resend to
+	// the Server if the Clean Session is false. This precedes the restoration
+	// of the subscriptions so that their SUBSCRIBE Packets are not deleted
+	// from the Session.
+	var resending []packet.Packet
+
+	if !opts.CleanSession {
+		if resending, err = cli.packetsToResend(); err != nil {
+			// Close the Network Connection.
+			cli.conn.Close()
+
+			// Clean the Network Connection and the Session if necessary.
+			cli.clean()
+
+			return false, false, err
+		}
+	}
+
+	// Restore the subscriptions of the previous Network Connection.
+	if prev != nil {
+		if err := cli.restoreSubs(ctx, prev); err != nil {
+			// Close the Network Connection.
+			cli.conn.Close()
+
+			// Clean the Network Connection and the Session if necessary.
+			cli.clean()
+
+			return false, false, err
+		}
+	}
+
+	// Keep the options and the address for the reconnection.
+	cli.connectOpts = opts
+	cli.lastAddress = address
+
+	// Launch a goroutine which receives a Packet from the Server.
+	cli.conn.wg.Add(1)
+	go cli.receivePackets()
+
+	// Launch a goroutine which sends a Packet to the Server.
+	cli.conn.wg.Add(1)
+	go cli.sendPackets(time.Duration(opts.KeepAlive), opts.PINGRESPTimeout)
+
+	// Launch a goroutine which resends the Packets of the Session so that
+	// the connection does not wait for the send channel to accept them.
+	if len(resending) > 0 {
+		cli.conn.wg.Add(1)
+		go cli.resend(cli.conn, resending)
+	}
+
+	return cli.conn.sessionPresent, false, nil
+}
+
+// readerOptions returns the options for the reader of the Packets
+// received from the Server. It returns nil if the default reader
+// is sufficient.
+func (cli *Client) readerOptions() *packet.ReaderOptions {
+	if cli.maxIncomingPacketSize <= 0 && (cli.streamThreshold <= 0 || cli.streamHandler == nil) {
+		return nil
+	}
+
+	opts := &packet.ReaderOptions{
+		MaxPacketSize: cli.maxIncomingPacketSize,
+	}
+
+	// Read the large Application Messages as a stream.
+	if cli.streamHandler != nil {
+		opts.StreamThreshold = cli.streamThreshold
+	}
+
+	return opts
+}
+
+// handshake establishes a Network Connection to the Server of the
+// address, sends a CONNECT Packet and waits for the CONNACK Packet
+// without holding the lock of the Network Connection. It returns the
+// Network Connection which the Server has accepted. It also returns
+// true along with the error if the Client can move to the next address.
+func (cli *Client) handshake(ctx context.Context, opts *ConnectOptions, address string) (*connection, bool, error) {
+	// Set the address to a copy of the options.
+	addrOpts := *opts
+	addrOpts.Address = address
+
+	// Establish a Network Connection.
+	conn, err := newConnection(ctx, &addrOpts, cli.readerOptions())
+	if err != nil {
+		return nil, true, err
+	}
+
+	// Set the address to the Network Connection.
+	conn.address = address
+
 	// Lock for reading and updating the Session.
 	cli.muSess.Lock()
 
 	// Create a Session or reuse the current Session.
 	if opts.CleanSession || cli.sess == nil {
 		// Create a Session and set it to the Client.
-		cli.sess = newSession(opts.CleanSession, opts.ClientID)
+		cli.sess = newSession(opts.CleanSession, opts.ClientID, cli.store)
+
+		// Load the in-flight Packets from the Store.
+		if err := cli.sess.load(); err != nil {
+			// Unlock.
+			cli.muSess.Unlock()
+
+			// Close the Network Connection.
+			conn.Close()
+
+			return nil, false, err
+		}
 	} else {
 		// Reuse the Session and set its Client Identifier to the options.
 		opts.ClientID = cli.sess.clientID
@@ -98,7 +423,7 @@ func (cli *Client) Connect(opts *ConnectOptions) error {
 	cli.muSess.Unlock()
 
 	// Send a CONNECT Packet to the Server.
-	err = cli.sendCONNECT(&packet.CONNECTOptions{
+	err = cli.sendCONNECT(conn, &packet.CONNECTOptions{
 		ClientID:     opts.ClientID,
 		UserName:     opts.UserName,
 		Password:     opts.Password,
@@ -112,72 +437,102 @@ func (cli *Client) Connect(opts *ConnectOptions) error {
 
 	if err != nil {
 		// Close the Network Connection.
-		cli.conn.Close()
+		conn.Close()
 
-		// Clean the Network Connection and the Session if necessary.
-		cli.clean()
+		return nil, false, err
+	}
 
-		return err
+	// Wait for receiving the CONNACK Packet.
+	if err := cli.waitCONNACK(ctx, conn, opts.CONNACKTimeout); err != nil {
+		// Close the Network Connection.
+		conn.Close()
+
+		// Move to the next address if the Server does not respond
+		// or is unavailable.
+		return nil, err == ErrCONNACKTimeout || err == ErrServerUnavailable, err
 	}
 
-	// Launch a goroutine which waits for receiving the CONNACK Packet.
-	cli.conn.wg.Add(1)
-	go cli.waitPacket(cli.conn.connack, opts.CONNACKTimeout, ErrCONNACKTimeout)
+	return conn, false, nil
+}
 
-	// Launch a goroutine which receives a Packet from the Server.
-	cli.conn.wg.Add(1)
-	go cli.receivePackets()
+// lockConn locks the Mutex for the Network Connection after the
+// connection in progress ends. It returns the context's error
+// without locking the Mutex if the context is done before.
+func (cli *Client) lockConn(ctx context.Context) error {
+	return cli.waitConnecting(ctx, cli.muConn.Lock, cli.muConn.Unlock)
+}
 
-	// Launch a goroutine which sends a Packet to the Server.
-	cli.conn.wg.Add(1)
-	go cli.sendPackets(time.Duration(opts.KeepAlive), opts.PINGRESPTimeout)
+// rlockConn works like lockConn but locks the Mutex for reading.
+func (cli *Client) rlockConn(ctx context.Context) error {
+	return cli.waitConnecting(ctx, cli.muConn.RLock, cli.muConn.RUnlock)
+}
 
-	// Resend the unacknowledged PUBLISH and PUBREL Packets to the Server
-	// if the Clean Session is false.
-	if !opts.CleanSession {
-		// Lock for reading and updating the Session.
-		cli.muSess.Lock()
+// waitConnecting locks the Mutex for the Network Connection by the
+// function and waits for the end of the connection in progress with
+// the Mutex unlocked until no connection is in progress.
+func (cli *Client) waitConnecting(ctx context.Context, lock, unlock func()) error {
+	for {
+		// Lock.
+		lock()
 
-		// Unlock.
-		defer cli.muSess.Unlock()
+		connectingc := cli.connectingc
+		if connectingc == nil {
+			return nil
+		}
 
-		for id, p := range cli.sess.sendingPackets {
-			// Extract the MQTT Control MQTT Control Packet type.
-			ptype, err := p.Type()
-			if err != nil {
-				return err
-			}
+		// Unlock while waiting.
+		unlock()
 
-			switch ptype {
-			case packet.TypePUBLISH:
-				// Set the DUP flag of the PUBLISH Packet to true.
-				p.(*packet.PUBLISH).DUP = true
-				// Resend the PUBLISH Packet to the Server.
-				cli.conn.send <- p
-			case packet.TypePUBREL:
-				// Resend the PUBREL Packet to the Server.
-				cli.conn.send <- p
-			default:
-				// Delete the Packet from the Session.
-				delete(cli.sess.sendingPackets, id)
-			}
+		select {
+		case <-connectingc:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
-
-	return nil
 }
 
 // Disconnect sends a DISCONNECT Packet to the Server and
 // closes the Network Connection.
 func (cli *Client) Disconnect() error {
-	// Lock for the disconnection.
-	cli.muConn.Lock()
+	if err := cli.disconnect(); err != nil {
+		return err
+	}
+
+	cli.logf(LogLevelInfo, "disconnected")
+
+	// Call the disconnect handler.
+	if cli.disconnectHandler != nil {
+		cli.disconnectHandler()
+	}
+
+	return nil
+}
+
+// disconnect sends a DISCONNECT Packet to the Server and
+// closes the Network Connection.
+func (cli *Client) disconnect() error {
+	// Lock for the disconnection after the connection in progress ends.
+	cli.lockConn(context.Background())
 
 	// Return an error if the Client has not yet connected to the Server.
 	if cli.conn == nil {
+		// Stop the automatic reconnection if it is in progress.
+		reconnecting := cli.reconnecting
+
+		if reconnecting {
+			select {
+			case cli.reconnEndc <- struct{}{}:
+			default:
+			}
+		}
+
 		// Unlock.
 		cli.muConn.Unlock()
 
+		if reconnecting {
+			return nil
+		}
+
 		return ErrNotYetConnected
 	}
 
@@ -187,13 +542,9 @@ func (cli *Client) Disconnect() error {
 	// even if the send method returns the error.
 	cli.send(packet.NewDISCONNECT())
 
-	// Close the Network Connection.
-	if err := cli.conn.Close(); err != nil {
-		// Unlock.
-		cli.muConn.Unlock()
-
-		return err
-	}
+	// Close the Network Connection. The error is returned after
+	// the subsequent disconnecting processing ends.
+	errClose := cli.conn.Close()
 
 	// Change the state of the Network Connection to disconnected.
 	cli.conn.disconnected = true
@@ -210,6 +561,9 @@ func (cli *Client) Disconnect() error {
 	// Wait until all goroutines end.
 	cli.conn.wg.Wait()
 
+	// Fail the Tokens which have not been completed.
+	cli.conn.completeTokens(ErrDisconnected)
+
 	// Lock for cleaning the Network Connection.
 	cli.muConn.Lock()
 
@@ -225,22 +579,247 @@ func (cli *Client) Disconnect() error {
 	// Unlock.
 	cli.muConn.Unlock()
 
-	return nil
+	return errClose
 }
 
-// Publish sends a PUBLISH Packet to the Server.
+// Publish sends a PUBLISH Packet to the Server. If the OfflineQueue
+// of the Options is set, the Application Message is queued while the
+// Client is disconnected and Publish returns without waiting for it
+// to be sent.
 func (cli *Client) Publish(opts *PublishOptions) error {
+	_, err := cli.publish(context.Background(), opts, cli.sendPUBLISH)
+	return err
+}
+
+// PublishContext sends a PUBLISH Packet to the Server and waits for
+// the completion of the delivery, which is the write of the Packet
+// for QoS 0, the arrival of the PUBACK Packet for QoS 1 and the
+// PUBCOMP Packet for QoS 2. It returns
+// the context's error if the context is done before the completion.
+// It waits for a free slot if the number of the in-flight Packets
+// has reached the MaxInflight of the Options.
+func (cli *Client) PublishContext(ctx context.Context, opts *PublishOptions) error {
+	t, err := cli.publish(ctx, opts, cli.sendPUBLISHWait)
+	if err != nil {
+		return err
+	}
+
+	return t.WaitContext(ctx)
+}
+
+// PublishAsync sends a PUBLISH Packet to the Server and returns
+// the Token of the delivery without waiting for it. The Token is
+// completed when the PUBACK Packet for QoS 1 or the PUBCOMP Packet
+// for QoS 2 arrives, or when the Packet is written for QoS 0. It
+// fails with ErrDisconnected if the Network Connection is
+// disconnected before.
+func (cli *Client) PublishAsync(opts *PublishOptions) (*Token, error) {
+	return cli.publish(context.Background(), opts, cli.sendPUBLISH)
+}
+
+// Subscribe sends a SUBSCRIBE Packet to the Server.
+func (cli *Client) Subscribe(opts *SubscribeOptions) error {
+	_, err := cli.sendSUBSCRIBE(context.Background(), opts)
+	return err
+}
+
+// SubscribeContext sends a SUBSCRIBE Packet to the Server and waits
+// for receiving the SUBACK Packet. It returns the context's error
+// if the context is done before the arrival of the SUBACK Packet and
+// a SubRefusedError if the Server refuses any subscription request.
+func (cli *Client) SubscribeContext(ctx context.Context, opts *SubscribeOptions) error {
+	t, err := cli.sendSUBSCRIBE(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := t.WaitContext(ctx); err != nil {
+		return err
+	}
+
+	return t.refusedError()
+}
+
+// SubscribeAsync sends a SUBSCRIBE Packet to the Server and returns
+// the Token of the subscription without waiting for it. The Token is
+// completed when the SUBACK Packet arrives and reports the granted QoS
+// or the refusal of each subscription request.
+func (cli *Client) SubscribeAsync(opts *SubscribeOptions) (*SubscribeToken, error) {
+	return cli.sendSUBSCRIBE(context.Background(), opts)
+}
+
+// Unsubscribe sends an UNSUBSCRIBE Packet to the Server.
+func (cli *Client) Unsubscribe(opts *UnsubscribeOptions) error {
+	_, err := cli.sendUNSUBSCRIBE(context.Background(), opts)
+	return err
+}
+
+// UnsubscribeContext sends an UNSUBSCRIBE Packet to the Server and waits
+// for receiving the UNSUBACK Packet. It returns the context's error
+// if the context is done before the arrival of the UNSUBACK Packet.
+func (cli *Client) UnsubscribeContext(ctx context.Context, opts *UnsubscribeOptions) error {
+	t, err := cli.sendUNSUBSCRIBE(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	return t.WaitContext(ctx)
+}
+
+// UnsubscribeAsync sends an UNSUBSCRIBE Packet to the Server and returns
+// the Token of the unsubscription without waiting for it. The Token is
+// completed when the UNSUBACK Packet arrives.
+func (cli *Client) UnsubscribeAsync(opts *UnsubscribeOptions) (*Token, error) {
+	return cli.sendUNSUBSCRIBE(context.Background(), opts)
+}
+
+// SessionPresent returns true if the Server has resumed
+// the existing Session on the current Network Connection.
+func (cli *Client) SessionPresent() bool {
 	// Lock for reading.
 	cli.muConn.RLock()
 
 	// Unlock.
 	defer cli.muConn.RUnlock()
 
-	// Check the Network Connection.
+	return cli.conn != nil && cli.conn.sessionPresent
+}
+
+// ConnectedAddress returns the address of the Server which
+// the current Network Connection is established to. It returns
+// an empty string if the Client has not yet connected to the Server.
+func (cli *Client) ConnectedAddress() string {
+	// Lock for reading.
+	cli.muConn.RLock()
+
+	// Unlock.
+	defer cli.muConn.RUnlock()
+
+	if cli.conn == nil {
+		return ""
+	}
+
+	return cli.conn.address
+}
+
+// Inflight returns the number of the PUBLISH and PUBREL Packets
+// which are sent to the Server and not yet acknowledged.
+func (cli *Client) Inflight() int {
+	// Lock for reading.
+	cli.muSess.RLock()
+
+	// Unlock.
+	defer cli.muSess.RUnlock()
+
+	if cli.sess == nil {
+		return 0
+	}
+
+	return cli.sess.inflight
+}
+
+// QueueLen returns the number of the Packets which are
+// waiting to be sent to the Server.
+func (cli *Client) QueueLen() int {
+	// Lock for reading.
+	cli.muConn.RLock()
+
+	// Unlock.
+	defer cli.muConn.RUnlock()
+
+	if cli.conn == nil {
+		return 0
+	}
+
+	return len(cli.conn.send)
+}
+
+// Terminate ternimates the Client.
+func (cli *Client) Terminate() {
+	// Send the end signal to the disconnecting goroutine.
+	cli.disconnEndc <- struct{}{}
+
+	// Close the offline queue.
+	if cli.offlineQueue != nil {
+		cli.offlineQueue.close()
+	}
+
+	// Wait until all goroutines end.
+	cli.wg.Wait()
+
+	// Stop dispatching the Application Messages.
+	if cli.dispatcher != nil {
+		cli.dispatcher.close()
+	}
+}
+
+// send sends an MQTT Control Packet to the Server.
+func (cli *Client) send(p packet.Packet) error {
+	// Return an error if the Client has not yet connected to the Server.
 	if cli.conn == nil {
 		return ErrNotYetConnected
 	}
 
+	return cli.write(cli.conn, p)
+}
+
+// write writes an MQTT Control Packet to the Network Connection.
+// The writes to the same Network Connection are serialized.
+func (cli *Client) write(conn *connection, p packet.Packet) error {
+	// Lock for writing.
+	conn.muWrite.Lock()
+
+	// Unlock.
+	defer conn.muWrite.Unlock()
+
+	// Write the Packet to the Network Connection. The Packet is not
+	// buffered so that its large payload is written by a vectored write.
+	n, err := p.WriteTo(conn.Conn)
+	if err != nil {
+		return err
+	}
+
+	// Trace the Packet.
+	cli.tracePacket(DirectionSending, p, int(n))
+
+	return nil
+}
+
+// sendCONNECT creates a CONNECT Packet and sends it to the Server
+// through the Network Connection which is being established.
+func (cli *Client) sendCONNECT(conn *connection, opts *packet.CONNECTOptions) error {
+	// Initialize the options.
+	if opts == nil {
+		opts = &packet.CONNECTOptions{}
+	}
+
+	// Create a CONNECT Packet.
+	p, err := packet.NewCONNECT(opts)
+	if err != nil {
+		return err
+	}
+
+	// Send a CONNECT Packet to the Server.
+	return cli.write(conn, p)
+}
+
+// sendPUBLISH creates a PUBLISH Packet and puts it into the send channel.
+// It returns the Token of the delivery, which is completed when
+// the Packet is written if the QoS of the Packet is QoS 0.
+func (cli *Client) sendPUBLISH(ctx context.Context, opts *PublishOptions) (*Token, error) {
+	// Lock for reading after the connection in progress ends.
+	if err := cli.rlockConn(ctx); err != nil {
+		return nil, err
+	}
+
+	// Unlock.
+	defer cli.muConn.RUnlock()
+
+	// Check the Network Connection.
+	if cli.conn == nil {
+		return nil, ErrNotYetConnected
+	}
+
 	// Initialize the options.
 	if opts == nil {
 		opts = &PublishOptions{}
@@ -249,54 +828,273 @@ func (cli *Client) Publish(opts *PublishOptions) error {
 	// Create a PUBLISH Packet.
 	p, err := cli.newPUBLISHPacket(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Send the Packet to the Server.
-	cli.conn.send <- p
+	if opts.QoS == mqtt.QoS0 {
+		// Register the Token which is completed when the Packet,
+		// including the Application Message of the MessageReader,
+		// has been written.
+		t := cli.conn.addWriteToken(p)
 
-	return nil
+		if err := cli.enqueue(ctx, cli.conn, p); err != nil {
+			// Unregister the Token.
+			cli.conn.removeWriteToken(p)
+
+			return nil, err
+		}
+
+		return t, nil
+	}
+
+	return cli.enqueueWithToken(ctx, cli.conn, cli.sess, p, p.(*packet.PUBLISH).PacketID)
 }
 
-// Subscribe sends a SUBSCRIBE Packet to the Server.
-func (cli *Client) Subscribe(opts *SubscribeOptions) error {
-	// Lock for reading and updating.
-	cli.muConn.Lock()
+// publish sends the PUBLISH Packet by the function. It puts the
+// Application Message into the offline queue instead if the Client
+// is disconnected or the queue has the Application Messages which
+// have not been sent yet so that the order is kept.
+func (cli *Client) publish(ctx context.Context, opts *PublishOptions, send func(context.Context, *PublishOptions) (*Token, error)) (*Token, error) {
+	if cli.offlineQueue == nil {
+		return send(ctx, opts)
+	}
+
+	// Initialize the options.
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+
+	// Validate the options before queueing them.
+	if _, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:           opts.QoS,
+		Retain:        opts.Retain,
+		TopicName:     opts.TopicName,
+		PacketID:      minPacketID,
+		Message:       opts.Message,
+		MessageReader: opts.MessageReader,
+		MessageLen:    opts.MessageLen,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Copy the options and their buffers so that
+	// the caller can reuse them.
+	queued := *opts
+	queued.TopicName = append([]byte(nil), opts.TopicName...)
+	queued.Message = append([]byte(nil), opts.Message...)
+
+	for {
+		// Check the connection and the queue and put the Application
+		// Message into the queue at once so that no Application Message
+		// is queued before the one which is sent directly.
+		t, ok, err := cli.offlineQueue.pushUnless(ctx, &queued, cli.connected)
+		if err != nil || ok {
+			return t, err
+		}
+
+		// Send the Application Message directly. It is queued
+		// if the Network Connection has been lost in the meantime.
+		t, err = send(ctx, opts)
+		if err != ErrNotYetConnected {
+			return t, err
+		}
+	}
+}
+
+// connected returns true if the Client has connected to the Server.
+func (cli *Client) connected() bool {
+	// Lock for reading.
+	cli.muConn.RLock()
 
 	// Unlock.
-	defer cli.muConn.Unlock()
+	defer cli.muConn.RUnlock()
+
+	return cli.conn != nil
+}
+
+// sendOfflineQueue sends the Application Messages in the offline queue
+// in order each time it receives the signal. It stops sending them when
+// the Network Connection is lost and resumes after the next connection.
+func (cli *Client) sendOfflineQueue() {
+	defer cli.wg.Done()
+
+	q := cli.offlineQueue
+
+	for {
+		select {
+		case <-q.kickc:
+		case <-q.ctx.Done():
+			return
+		}
+
+		for e := q.next(); e != nil; e = q.next() {
+			// Send the Application Message, waiting for
+			// a free slot of the in-flight Packets.
+			t, err := cli.sendPUBLISHWait(q.ctx, e.opts)
+
+			// Keep the Application Message until the next connection.
+			if err == ErrNotYetConnected {
+				q.release(e)
+				break
+			}
+
+			// End if the queue has been closed.
+			if !q.remove(e) {
+				return
+			}
+
+			if err != nil {
+				e.token.complete(err)
+				continue
+			}
+
+			// Complete the Token of the queue along
+			// with the Token of the delivery.
+			e.token.follow(t)
+		}
+	}
+}
+
+// OfflineQueueLen returns the number of the Application Messages
+// in the offline queue which have not been sent yet.
+func (cli *Client) OfflineQueueLen() int {
+	if cli.offlineQueue == nil {
+		return 0
+	}
+
+	return cli.offlineQueue.len()
+}
+
+// sendPUBLISHWait calls sendPUBLISH and retries it each time an in-flight
+// Packet is acknowledged while the number of the in-flight Packets has
+// reached the maximum. It returns the context's error if the context
+// is done before the Packet is put into the send channel.
+func (cli *Client) sendPUBLISHWait(ctx context.Context, opts *PublishOptions) (*Token, error) {
+	for {
+		// Get the channel before trying so that
+		// the acknowledgment is not missed.
+		inflightc := cli.inflightFreed()
+
+		t, err := cli.sendPUBLISH(ctx, opts)
+		if err != ErrMaxInflightExceeded {
+			return t, err
+		}
+
+		// Wait for the acknowledgment of an in-flight Packet.
+		select {
+		case <-inflightc:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// inflightFreed returns the channel which is closed
+// when an in-flight Packet is acknowledged.
+func (cli *Client) inflightFreed() <-chan struct{} {
+	// Lock for reading.
+	cli.muInflight.Lock()
+
+	// Unlock.
+	defer cli.muInflight.Unlock()
+
+	return cli.inflightc
+}
+
+// notifyInflightFreed notifies the goroutines which wait
+// for the acknowledgment of an in-flight Packet.
+func (cli *Client) notifyInflightFreed() {
+	// Lock for updating.
+	cli.muInflight.Lock()
+
+	// Unlock.
+	defer cli.muInflight.Unlock()
+
+	close(cli.inflightc)
+
+	cli.inflightc = make(chan struct{})
+}
+
+// sendSUBSCRIBE creates a SUBSCRIBE Packet and puts it into the send channel.
+func (cli *Client) sendSUBSCRIBE(ctx context.Context, opts *SubscribeOptions) (*SubscribeToken, error) {
+	// Lock for reading and updating after the connection in progress ends.
+	if err := cli.lockConn(ctx); err != nil {
+		return nil, err
+	}
 
 	// Check the Network Connection.
 	if cli.conn == nil {
-		return ErrNotYetConnected
+		// Unlock.
+		cli.muConn.Unlock()
+
+		return nil, ErrNotYetConnected
+	}
+
+	// Check the existence of the options.
+	if opts == nil || len(opts.SubReqs) == 0 {
+		// Unlock.
+		cli.muConn.Unlock()
+
+		return nil, packet.ErrInvalidNoSubReq
+	}
+
+	// Get the Network Connection and the Session
+	// which the Packet is sent through.
+	conn, sess := cli.conn, cli.sess
+
+	// Create a SUBSCRIBE Packet.
+	p, packetID, err := cli.newSUBSCRIBE(opts.SubReqs)
+
+	// Unlock so that the Packets keep being sent
+	// while waiting for the send channel.
+	cli.muConn.Unlock()
+
+	if err != nil {
+		return nil, err
 	}
 
-	// Check the existence of the options.
-	if opts == nil || len(opts.SubReqs) == 0 {
-		return packet.ErrInvalidNoSubReq
-	}
+	// Send the Packet to the Server.
+	t, err := cli.enqueueWithSubToken(ctx, conn, sess, p, packetID)
+	if err != nil {
+		// Lock for updating the Network Connection.
+		cli.muConn.Lock()
 
-	// Define a Packet Identifier.
-	var packetID uint16
+		// Delete the subscription information
+		// from the Network Connection.
+		conn.removeUnackSubs(opts.SubReqs)
 
-	// Define an error.
-	var err error
+		// Unlock.
+		cli.muConn.Unlock()
+
+		return nil, err
+	}
+
+	return t, nil
+}
 
+// newSUBSCRIBE creates a SUBSCRIBE Packet, sets it to the Session and
+// sets the subscription information to the Network Connection. It returns
+// the Packet along with its Packet Identifier.
+// The Mutex for the Network Connection must be locked by the caller.
+func (cli *Client) newSUBSCRIBE(subReqs []*SubReq) (packet.Packet, uint16, error) {
 	// Lock for updating the Session.
 	cli.muSess.Lock()
 
+	// Unlock.
 	defer cli.muSess.Unlock()
 
 	// Generate a Packet Identifer.
-	if packetID, err = cli.generatePacketID(); err != nil {
-		return err
+	packetID, err := cli.generatePacketID()
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// Create subscription requests for the SUBSCRIBE Packet.
-	var subReqs []*packet.SubReq
+	var packetSubReqs []*packet.SubReq
 
-	for _, s := range opts.SubReqs {
-		subReqs = append(subReqs, &packet.SubReq{
+	for _, s := range subReqs {
+		packetSubReqs = append(packetSubReqs, &packet.SubReq{
 			TopicFilter: s.TopicFilter,
 			QoS:         s.QoS,
 		})
@@ -305,59 +1103,62 @@ func (cli *Client) Subscribe(opts *SubscribeOptions) error {
 	// Create a SUBSCRIBE Packet.
 	p, err := packet.NewSUBSCRIBE(&packet.SUBSCRIBEOptions{
 		PacketID: packetID,
-		SubReqs:  subReqs,
+		SubReqs:  packetSubReqs,
 	})
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
 	// Set the Packet to the Session.
-	cli.sess.sendingPackets[packetID] = p
+	cli.sess.setSendingPacket(packetID, p)
 
 	// Set the subscription information to
 	// the Network Connection.
-	for _, s := range opts.SubReqs {
-		cli.conn.unackSubs[string(s.TopicFilter)] = s.Handler
+	for _, s := range subReqs {
+		cli.conn.unackSubs[string(s.TopicFilter)] = s
 	}
 
-	// Send the Packet to the Server.
-	cli.conn.send <- p
-
-	return nil
+	return p, packetID, nil
 }
 
-// Unsubscribe sends an UNSUBSCRIBE Packet to the Server.
-func (cli *Client) Unsubscribe(opts *UnsubscribeOptions) error {
-	// Lock for reading and updating.
-	cli.muConn.Lock()
-
-	// Unlock.
-	defer cli.muConn.Unlock()
+// sendUNSUBSCRIBE creates an UNSUBSCRIBE Packet and puts it into the send channel.
+func (cli *Client) sendUNSUBSCRIBE(ctx context.Context, opts *UnsubscribeOptions) (*Token, error) {
+	// Lock for reading and updating after the connection in progress ends.
+	if err := cli.lockConn(ctx); err != nil {
+		return nil, err
+	}
 
 	// Check the Network Connection.
 	if cli.conn == nil {
-		return ErrNotYetConnected
+		// Unlock.
+		cli.muConn.Unlock()
+
+		return nil, ErrNotYetConnected
 	}
 
 	// Check the existence of the options.
 	if opts == nil || len(opts.TopicFilters) == 0 {
-		return packet.ErrNoTopicFilter
-	}
+		// Unlock.
+		cli.muConn.Unlock()
 
-	// Define a Packet Identifier.
-	var packetID uint16
+		return nil, packet.ErrNoTopicFilter
+	}
 
-	// Define an error.
-	var err error
+	// Get the Network Connection and the Session
+	// which the Packet is sent through.
+	conn, sess := cli.conn, cli.sess
 
 	// Lock for updating the Session.
 	cli.muSess.Lock()
 
-	defer cli.muSess.Unlock()
-
 	// Generate a Packet Identifer.
-	if packetID, err = cli.generatePacketID(); err != nil {
-		return err
+	packetID, err := cli.generatePacketID()
+	if err != nil {
+		// Unlock.
+		cli.muSess.Unlock()
+		cli.muConn.Unlock()
+
+		return nil, err
 	}
 
 	// Create an UNSUBSCRIBE Packet.
@@ -366,58 +1167,112 @@ func (cli *Client) Unsubscribe(opts *UnsubscribeOptions) error {
 		TopicFilters: opts.TopicFilters,
 	})
 	if err != nil {
-		return err
+		// Unlock.
+		cli.muSess.Unlock()
+		cli.muConn.Unlock()
+
+		return nil, err
 	}
 
 	// Set the Packet to the Session.
-	cli.sess.sendingPackets[packetID] = p
+	cli.sess.setSendingPacket(packetID, p)
+
+	// Unlock so that the Packets keep being sent
+	// while waiting for the send channel.
+	cli.muSess.Unlock()
+	cli.muConn.Unlock()
 
 	// Send the Packet to the Server.
-	cli.conn.send <- p
+	return cli.enqueueWithToken(ctx, conn, sess, p, packetID)
+}
 
-	return nil
+// enqueue puts the Packet into the send channel of the Network Connection.
+// It returns ErrDisconnected if the Network Connection stops sending the
+// Packets or the context's error if the context is done before the channel
+// accepts the Packet.
+func (cli *Client) enqueue(ctx context.Context, conn *connection, p packet.Packet) error {
+	select {
+	case conn.send <- p:
+		return nil
+	case <-conn.sendDone:
+		return ErrDisconnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// Terminate ternimates the Client.
-func (cli *Client) Terminate() {
-	// Send the end signal to the disconnecting goroutine.
-	cli.disconnEndc <- struct{}{}
+// enqueueAck puts the Packet which acknowledges the one received from
+// the Server into the send channel of the Network Connection. It returns
+// ErrDisconnected if the Network Connection stops sending the Packets
+// before the channel accepts the Packet. The Mutexes for the Network
+// Connection and the Session must not be locked by the caller so that
+// the Packets keep being sent while it waits.
+func (cli *Client) enqueueAck(p packet.Packet) error {
+	// Lock for reading.
+	cli.muConn.RLock()
 
-	// Wait until all goroutines end.
-	cli.wg.Wait()
+	conn := cli.conn
+
+	// Unlock.
+	cli.muConn.RUnlock()
+
+	return cli.enqueue(context.Background(), conn, p)
 }
 
-// send sends an MQTT Control Packet to the Server.
-func (cli *Client) send(p packet.Packet) error {
-	// Return an error if the Client has not yet connected to the Server.
-	if cli.conn == nil {
-		return ErrNotYetConnected
-	}
+// enqueueWithToken registers the Token of the Packet and puts
+// the Packet into the send channel of the Network Connection. The Packet
+// is deleted from the Session if it is not put into the channel.
+func (cli *Client) enqueueWithToken(ctx context.Context, conn *connection, sess *session, p packet.Packet, packetID uint16) (*Token, error) {
+	// Register the Token before sending the Packet.
+	t := conn.addToken(packetID)
 
-	// Write the Packet to the buffered writer.
-	if _, err := p.WriteTo(cli.conn.w); err != nil {
-		return err
+	if err := cli.enqueueRegistered(ctx, conn, sess, p, packetID); err != nil {
+		return nil, err
 	}
 
-	// Flush the buffered writer.
-	return cli.conn.w.Flush()
+	return t, nil
 }
 
-// sendCONNECT creates a CONNECT Packet and sends it to the Server.
-func (cli *Client) sendCONNECT(opts *packet.CONNECTOptions) error {
-	// Initialize the options.
-	if opts == nil {
-		opts = &packet.CONNECTOptions{}
+// enqueueWithSubToken registers the SubscribeToken of the SUBSCRIBE
+// Packet and puts the Packet into the send channel of the Network
+// Connection. The Packet is deleted from the Session if it is not
+// put into the channel.
+func (cli *Client) enqueueWithSubToken(ctx context.Context, conn *connection, sess *session, p packet.Packet, packetID uint16) (*SubscribeToken, error) {
+	// Register the SubscribeToken before sending the Packet.
+	t := conn.addSubToken(packetID)
+
+	if err := cli.enqueueRegistered(ctx, conn, sess, p, packetID); err != nil {
+		return nil, err
 	}
 
-	// Create a CONNECT Packet.
-	p, err := packet.NewCONNECT(opts)
-	if err != nil {
+	return t, nil
+}
+
+// enqueueRegistered puts the Packet whose Token is registered into
+// the send channel of the Network Connection. The Token is unregistered
+// and the Packet is deleted from the Session which it has been set to
+// if the Packet is not put into the channel.
+func (cli *Client) enqueueRegistered(ctx context.Context, conn *connection, sess *session, p packet.Packet, packetID uint16) error {
+	if err := cli.enqueue(ctx, conn, p); err != nil {
+		// Unregister the Token.
+		conn.removeToken(packetID)
+
+		// Lock for updating the Session.
+		cli.muSess.Lock()
+
+		// Delete the Packet from the Session.
+		sess.deleteSendingPacket(packetID)
+
+		// Unlock.
+		cli.muSess.Unlock()
+
+		// Notify the release of the in-flight Packet.
+		cli.notifyInflightFreed()
+
 		return err
 	}
 
-	// Send a CONNECT Packet to the Server.
-	return cli.send(p)
+	return nil
 }
 
 // receive receives an MQTT Control Packet from the Server.
@@ -427,48 +1282,254 @@ func (cli *Client) receive() (packet.Packet, error) {
 		return nil, ErrNotYetConnected
 	}
 
-	// Get the first byte of the Packet.
-	b, err := cli.conn.r.ReadByte()
+	return cli.read(cli.conn)
+}
+
+// read reads an MQTT Control Packet from the Network Connection.
+func (cli *Client) read(conn *connection) (packet.Packet, error) {
+	// Read a Packet.
+	p, n, err := conn.r.ReadPacket()
 	if err != nil {
 		return nil, err
 	}
 
-	// Create the Fixed header.
-	fixedHeader := packet.FixedHeader([]byte{b})
+	// Trace the Packet.
+	cli.tracePacket(DirectionReceiving, p, n)
 
-	// Get and decode the Remaining Length.
-	var mp uint32 = 1 // multiplier
-	var rl uint32     // the Remaining Length
-	for {
-		// Get the next byte of the Packet.
-		b, err = cli.conn.r.ReadByte()
+	return p, nil
+}
+
+// waitCONNACK receives the CONNACK Packet from the Server through
+// the Network Connection which is being established and checks its
+// Connect Return code.
+func (cli *Client) waitCONNACK(ctx context.Context, conn *connection, timeout time.Duration) error {
+	// Set the deadline for receiving the CONNACK Packet.
+	if timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout * time.Second)); err != nil {
+			return err
+		}
+	}
+
+	// Clear the deadline after all.
+	defer conn.SetReadDeadline(time.Time{})
+
+	// Interrupt receiving the Packet when the context is done.
+	defer watchContext(ctx, conn.Conn)()
+
+	// Receive a Packet from the Server.
+	p, err := cli.read(conn)
+	if err != nil {
+		// Return the context's error if the context is done.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Return the timeout error if the deadline has been exceeded.
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return ErrCONNACKTimeout
+		}
+
+		return err
+	}
+
+	// Check the MQTT Control Packet type.
+	connack, ok := p.(*packet.CONNACK)
+	if !ok {
+		return ErrInvalidCONNACK
+	}
+
+	// Return an error if the Server refuses the connection.
+	if err, exist := connRetErrs[connack.ConnectReturnCode]; exist {
+		return err
+	}
+
+	// Set the Session Present to the Network Connection.
+	conn.sessionPresent = connack.SessionPresent
+
+	return nil
+}
+
+// packetsToResend returns the unacknowledged PUBLISH and PUBREL Packets
+// of the Session which are resent to the Server. It deletes the other
+// Packets, which cannot be resent, from the Session.
+// The Mutex for the Network Connection must be locked by the caller.
+func (cli *Client) packetsToResend() ([]packet.Packet, error) {
+	// Lock for reading and updating the Session.
+	cli.muSess.Lock()
+
+	// Unlock.
+	defer cli.muSess.Unlock()
+
+	var packets []packet.Packet
+
+	for id, p := range cli.sess.sendingPackets {
+		// Extract the MQTT Control MQTT Control Packet type.
+		ptype, err := p.Type()
 		if err != nil {
 			return nil, err
 		}
 
-		fixedHeader = append(fixedHeader, b)
+		switch ptype {
+		case packet.TypePUBLISH:
+			// Delete the PUBLISH Packet whose Application Message
+			// has been consumed and cannot be read again.
+			if !p.(*packet.PUBLISH).Rewindable() {
+				if err := cli.sess.deleteSendingPacket(id); err != nil {
+					return nil, err
+				}
+
+				// Notify the release of the in-flight Packet.
+				cli.notifyInflightFreed()
+
+				continue
+			}
 
-		rl += uint32(b&0x7F) * mp
+			// Set the DUP flag of the PUBLISH Packet to true.
+			p.(*packet.PUBLISH).DUP = true
 
-		if b&0x80 == 0 {
-			break
+			packets = append(packets, p)
+		case packet.TypePUBREL:
+			packets = append(packets, p)
+		default:
+			// Delete the Packet from the Session.
+			if err := cli.sess.deleteSendingPacket(id); err != nil {
+				return nil, err
+			}
+
+			// Notify the release of the in-flight Packet.
+			cli.notifyInflightFreed()
 		}
+	}
 
-		mp *= 128
+	return packets, nil
+}
+
+// resend puts the Packets of the Session into the send channel of
+// the Network Connection. It ends when the Network Connection stops
+// sending the Packets. The Packets remain in the Session so that
+// they are resent after the next connection.
+func (cli *Client) resend(conn *connection, packets []packet.Packet) {
+	defer conn.wg.Done()
+
+	for _, p := range packets {
+		if err := cli.enqueue(context.Background(), conn, p); err != nil {
+			return
+		}
 	}
+}
+
+// restoreSubs restores the subscriptions of the previous Network
+// Connection. The subscriptions are sent to the Server again unless
+// the Server has resumed the Session which holds the acknowledged ones.
+// The Mutex for the Network Connection must be locked by the caller.
+func (cli *Client) restoreSubs(ctx context.Context, prev *connection) error {
+	// Define the subscription requests which are sent to the Server.
+	var subReqs []*SubReq
+
+	for topicFilter, s := range prev.ackedSubs {
+		if cli.conn.sessionPresent {
+			// Take over the acknowledged subscription.
+			cli.conn.addAckedSub(topicFilter, s)
+			continue
+		}
 
-	// Create the Remaining (the Variable header and the Payload).
-	remaining := make([]byte, rl)
+		subReqs = append(subReqs, s)
+	}
 
-	if rl > 0 {
-		// Get the remaining of the Packet.
-		if _, err = io.ReadFull(cli.conn.r, remaining); err != nil {
-			return nil, err
+	for _, s := range prev.unackSubs {
+		subReqs = append(subReqs, s)
+	}
+
+	// End the process if there is no subscription to send.
+	if len(subReqs) == 0 {
+		return nil
+	}
+
+	// Create a SUBSCRIBE Packet.
+	p, packetID, err := cli.newSUBSCRIBE(subReqs)
+	if err != nil {
+		return err
+	}
+
+	// Send the Packet to the Server.
+	_, err = cli.enqueueWithSubToken(ctx, cli.conn, cli.sess, p, packetID)
+	return err
+}
+
+// reconnect tries to reconnect to the Server with the options of the
+// latest successful connection until it succeeds or the number of
+// attempts exceeds the maximum retries. It returns false if the Client
+// has been terminated while reconnecting.
+func (cli *Client) reconnect(prev *connection) bool {
+	// Lock for updating the state of the reconnection.
+	cli.muConn.Lock()
+
+	// Get the options of the latest successful connection.
+	connectOpts := cli.connectOpts
+
+	// Discard the stale signal which stops the reconnection.
+	select {
+	case <-cli.reconnEndc:
+	default:
+	}
+
+	cli.reconnecting = true
+
+	// Unlock.
+	cli.muConn.Unlock()
+
+	defer func() {
+		// Lock for updating the state of the reconnection.
+		cli.muConn.Lock()
+
+		cli.reconnecting = false
+
+		// Unlock.
+		cli.muConn.Unlock()
+	}()
+
+	// Get the initial backoff interval.
+	interval := cli.reconnOpts.initialInterval()
+
+	for i := 0; cli.reconnOpts.MaxRetries <= 0 || i < cli.reconnOpts.MaxRetries; i++ {
+		select {
+		case <-time.After(cli.reconnOpts.jitter(interval)):
+		case <-cli.reconnEndc:
+			// End the reconnection because the Client has been disconnected.
+			return true
+		case <-cli.disconnEndc:
+			// End the reconnection because the Client has been terminated.
+			return false
 		}
+
+		cli.logf(LogLevelInfo, "reconnecting (attempt %d)", i+1)
+
+		// Reconnect to the Server.
+		err := cli.connect(context.Background(), connectOpts, prev)
+
+		switch err {
+		case nil, ErrAlreadyConnected:
+			// End the reconnection because the Client has connected to the Server.
+			return true
+		}
+
+		// Handle the error.
+		if cli.errorHandler != nil {
+			cli.errorHandler(err)
+		}
+
+		// Calculate the next backoff interval.
+		interval = cli.reconnOpts.nextInterval(interval)
+	}
+
+	cli.logf(LogLevelError, "%v", ErrReconnectFailed)
+
+	// Handle the error.
+	if cli.errorHandler != nil {
+		cli.errorHandler(ErrReconnectFailed)
 	}
 
-	// Create and return a Packet.
-	return packet.NewFromBytes(fixedHeader, remaining)
+	return true
 }
 
 // clean cleans the Network Connection and the Session if necessary.
@@ -479,6 +1540,9 @@ func (cli *Client) clean() {
 	// Clean the Session if the Clean Session is true.
 	if cli.sess != nil && cli.sess.cleanSession {
 		cli.sess = nil
+
+		// Notify the release of the in-flight Packets.
+		cli.notifyInflightFreed()
 	}
 }
 
@@ -502,13 +1566,7 @@ func (cli *Client) waitPacket(packetc <-chan struct{}, timeout time.Duration, er
 
 // receivePackets receives Packets from the Server.
 func (cli *Client) receivePackets() {
-	defer func() {
-		// Close the channel which handles a signal which
-		// notifies the arrival of the CONNACK Packet.
-		close(cli.conn.connack)
-
-		cli.conn.wg.Done()
-	}()
+	defer cli.conn.wg.Done()
 
 	for {
 		// Receive a Packet from the Server.
@@ -544,8 +1602,8 @@ func (cli *Client) handlePacket(p packet.Packet) error {
 
 	switch ptype {
 	case packet.TypeCONNACK:
-		cli.handleCONNACK()
-		return nil
+		// The Server must not send the CONNACK Packet twice.
+		return ErrInvalidCONNACK
 	case packet.TypePUBLISH:
 		return cli.handlePUBLISH(p)
 	case packet.TypePUBACK:
@@ -567,41 +1625,120 @@ func (cli *Client) handlePacket(p packet.Packet) error {
 	}
 }
 
-// handleCONNACK handles the CONNACK Packet.
-func (cli *Client) handleCONNACK() {
-	// Notify the arrival of the CONNACK Packet if possible.
-	select {
-	case cli.conn.connack <- struct{}{}:
-	default:
+// handlePUBLISH handles the PUBLISH Packet.
+func (cli *Client) handlePUBLISH(p packet.Packet) error {
+	// Get the PUBLISH Packet.
+	publish := p.(*packet.PUBLISH)
+
+	// Handle the Application Message which is read as a stream.
+	if publish.MessageReader != nil {
+		return cli.handleStreamPUBLISH(publish)
+	}
+
+	switch publish.QoS {
+	case mqtt.QoS0:
+		// Handle the Application Message.
+		cli.handleMessage(publish, nil)
+
+		return nil
+	case mqtt.QoS1:
+		// Leave the acknowledgment to the message handlers
+		// in the manual acknowledgment mode.
+		if cli.manualAck {
+			// Lock for update.
+			cli.muSess.Lock()
+
+			// Register the Application Message as unacknowledged.
+			ack := cli.trackMessage(publish)
+
+			// Unlock.
+			cli.muSess.Unlock()
+
+			// Handle the Application Message.
+			cli.handleMessage(publish, ack)
+
+			return nil
+		}
+
+		// Handle the Application Message.
+		cli.handleMessage(publish, nil)
+
+		// Create a PUBACK Packet.
+		puback, err := packet.NewPUBACK(&packet.PUBACKOptions{
+			PacketID: publish.PacketID,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Send the Packet to the Server.
+		return cli.enqueueAck(puback)
+	default:
+		// Lock for update.
+		cli.muSess.Lock()
+
+		// Validate the Packet Identifier. The PUBLISH Packet which
+		// is resent with the DUP flag is acknowledged again without
+		// handling the Application Message twice.
+		if _, exist := cli.sess.receivingPackets[publish.PacketID]; exist && !publish.DUP {
+			// Unlock.
+			cli.muSess.Unlock()
+
+			return packet.ErrInvalidPacketID
+		}
+
+		// Set the Packet to the Session.
+		if _, exist := cli.sess.receivingPackets[publish.PacketID]; !exist {
+			if err := cli.sess.putReceivingPacket(publish.PacketID, p); err != nil {
+				// Unlock.
+				cli.muSess.Unlock()
+
+				return err
+			}
+		}
+
+		// Unlock.
+		cli.muSess.Unlock()
+
+		// Create a PUBREC Packet.
+		pubrec, err := packet.NewPUBREC(&packet.PUBRECOptions{
+			PacketID: publish.PacketID,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Send the Packet to the Server.
+		return cli.enqueueAck(pubrec)
 	}
 }
 
-// handlePUBLISH handles the PUBLISH Packet.
-func (cli *Client) handlePUBLISH(p packet.Packet) error {
-	// Get the PUBLISH Packet.
-	publish := p.(*packet.PUBLISH)
+// handleStreamPUBLISH passes the PUBLISH Packet whose Application Message
+// is read as a stream to the stream handler and acknowledges it after the
+// handler returns. The Application Message of the QoS 2 PUBLISH Packet is
+// handled on its receipt because it cannot be read after the PUBREL Packet
+// arrives.
+func (cli *Client) handleStreamPUBLISH(publish *packet.PUBLISH) error {
+	// Create a Message.
+	msg := Message{
+		TopicName:     publish.TopicName,
+		PayloadReader: publish.MessageReader,
+		PayloadLen:    publish.MessageLen,
+		QoS:           publish.QoS,
+		Retain:        publish.Retain,
+		DUP:           publish.DUP,
+		PacketID:      publish.PacketID,
+	}
 
 	switch publish.QoS {
 	case mqtt.QoS0:
-		// Lock for reading.
-		cli.muConn.RLock()
-
-		// Unlock.
-		defer cli.muConn.RUnlock()
-
 		// Handle the Application Message.
-		cli.handleMessage(publish.TopicName, publish.Message)
+		cli.streamHandler(&msg)
 
 		return nil
 	case mqtt.QoS1:
-		// Lock for reading.
-		cli.muConn.RLock()
-
-		// Unlock.
-		defer cli.muConn.RUnlock()
-
 		// Handle the Application Message.
-		cli.handleMessage(publish.TopicName, publish.Message)
+		cli.streamHandler(&msg)
 
 		// Create a PUBACK Packet.
 		puback, err := packet.NewPUBACK(&packet.PUBACKOptions{
@@ -612,23 +1749,42 @@ func (cli *Client) handlePUBLISH(p packet.Packet) error {
 		}
 
 		// Send the Packet to the Server.
-		cli.conn.send <- puback
-
-		return nil
+		return cli.enqueueAck(puback)
 	default:
-		// Lock for update.
+		// Lock for reading.
 		cli.muSess.Lock()
 
+		_, exist := cli.sess.receivingPackets[publish.PacketID]
+
 		// Unlock.
-		defer cli.muSess.Unlock()
+		cli.muSess.Unlock()
 
-		// Validate the Packet Identifier.
-		if _, exist := cli.sess.receivingPackets[publish.PacketID]; exist {
+		// Validate the Packet Identifier. The PUBLISH Packet which
+		// is resent with the DUP flag is acknowledged again without
+		// handling the Application Message twice.
+		if exist && !publish.DUP {
 			return packet.ErrInvalidPacketID
 		}
 
+		// Handle the Application Message.
+		if !exist {
+			cli.streamHandler(&msg)
+		}
+
 		// Set the Packet to the Session.
-		cli.sess.receivingPackets[publish.PacketID] = p
+		if !exist {
+			// Lock for update.
+			cli.muSess.Lock()
+
+			err := cli.sess.putReceivingPacket(publish.PacketID, publish)
+
+			// Unlock.
+			cli.muSess.Unlock()
+
+			if err != nil {
+				return err
+			}
+		}
 
 		// Create a PUBREC Packet.
 		pubrec, err := packet.NewPUBREC(&packet.PUBRECOptions{
@@ -639,9 +1795,7 @@ func (cli *Client) handlePUBLISH(p packet.Packet) error {
 		}
 
 		// Send the Packet to the Server.
-		cli.conn.send <- pubrec
-
-		return nil
+		return cli.enqueueAck(pubrec)
 	}
 }
 
@@ -662,7 +1816,15 @@ func (cli *Client) handlePUBACK(p packet.Packet) error {
 	}
 
 	// Delete the PUBLISH Packet from the Session.
-	delete(cli.sess.sendingPackets, id)
+	if err := cli.sess.deleteSendingPacket(id); err != nil {
+		return err
+	}
+
+	// Notify the release of the in-flight Packet.
+	cli.notifyInflightFreed()
+
+	// Complete the Token.
+	cli.conn.completeToken(id, nil)
 
 	return nil
 }
@@ -672,14 +1834,14 @@ func (cli *Client) handlePUBREC(p packet.Packet) error {
 	// Lock for update.
 	cli.muSess.Lock()
 
-	// Unlock.
-	defer cli.muSess.Unlock()
-
 	// Extract the Packet Identifier of the Packet.
 	id := p.(*packet.PUBREC).PacketID
 
 	// Validate the Packet Identifier.
 	if err := cli.validatePacketID(cli.sess.sendingPackets, id, packet.TypePUBLISH); err != nil {
+		// Unlock.
+		cli.muSess.Unlock()
+
 		return err
 	}
 
@@ -688,16 +1850,26 @@ func (cli *Client) handlePUBREC(p packet.Packet) error {
 		PacketID: id,
 	})
 	if err != nil {
+		// Unlock.
+		cli.muSess.Unlock()
+
 		return err
 	}
 
 	// Set the PUBREL Packet to the Session.
-	cli.sess.sendingPackets[id] = pubrel
+	if err := cli.sess.putSendingPacket(id, pubrel); err != nil {
+		// Unlock.
+		cli.muSess.Unlock()
 
-	// Send the Packet to the Server.
-	cli.conn.send <- pubrel
+		return err
+	}
 
-	return nil
+	// Unlock.
+	cli.muSess.Unlock()
+
+	// Send the Packet to the Server. The PUBREL Packet remains in
+	// the Session so that it is resent after the reconnection.
+	return cli.enqueueAck(pubrel)
 }
 
 // handlePUBREL handles the PUBREL Packet.
@@ -705,31 +1877,60 @@ func (cli *Client) handlePUBREL(p packet.Packet) error {
 	// Lock for update.
 	cli.muSess.Lock()
 
-	// Unlock.
-	defer cli.muSess.Unlock()
-
 	// Extract the Packet Identifier of the Packet.
 	id := p.(*packet.PUBREL).PacketID
 
 	// Validate the Packet Identifier.
 	if err := cli.validatePacketID(cli.sess.receivingPackets, id, packet.TypePUBLISH); err != nil {
+		// Unlock.
+		cli.muSess.Unlock()
+
 		return err
 	}
 
 	// Get the Packet from the Session.
 	publish := cli.sess.receivingPackets[id].(*packet.PUBLISH)
 
-	// Lock for reading.
-	cli.muConn.RLock()
+	switch {
+	case publish.MessageReader != nil:
+		// The Application Message which is read as a stream
+		// has already been handled on receipt of the PUBLISH Packet.
+	case cli.manualAck:
+		// Leave the acknowledgment to the message handlers
+		// in the manual acknowledgment mode.
 
-	// Handle the Application Message.
-	cli.handleMessage(publish.TopicName, publish.Message)
+		// Register the Application Message as unacknowledged.
+		ack := cli.trackMessage(publish)
 
-	// Unlock.
-	cli.muConn.RUnlock()
+		// Unlock so that the Application Message is
+		// dispatched without holding the lock.
+		cli.muSess.Unlock()
+
+		// Handle the Application Message.
+		cli.handleMessage(publish, ack)
+
+		return nil
+	default:
+		// Unlock so that the Application Message is
+		// dispatched without holding the lock.
+		cli.muSess.Unlock()
+
+		// Handle the Application Message.
+		cli.handleMessage(publish, nil)
+
+		// Lock for update.
+		cli.muSess.Lock()
+	}
 
 	// Delete the Packet from the Session
-	delete(cli.sess.receivingPackets, id)
+	err := cli.sess.deleteReceivingPacket(id)
+
+	// Unlock.
+	cli.muSess.Unlock()
+
+	if err != nil {
+		return err
+	}
 
 	// Create a PUBCOMP Packet.
 	pubcomp, err := packet.NewPUBCOMP(&packet.PUBCOMPOptions{
@@ -740,9 +1941,7 @@ func (cli *Client) handlePUBREL(p packet.Packet) error {
 	}
 
 	// Send the Packet to the Server.
-	cli.conn.send <- pubcomp
-
-	return nil
+	return cli.enqueueAck(pubcomp)
 }
 
 // handlePUBCOMP handles the PUBCOMP Packet.
@@ -762,13 +1961,44 @@ func (cli *Client) handlePUBCOMP(p packet.Packet) error {
 	}
 
 	// Delete the PUBREL Packet from the Session.
-	delete(cli.sess.sendingPackets, id)
+	if err := cli.sess.deleteSendingPacket(id); err != nil {
+		return err
+	}
+
+	// Notify the release of the in-flight Packet.
+	cli.notifyInflightFreed()
+
+	// Complete the Token.
+	cli.conn.completeToken(id, nil)
 
 	return nil
 }
 
 // handleSUBACK handles the SUBACK Packet.
 func (cli *Client) handleSUBACK(p packet.Packet) error {
+	// Update the subscriptions.
+	results, err := cli.ackSubs(p.(*packet.SUBACK))
+	if err != nil {
+		return err
+	}
+
+	// Notify the refused subscriptions to the error handler.
+	if cli.errorHandler != nil {
+		for _, r := range results {
+			if r.Refused {
+				cli.errorHandler(&SubRefusedError{TopicFilter: r.TopicFilter})
+			}
+		}
+	}
+
+	return nil
+}
+
+// ackSubs updates the subscriptions of the Network Connection
+// according to the SUBACK Packet, completes the Token of the
+// SUBSCRIBE Packet and returns the results of the subscription
+// requests.
+func (cli *Client) ackSubs(p *packet.SUBACK) ([]*SubResult, error) {
 	// Lock for update.
 	cli.muConn.Lock()
 	cli.muSess.Lock()
@@ -778,44 +2008,67 @@ func (cli *Client) handleSUBACK(p packet.Packet) error {
 	defer cli.muSess.Unlock()
 
 	// Extract the Packet Identifier of the Packet.
-	id := p.(*packet.SUBACK).PacketID
+	id := p.PacketID
 
 	// Validate the Packet Identifier.
 	if err := cli.validatePacketID(cli.sess.sendingPackets, id, packet.TypeSUBSCRIBE); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get the subscription requests of the SUBSCRIBE Packet.
 	subreqs := cli.sess.sendingPackets[id].(*packet.SUBSCRIBE).SubReqs
 
 	// Delete the SUBSCRIBE Packet from the Session.
-	delete(cli.sess.sendingPackets, id)
+	if err := cli.sess.deleteSendingPacket(id); err != nil {
+		return nil, err
+	}
 
 	// Get the Return Codes of the SUBACK Packet.
-	returnCodes := p.(*packet.SUBACK).ReturnCodes
+	returnCodes := p.ReturnCodes
 
 	// Check the lengths of the Return Codes.
 	if len(returnCodes) != len(subreqs) {
-		return ErrInvalidSUBACK
+		return nil, ErrInvalidSUBACK
 	}
 
+	// Create the results of the subscription requests.
+	results := make([]*SubResult, len(returnCodes))
+
 	// Set the subscriptions to the Network Connection.
 	for i, code := range returnCodes {
-		// Skip if the Return Code is failure.
+		// Get the Topic Filter.
+		topicFilter := string(subreqs[i].TopicFilter)
+
+		// Create the result of the subscription request.
+		results[i] = &SubResult{
+			TopicFilter:  subreqs[i].TopicFilter,
+			RequestedQoS: subreqs[i].QoS,
+		}
+
+		// Discard the subscription information
+		// if the Return Code is failure.
 		if code == packet.SUBACKRetFailure {
+			results[i].Refused = true
+
+			delete(cli.conn.unackSubs, topicFilter)
+
 			continue
 		}
 
-		// Get the Topic Filter.
-		topicFilter := string(subreqs[i].TopicFilter)
+		results[i].GrantedQoS = code
 
 		// Move the subscription information from
 		// unackSubs to ackedSubs.
-		cli.conn.ackedSubs[topicFilter] = cli.conn.unackSubs[topicFilter]
-		delete(cli.conn.unackSubs, topicFilter)
+		if s, exist := cli.conn.unackSubs[topicFilter]; exist {
+			cli.conn.addAckedSub(topicFilter, s)
+			delete(cli.conn.unackSubs, topicFilter)
+		}
 	}
 
-	return nil
+	// Complete the Token.
+	cli.conn.completeSubToken(id, results)
+
+	return results, nil
 }
 
 // handleUNSUBACK handles the UNSUBACK Packet.
@@ -840,13 +2093,18 @@ func (cli *Client) handleUNSUBACK(p packet.Packet) error {
 	topicFilters := cli.sess.sendingPackets[id].(*packet.UNSUBSCRIBE).TopicFilters
 
 	// Delete the UNSUBSCRIBE Packet from the Session.
-	delete(cli.sess.sendingPackets, id)
+	if err := cli.sess.deleteSendingPacket(id); err != nil {
+		return err
+	}
 
 	// Delete the Topic Filters from the Network Connection.
 	for _, topicFilter := range topicFilters {
-		delete(cli.conn.ackedSubs, string(topicFilter))
+		cli.conn.removeAckedSub(string(topicFilter))
 	}
 
+	// Complete the Token.
+	cli.conn.completeToken(id, nil)
+
 	return nil
 }
 
@@ -909,11 +2167,32 @@ func (cli *Client) handleErrorAndDisconn(err error) {
 	// Send a disconnect signal to the goroutine
 	// via the channel if possible.
 	select {
-	case cli.disconnc <- struct{}{}:
+	case cli.disconnc <- err:
+		cli.logf(LogLevelWarn, "connection lost: %v", err)
 	default:
 	}
 }
 
+// logf records the message of a state transition
+// if the level is enabled.
+func (cli *Client) logf(level LogLevel, format string, args ...interface{}) {
+	if cli.logger == nil || level < cli.logLevel {
+		return
+	}
+
+	cli.logger.Log(level, fmt.Sprintf(format, args...))
+}
+
+// tracePacket records the summary of the Packet
+// if the debug level is enabled.
+func (cli *Client) tracePacket(dir Direction, p packet.Packet, size int) {
+	if cli.logger == nil || cli.logLevel > LogLevelDebug {
+		return
+	}
+
+	cli.logger.TracePacket(newPacketSummary(dir, p, size))
+}
+
 // sendPackets sends Packets to the Server.
 func (cli *Client) sendPackets(keepAlive time.Duration, pingrespTimeout time.Duration) {
 	defer func() {
@@ -932,6 +2211,9 @@ func (cli *Client) sendPackets(keepAlive time.Duration, pingrespTimeout time.Dur
 		// Unlock.
 		cli.conn.muPINGRESPs.Unlock()
 
+		// Notify the end of sending the Packets.
+		close(cli.conn.sendDone)
+
 		cli.conn.wg.Done()
 	}()
 
@@ -944,14 +2226,15 @@ func (cli *Client) sendPackets(keepAlive time.Duration, pingrespTimeout time.Dur
 
 		select {
 		case p := <-cli.conn.send:
-			// Lock for sending the Packet.
-			cli.muConn.RLock()
-
-			// Send the Packet to the Server.
-			err := cli.send(p)
+			// Send the Packet to the Server without holding the lock
+			// of the Network Connection so that streaming a large
+			// Application Message does not block the other operations.
+			// The Network Connection is not cleaned until this
+			// goroutine ends.
+			err := cli.write(cli.conn, p)
 
-			// Unlock.
-			cli.muConn.RUnlock()
+			// Complete the Token of the Packet which waits for the write.
+			cli.conn.completeWriteToken(p, err)
 
 			if err != nil {
 				// Handle the error and disconnect the Network Connection.
@@ -1002,26 +2285,25 @@ func (cli *Client) sendPackets(keepAlive time.Duration, pingrespTimeout time.Dur
 }
 
 // generatePacketID generates and returns a Packet Identifier.
+// The Packet Identifiers are allocated in rotation, skipping
+// the ones which are still in use.
 func (cli *Client) generatePacketID() (uint16, error) {
-	// Define a Packet Identifier.
-	id := minPacketID
-
 	for {
-		// Find a Packet Identifier which does not used.
-		if _, exist := cli.sess.sendingPackets[id]; !exist {
-			// Return the Packet Identifier.
-			return id, nil
+		// Get the next Packet Identifier which is not in use.
+		id, ok := cli.sess.packetIDs.next()
+		if !ok {
+			// Return an error if available ids are not found.
+			return 0, ErrPacketIDExhaused
 		}
 
-		if id == maxPacketID {
-			break
+		// Return the Packet Identifier unless the Session has it.
+		if _, exist := cli.sess.sendingPackets[id]; !exist {
+			return id, nil
 		}
 
-		id++
+		// Mark the Packet Identifier of the Session as in use.
+		cli.sess.packetIDs.use(id)
 	}
-
-	// Return an error if available ids are not found.
-	return 0, ErrPacketIDExhaused
 }
 
 // newPUBLISHPacket creates and returns a PUBLISH Packet.
@@ -1035,6 +2317,11 @@ func (cli *Client) newPUBLISHPacket(opts *PublishOptions) (packet.Packet, error)
 
 		defer cli.muSess.Unlock()
 
+		// Check the number of the in-flight Packets.
+		if cli.maxInflight > 0 && cli.sess.inflight >= cli.maxInflight {
+			return nil, ErrMaxInflightExceeded
+		}
+
 		// Define an error.
 		var err error
 
@@ -1046,11 +2333,13 @@ func (cli *Client) newPUBLISHPacket(opts *PublishOptions) (packet.Packet, error)
 
 	// Create a PUBLISH Packet.
 	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		QoS:       opts.QoS,
-		Retain:    opts.Retain,
-		TopicName: opts.TopicName,
-		PacketID:  packetID,
-		Message:   opts.Message,
+		QoS:           opts.QoS,
+		Retain:        opts.Retain,
+		TopicName:     opts.TopicName,
+		PacketID:      packetID,
+		Message:       opts.Message,
+		MessageReader: opts.MessageReader,
+		MessageLen:    opts.MessageLen,
 	})
 	if err != nil {
 		return nil, err
@@ -1058,7 +2347,9 @@ func (cli *Client) newPUBLISHPacket(opts *PublishOptions) (packet.Packet, error)
 
 	if opts.QoS != mqtt.QoS0 {
 		// Set the Packet to the Session.
-		cli.sess.sendingPackets[packetID] = p
+		if err := cli.sess.putSendingPacket(packetID, p); err != nil {
+			return nil, err
+		}
 	}
 
 	// Return the Packet.
@@ -1094,19 +2385,194 @@ func (cli *Client) validatePacketID(packets map[uint16]packet.Packet, id uint16,
 	return nil
 }
 
-// handleMessage handles the Application Message.
-func (cli *Client) handleMessage(topicName, message []byte) {
-	// Get the string of the Topic Name.
-	topicNameStr := string(topicName)
+// handleMessage dispatches the Application Message to the message
+// handlers of the matching subscriptions or to the default message
+// handler if there is no such subscription. The dispatch is done
+// without holding the locks because it may block. If ack is not nil,
+// it is called after all message handlers acknowledge the Application
+// Message or immediately if there is no message handler.
+func (cli *Client) handleMessage(publish *packet.PUBLISH, ack func()) {
+	// Lock for reading.
+	cli.muConn.RLock()
+
+	// Find the matching subscriptions.
+	subs := cli.matchSubs(publish.TopicName)
+
+	// Unlock.
+	cli.muConn.RUnlock()
+
+	// Pass the Application Message to the default message handler
+	// if it matches no subscription.
+	if len(subs) == 0 && cli.defaultMessageHandler != nil {
+		subs = []*SubReq{
+			&SubReq{
+				MessageFunc: cli.defaultMessageHandler,
+			},
+		}
+	}
+
+	// Acknowledge the Application Message which no
+	// message handler is going to handle.
+	if len(subs) == 0 {
+		if ack != nil {
+			ack()
+		}
+
+		return
+	}
+
+	// Share the acknowledgment among the message handlers.
+	var mack *messageAck
+
+	if ack != nil {
+		mack = newMessageAck(len(subs), ack)
+	}
+
+	for _, s := range subs {
+		// Create a Message.
+		msg := Message{
+			TopicName: publish.TopicName,
+			Payload:   publish.Message,
+			QoS:       publish.QoS,
+			Retain:    publish.Retain,
+			DUP:       publish.DUP,
+			PacketID:  publish.PacketID,
+		}
+
+		if mack != nil {
+			msg.ack = mack.ackFunc()
+		}
+
+		// Dispatch the Application Message and stop tracking it if it
+		// is dropped because no one is going to acknowledge it.
+		if !cli.dispatcher.dispatch(s, msg) && mack != nil {
+			cli.forgetMessage(publish)
+		}
+	}
+}
+
+// trackMessage registers the PUBLISH Packet as unacknowledged in the
+// Session and returns the function which acknowledges it. The Packet
+// which has been resent replaces the previous one. This method must
+// be called while holding the lock of the Session.
+func (cli *Client) trackMessage(publish *packet.PUBLISH) func() {
+	cli.sess.unackedMessages[publish.PacketID] = publish
 
-	for topicFilter, handler := range cli.conn.ackedSubs {
-		if handler == nil || !match(topicNameStr, topicFilter) {
-			continue
+	return func() {
+		if err := cli.ackMessage(publish); err != nil && cli.errorHandler != nil {
+			cli.errorHandler(err)
 		}
+	}
+}
+
+// forgetMessage deletes the PUBLISH Packet from the unacknowledged
+// ones in the Session without acknowledging it. The Server resends
+// the PUBLISH Packet when the Session is resumed.
+func (cli *Client) forgetMessage(publish *packet.PUBLISH) {
+	// Lock for update.
+	cli.muSess.Lock()
+
+	// Unlock.
+	defer cli.muSess.Unlock()
+
+	if cli.sess != nil && cli.sess.unackedMessages[publish.PacketID] == publish {
+		delete(cli.sess.unackedMessages, publish.PacketID)
+	}
+}
+
+// ackMessage sends the PUBACK or PUBCOMP Packet for the PUBLISH
+// Packet which has been acknowledged by the message handlers. It does
+// nothing if the PUBLISH Packet is no longer unacknowledged in the
+// Session, e.g. the Session has been cleaned.
+func (cli *Client) ackMessage(publish *packet.PUBLISH) error {
+	// Lock for reading.
+	cli.muConn.RLock()
+
+	// Unlock.
+	defer cli.muConn.RUnlock()
+
+	// Lock for update.
+	cli.muSess.Lock()
+
+	// Unlock.
+	defer cli.muSess.Unlock()
+
+	// Do nothing if the PUBLISH Packet is not unacknowledged.
+	if cli.sess == nil || cli.sess.unackedMessages[publish.PacketID] != publish {
+		return nil
+	}
+
+	// Return an error if the Client has not yet connected to the Server.
+	// The PUBLISH Packet remains unacknowledged so that it is handled
+	// again when the Server resends it.
+	if cli.conn == nil {
+		return ErrNotYetConnected
+	}
+
+	var p packet.Packet
+	var err error
+
+	if publish.QoS == mqtt.QoS1 {
+		// Create a PUBACK Packet.
+		p, err = packet.NewPUBACK(&packet.PUBACKOptions{
+			PacketID: publish.PacketID,
+		})
+	} else {
+		// Create a PUBCOMP Packet.
+		p, err = packet.NewPUBCOMP(&packet.PUBCOMPOptions{
+			PacketID: publish.PacketID,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// Send the Packet to the Server. The PUBLISH Packet remains
+	// unacknowledged if the Network Connection is disconnected before.
+	select {
+	case cli.conn.send <- p:
+	case <-cli.conn.sendDone:
+		return ErrDisconnected
+	}
+
+	// Delete the PUBLISH Packet from the unacknowledged ones.
+	delete(cli.sess.unackedMessages, publish.PacketID)
+
+	// Delete the QoS 2 PUBLISH Packet from the Session.
+	if publish.QoS == mqtt.QoS2 {
+		return cli.sess.deleteReceivingPacket(publish.PacketID)
+	}
+
+	return nil
+}
+
+// matchSubs returns the acknowledged subscriptions which
+// have a message handler and match the Topic Name.
+func (cli *Client) matchSubs(topicName []byte) []*SubReq {
+	// Return nil if the Client has not yet connected to the Server.
+	if cli.conn == nil {
+		return nil
+	}
+
+	// Return nil if there is no subscription.
+	if cli.conn.ackedSubTrie == nil {
+		return nil
+	}
+
+	// Find the subscriptions from the index.
+	subs := cli.conn.ackedSubTrie.match(string(topicName))
 
-		// Execute the handler.
-		go handler(topicName, message)
+	// Exclude the subscriptions which have no message handler.
+	n := 0
+
+	for _, s := range subs {
+		if s.messageFunc() != nil {
+			subs[n] = s
+			n++
+		}
 	}
+
+	return subs[:n]
 }
 
 // New creates and returns a Client.
@@ -1115,11 +2581,37 @@ func New(opts *Options) *Client {
 	if opts == nil {
 		opts = &Options{}
 	}
+
 	// Create a Client.
 	cli := &Client{
-		disconnc:     make(chan struct{}, 1),
-		disconnEndc:  make(chan struct{}),
-		errorHandler: opts.ErrorHandler,
+		disconnc:              make(chan error, 1),
+		disconnEndc:           make(chan struct{}),
+		errorHandler:          opts.ErrorHandler,
+		connectHandler:        opts.OnConnect,
+		connectionLostHandler: opts.OnConnectionLost,
+		disconnectHandler:     opts.OnDisconnect,
+		reconnOpts:            opts.Reconnect,
+		store:                 opts.Store,
+		reconnEndc:            make(chan struct{}, 1),
+		maxInflight:           opts.MaxInflight,
+		inflightc:             make(chan struct{}),
+		dispatcher:            newDispatcher(opts.Dispatch, opts.ErrorHandler),
+		defaultMessageHandler: opts.DefaultMessageHandler,
+		manualAck:             opts.ManualAck,
+		streamThreshold:       opts.StreamThreshold,
+		streamHandler:         opts.StreamHandler,
+		maxIncomingPacketSize: opts.MaxIncomingPacketSize,
+		logger:                opts.Logger,
+		logLevel:              opts.LogLevel,
+	}
+
+	// Launch a goroutine which sends the Application Messages
+	// published while the Client is disconnected.
+	if opts.OfflineQueue != nil {
+		cli.offlineQueue = newOfflineQueue(opts.OfflineQueue)
+
+		cli.wg.Add(1)
+		go cli.sendOfflineQueue()
 	}
 
 	// Launch a goroutine which disconnects the Network Connection.
@@ -1131,11 +2623,35 @@ func New(opts *Options) *Client {
 
 		for {
 			select {
-			case <-cli.disconnc:
-				if err := cli.Disconnect(); err != nil {
+			case cause := <-cli.disconnc:
+				// Get the Network Connection which is going to be
+				// disconnected to restore its subscriptions later.
+				cli.muConn.RLock()
+				conn := cli.conn
+				cli.muConn.RUnlock()
+
+				if err := cli.disconnect(); err != nil {
 					if cli.errorHandler != nil {
 						cli.errorHandler(err)
 					}
+
+					// End the processing if there is no Network Connection
+					// to disconnect. Otherwise the Network Connection has
+					// been cleaned despite the error of closing it.
+					if err == ErrNotYetConnected {
+						continue
+					}
+				}
+
+				// Notify the loss of the Network Connection.
+				if cli.connectionLostHandler != nil {
+					cli.connectionLostHandler(cause)
+				}
+
+				// Reconnect to the Server if the automatic reconnection is enabled.
+				if cli.reconnOpts != nil && !cli.reconnect(conn) {
+					// End the goroutine because the Client has been terminated.
+					return
 				}
 			case <-cli.disconnEndc:
 				// End the goroutine.
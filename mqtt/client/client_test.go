@@ -1,9 +1,18 @@
 package client
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,12 +22,19 @@ import (
 
 var errTest = errors.New("test error")
 
+// testCONNACK is the CONNACK Packet which accepts the connection.
+var testCONNACK = []byte{packet.TypeCONNACK << 4, 0x02, 0x00, 0x00}
+
 type packetErr struct{}
 
 func (p *packetErr) WriteTo(w io.Writer) (int64, error) {
 	return 0, errTest
 }
 
+func (p *packetErr) AppendTo(b []byte) []byte {
+	return b
+}
+
 func (p *packetErr) Type() (byte, error) {
 	return 0x00, errTest
 }
@@ -50,7 +66,7 @@ func TestClient_Connect_restoreSession_TypeErr(t *testing.T) {
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.sess = newSession(false, []byte("cliendID"))
+	cli.sess = newSession(false, []byte("cliendID"), nil)
 
 	cli.sess.sendingPackets[1] = &packetErr{}
 
@@ -68,7 +84,7 @@ func TestClient_Connect_restoreSession(t *testing.T) {
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.sess = newSession(false, []byte("cliendID"))
+	cli.sess = newSession(false, []byte("cliendID"), nil)
 
 	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
 		PacketID: 1,
@@ -146,335 +162,474 @@ func TestClient_Connect_CloseErr(t *testing.T) {
 	ln.Close()
 }
 
-func TestClient_Disconnect_sendEndDefault(t *testing.T) {
+func TestClient_Connect_ErrCONNACKTimeout(t *testing.T) {
+	ln := newTestServer(t, nil)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
 	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
+		Network:        "tcp",
+		Address:        ln.Addr().String(),
+		CONNACKTimeout: 1,
+		ClientID:       []byte("clientID"),
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if err != ErrCONNACKTimeout {
+		invalidError(t, err, ErrCONNACKTimeout)
 	}
 
-	cli.conn.sendEnd <- struct{}{}
-
-	time.Sleep(3 * time.Second)
-
-	cli.conn.sendEnd <- struct{}{}
-
-	if err := cli.Disconnect(); err != nil {
-		nilErrorExpected(t, err)
+	if cli.conn != nil {
+		t.Error("cli.conn => not nil, want => nil")
 	}
 }
 
-func TestClient_Publish_connNil(t *testing.T) {
+func TestClient_Connect_ErrInvalidCONNACK(t *testing.T) {
+	ln := newTestServer(t, []byte{packet.TypePINGRESP << 4, 0x00})
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	if err := cli.Publish(nil); err != ErrNotYetConnected {
-		invalidError(t, err, ErrNotYetConnected)
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != ErrInvalidCONNACK {
+		invalidError(t, err, ErrInvalidCONNACK)
 	}
 }
 
-func TestClient_Publish_newPUBLISHPacketErr(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
-
-	cli.conn = &connection{}
-
-	cli.sess = newSession(false, []byte("cliendID"))
+func TestClient_Connect_refused(t *testing.T) {
+	for code, want := range connRetErrs {
+		ln := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x00, code})
+
+		cli := New(&Options{
+			ErrorHandler: func(_ error) {},
+		})
+
+		err := cli.Connect(&ConnectOptions{
+			Network:  "tcp",
+			Address:  ln.Addr().String(),
+			ClientID: []byte("clientID"),
+		})
+		if err != want {
+			invalidError(t, err, want)
+		}
 
-	err := cli.Publish(&PublishOptions{
-		QoS: 0x03,
-	})
+		if cli.conn != nil {
+			t.Error("cli.conn => not nil, want => nil")
+		}
 
-	if err != packet.ErrInvalidQoS {
-		invalidError(t, err, packet.ErrInvalidQoS)
+		ln.Close()
 	}
 }
 
-func TestClient_Publish(t *testing.T) {
+func TestClient_Connect_sessionPresent(t *testing.T) {
+	ln := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x01, 0x00})
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.conn = &connection{}
-
-	cli.conn.send = make(chan packet.Packet, 1)
+	if cli.SessionPresent() {
+		t.Error("cli.SessionPresent() => true, want => false")
+	}
 
-	if err := cli.Publish(nil); err != nil {
+	err := cli.Connect(&ConnectOptions{
+		Network:      "tcp",
+		Address:      ln.Addr().String(),
+		ClientID:     []byte("clientID"),
+		CleanSession: false,
+	})
+	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
-}
 
-func TestClient_Subscribe_connNil(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+	defer cli.Disconnect()
 
-	if err := cli.Subscribe(nil); err != ErrNotYetConnected {
-		invalidError(t, err, ErrNotYetConnected)
+	if !cli.SessionPresent() {
+		t.Error("cli.SessionPresent() => false, want => true")
 	}
 }
 
-func TestClient_Subscribe_ErrInvalidNoSubReq(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+func TestClient_Connect_Addresses(t *testing.T) {
+	// Get an address which refuses the connection.
+	closed, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	cli.conn = &connection{}
+	closed.Close()
 
-	if err := cli.Subscribe(nil); err != packet.ErrInvalidNoSubReq {
-		invalidError(t, err, packet.ErrInvalidNoSubReq)
-	}
-}
+	silent := newTestServer(t, nil)
+	defer silent.Close()
+
+	broker := newTestBroker(t)
+	defer broker.Close()
 
-func TestClient_Subscribe_generatePacketIDErr(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.conn = &connection{}
+	defer cli.Terminate()
 
-	cli.sess = newSession(false, []byte("clientID"))
+	if address := cli.ConnectedAddress(); address != "" {
+		t.Errorf("cli.ConnectedAddress() => %q, want => %q", address, "")
+	}
 
-	id := minPacketID
+	opts := &ConnectOptions{
+		Network: "tcp",
+		Addresses: []string{
+			closed.Addr().String(),
+			silent.Addr().String(),
+			broker.Addr().String(),
+		},
+		CONNACKTimeout: 1,
+		ClientID:       []byte("clientID"),
+	}
 
-	for {
-		cli.sess.sendingPackets[id] = nil
+	if err := cli.Connect(opts); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-		if id == maxPacketID {
-			break
-		}
+	if address := cli.ConnectedAddress(); address != broker.Addr().String() {
+		t.Errorf("cli.ConnectedAddress() => %q, want => %q", address, broker.Addr().String())
+	}
 
-		id++
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+		return
 	}
 
-	err := cli.Subscribe(&SubscribeOptions{
-		SubReqs: []*SubReq{
-			&SubReq{},
-		},
-	})
+	if address := cli.ConnectedAddress(); address != "" {
+		t.Errorf("cli.ConnectedAddress() => %q, want => %q", address, "")
+	}
 
-	if err != ErrPacketIDExhaused {
-		invalidError(t, err, ErrPacketIDExhaused)
+	// Connect to the address of the latest successful connection first.
+	opts.CONNACKTimeout = 0
+
+	if err := cli.Connect(opts); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_Subscribe_NewSUBSCRIBEErr(t *testing.T) {
+func TestClient_Connect_AddressesRefused(t *testing.T) {
+	refused := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x00, packet.ConnRetNotAuthorized})
+	defer refused.Close()
+
+	broker := newTestBroker(t)
+	defer broker.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.conn = &connection{}
-
-	cli.sess = newSession(false, []byte("clientID"))
+	defer cli.Terminate()
 
-	err := cli.Subscribe(&SubscribeOptions{
-		SubReqs: []*SubReq{
-			&SubReq{},
-		},
+	// The Client does not move to the next address
+	// if the Server refuses the connection.
+	err := cli.Connect(&ConnectOptions{
+		Network:   "tcp",
+		Addresses: []string{refused.Addr().String(), broker.Addr().String()},
+		ClientID:  []byte("clientID"),
 	})
-
-	if err != packet.ErrNoTopicFilter {
-		invalidError(t, err, packet.ErrNoTopicFilter)
+	if err != ErrNotAuthorized {
+		invalidError(t, err, ErrNotAuthorized)
 	}
 }
 
-func TestClient_Subscribe(t *testing.T) {
+func TestClient_Connect_AddressesServerUnavailable(t *testing.T) {
+	unavailable := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x00, packet.ConnRetServerUnavailable})
+	defer unavailable.Close()
+
+	broker := newTestBroker(t)
+	defer broker.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.conn = &connection{}
-
-	cli.sess = newSession(false, []byte("clientID"))
-
-	cli.conn.unackSubs = make(map[string]MessageHandler)
-
-	cli.conn.send = make(chan packet.Packet, 1)
+	defer cli.Terminate()
 
-	err := cli.Subscribe(&SubscribeOptions{
-		SubReqs: []*SubReq{
-			&SubReq{
-				TopicFilter: []byte("topicFilter"),
-			},
-		},
+	// The Client moves to the next address
+	// if the Server is unavailable.
+	err := cli.Connect(&ConnectOptions{
+		Network:   "tcp",
+		Addresses: []string{unavailable.Addr().String(), broker.Addr().String()},
+		ClientID:  []byte("clientID"),
 	})
-
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
-}
 
-func TestClient_Unsubscribe_connNil(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+	if address := cli.ConnectedAddress(); address != broker.Addr().String() {
+		t.Errorf("cli.ConnectedAddress() => %q, want => %q", address, broker.Addr().String())
+	}
 
-	if err := cli.Unsubscribe(nil); err != ErrNotYetConnected {
-		invalidError(t, err, ErrNotYetConnected)
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_Unsubscribe_ErrNoTopicFilter(t *testing.T) {
+func TestClient_addresses(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.conn = &connection{}
+	defer cli.Terminate()
 
-	if err := cli.Unsubscribe(nil); err != packet.ErrNoTopicFilter {
-		invalidError(t, err, packet.ErrNoTopicFilter)
+	opts := &ConnectOptions{
+		Address:   "d",
+		Addresses: []string{"a", "b", "c"},
 	}
-}
-
-func TestClient_Unsubscribe_generatePacketIDErr(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
 
-	cli.conn = &connection{}
-
-	cli.sess = newSession(false, []byte("clientID"))
+	if got := strings.Join(cli.addresses(opts), ","); got != "a,b,c" {
+		t.Errorf("cli.addresses(opts) => %q, want => %q", got, "a,b,c")
+	}
 
-	id := minPacketID
+	cli.lastAddress = "b"
 
-	for {
-		cli.sess.sendingPackets[id] = nil
+	if got := strings.Join(cli.addresses(opts), ","); got != "b,c,a" {
+		t.Errorf("cli.addresses(opts) => %q, want => %q", got, "b,c,a")
+	}
 
-		if id == maxPacketID {
-			break
-		}
+	opts.RandomizeAddresses = true
 
-		id++
+	if got := cli.addresses(opts); len(got) != 3 || got[0] != "b" {
+		t.Errorf("cli.addresses(opts) => %q, want => the addresses starting with %q", got, "b")
 	}
 
-	err := cli.Unsubscribe(&UnsubscribeOptions{
-		TopicFilters: [][]byte{
-			[]byte{0x00},
-		},
-	})
+	if got := strings.Join(opts.Addresses, ","); got != "a,b,c" {
+		t.Errorf("opts.Addresses => %q, want => %q", got, "a,b,c")
+	}
 
-	if err != ErrPacketIDExhaused {
-		invalidError(t, err, ErrPacketIDExhaused)
+	if got := strings.Join(cli.addresses(&ConnectOptions{Address: "d"}), ","); got != "d" {
+		t.Errorf("cli.addresses(opts) => %q, want => %q", got, "d")
 	}
 }
 
-func TestClient_Unsubscribe_NewUNSUBSCRIBEErr(t *testing.T) {
+func TestClient_Connect_OnConnect(t *testing.T) {
+	ln := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x01, 0x00})
+	defer ln.Close()
+
+	connectc := make(chan bool, 1)
+	disconnectc := make(chan struct{}, 1)
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		OnConnect: func(sessionPresent bool) {
+			connectc <- sessionPresent
+		},
+		OnConnectionLost: func(err error) {
+			t.Errorf("OnConnectionLost should not be called: %v", err)
+		},
+		OnDisconnect: func() {
+			disconnectc <- struct{}{}
+		},
 	})
 
-	cli.conn = &connection{}
-
-	cli.sess = newSession(false, []byte("clientID"))
+	defer cli.Terminate()
 
-	err := cli.Unsubscribe(&UnsubscribeOptions{
-		TopicFilters: [][]byte{
-			make([]byte, 0),
-		},
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
 	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-	if err != packet.ErrNoTopicFilter {
-		invalidError(t, err, packet.ErrNoTopicFilter)
+	if sessionPresent := <-connectc; !sessionPresent {
+		t.Error("sessionPresent => false, want => true")
+	}
+
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	select {
+	case <-disconnectc:
+	default:
+		t.Error("OnDisconnect should be called")
 	}
 }
 
-func TestClient_Unsubscribe(t *testing.T) {
+func TestClient_Connect_OnConnectErr(t *testing.T) {
+	ln := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x00, 0x05})
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		OnConnect: func(_ bool) {
+			t.Error("OnConnect should not be called")
+		},
 	})
 
-	cli.conn = &connection{}
-
-	cli.sess = newSession(false, []byte("clientID"))
+	defer cli.Terminate()
 
-	cli.conn.send = make(chan packet.Packet, 1)
-
-	err := cli.Unsubscribe(&UnsubscribeOptions{
-		TopicFilters: [][]byte{
-			[]byte{0x00},
-		},
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
 	})
+	if err != ErrNotAuthorized {
+		invalidError(t, err, ErrNotAuthorized)
+	}
+}
 
+func TestClient_OnConnectionLost(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
-		nilErrorExpected(t, err)
+		t.Fatal(err)
 	}
-}
 
-func TestClient_Terminate(t *testing.T) {
-	cli := &Client{}
+	defer ln.Close()
 
-	cli.disconnEndc = make(chan struct{}, 1)
+	// Close the Network Connection after sending the CONNACK Packet.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
 
-	cli.Terminate()
-}
+		conn.Write(testCONNACK)
+
+		readTestPacket(bufio.NewReader(conn))
+
+		conn.Close()
+	}()
+
+	lostc := make(chan error, 1)
 
-func TestClient_send_connNil(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		OnConnectionLost: func(err error) {
+			lostc <- err
+		},
+		OnDisconnect: func() {
+			t.Error("OnDisconnect should not be called")
+		},
 	})
 
-	if err := cli.send(nil); err != ErrNotYetConnected {
-		invalidError(t, err, ErrNotYetConnected)
-	}
-}
+	defer cli.Terminate()
 
-func TestClient_sendCONNECT_optsNil(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
+	err = cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
 	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-	if err := cli.sendCONNECT(nil); err != packet.ErrInvalidClientIDCleanSession {
-		invalidError(t, err, packet.ErrInvalidClientIDCleanSession)
+	if err := <-lostc; err == nil {
+		notNilErrorExpected(t)
 	}
-}
 
-func TestClient_receive_connNil(t *testing.T) {
+	if cli.conn != nil {
+		t.Error("the Network Connection should be cleaned")
+	}
+}
+
+func TestClient_OnConnectionLost_closeErr(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
+	lostc := make(chan error, 1)
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		OnConnectionLost: func(err error) {
+			lostc <- err
+		},
 	})
 
-	if _, err := cli.receive(); err != ErrNotYetConnected {
-		invalidError(t, err, ErrNotYetConnected)
-	}
-}
+	defer cli.Terminate()
 
-func TestClient_receive_ReadByteErr(t *testing.T) {
-	ln, err := net.Listen("tcp", ":1883")
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	c := make(chan struct{})
+	// Close the Network Connection beforehand so that
+	// closing it in the disconnection returns an error.
+	cli.muConn.RLock()
+	cli.conn.Conn.Close()
+	cli.muConn.RUnlock()
 
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				return
-			}
-			<-c
-			conn.Write([]byte{packet.TypePUBACK << 4})
-			conn.Close()
+	select {
+	case err := <-lostc:
+		if err == nil {
+			notNilErrorExpected(t)
 		}
-	}()
+	case <-time.After(5 * time.Second):
+		t.Error("OnConnectionLost should be called")
+		return
+	}
+
+	cli.muConn.RLock()
+	defer cli.muConn.RUnlock()
+
+	if cli.conn != nil {
+		t.Error("the Network Connection should be cleaned")
+	}
+}
+
+type testLogger struct {
+	mu       sync.Mutex
+	messages []string
+	packets  []string
+}
+
+func (l *testLogger) Log(level LogLevel, msg string) {
+	l.mu.Lock()
+	l.messages = append(l.messages, level.String()+" "+msg)
+	l.mu.Unlock()
+}
+
+func (l *testLogger) TracePacket(s *PacketSummary) {
+	l.mu.Lock()
+	l.packets = append(l.packets, s.String())
+	l.mu.Unlock()
+}
+
+func TestClient_Logger(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
+	l := &testLogger{}
 
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		Logger:       l,
 	})
 
-	err = cli.Connect(&ConnectOptions{
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  "localhost:1883",
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
@@ -482,45 +637,48 @@ func TestClient_receive_ReadByteErr(t *testing.T) {
 		return
 	}
 
-	defer cli.Disconnect()
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-	c <- struct{}{}
+	wantMessages := []string{
+		"INFO connected to " + ln.Addr().String() + " (session present: false)",
+		"INFO disconnected",
+	}
 
-	cli.conn.wg.Wait()
+	if !reflect.DeepEqual(l.messages, wantMessages) {
+		t.Errorf("messages => %q, want => %q", l.messages, wantMessages)
+	}
 
-	if err := ln.Close(); err != nil {
-		nilErrorExpected(t, err)
+	wantPackets := []string{
+		"send CONNECT size=22",
+		"receive CONNACK sessionPresent=false size=4",
+		"send DISCONNECT size=2",
 	}
-}
 
-func TestClient_receive_ReadFullErr(t *testing.T) {
-	ln, err := net.Listen("tcp", ":1884")
-	if err != nil {
-		nilErrorExpected(t, err)
-		return
+	if !reflect.DeepEqual(l.packets, wantPackets) {
+		t.Errorf("packets => %q, want => %q", l.packets, wantPackets)
 	}
+}
 
-	c := make(chan struct{})
+func TestClient_Logger_LogLevel(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
 
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				return
-			}
-			<-c
-			conn.Write([]byte{packet.TypePUBACK << 4, 0x80, 0x01})
-			conn.Close()
-		}
-	}()
+	l := &testLogger{}
 
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		Logger:       l,
+		LogLevel:     LogLevelWarn,
 	})
 
-	err = cli.Connect(&ConnectOptions{
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  "localhost:1884",
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
@@ -528,374 +686,644 @@ func TestClient_receive_ReadFullErr(t *testing.T) {
 		return
 	}
 
-	defer cli.Disconnect()
-
-	c <- struct{}{}
-
-	cli.conn.wg.Wait()
-
-	if err := ln.Close(); err != nil {
+	if err := cli.Disconnect(); err != nil {
 		nilErrorExpected(t, err)
+		return
+	}
+
+	if len(l.messages) != 0 || len(l.packets) != 0 {
+		t.Errorf("messages => %q, packets => %q, want => none", l.messages, l.packets)
 	}
 }
 
-func TestClient_clean_cleanSess(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+func TestClient_Connect_Dialer(t *testing.T) {
+	client, server := net.Pipe()
+
+	// Receive the CONNECT Packet before sending the CONNACK
+	// Packet because the pipe has no buffer.
+	go func() {
+		r := bufio.NewReader(server)
 
-	cli.sess = newSession(true, []byte("clientID"))
+		readTestPacket(r)
 
-	cli.clean()
-}
+		server.Write(testCONNACK)
+		io.Copy(ioutil.Discard, r)
+		server.Close()
+	}()
 
-func TestClient_waitPacket_timeout(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
+		Network:  "pipe",
+		Address:  "broker",
 		ClientID: []byte("clientID"),
+		Dialer: func(_ context.Context, network, address string) (net.Conn, error) {
+			if network != "pipe" || address != "broker" {
+				t.Errorf("network, address => %q, %q, want => %q, %q", network, address, "pipe", "broker")
+			}
+
+			return client, nil
+		},
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
 
-	cli.conn.wg.Add(1)
+func TestClient_Disconnect_reconnecting(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+		Reconnect:    &ReconnectOptions{},
+	})
 
-	cli.waitPacket(nil, 1, errTest)
+	cli.reconnecting = true
+
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	select {
+	case <-cli.reconnEndc:
+	default:
+		t.Error("the signal to stop the reconnection was not sent")
+	}
 }
 
-func TestClient_receivePackets_handlePacketErr(t *testing.T) {
-	ln, err := net.Listen("tcp", ":1883")
+func TestClient_reconnect_resubscribe(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	c := make(chan struct{})
+	defer ln.Close()
+
+	// topicFilters receives the Topic Filters of the SUBSCRIBE Packets.
+	topicFilters := make(chan string, 2)
 
 	go func() {
-		for {
+		for i := 0; i < 2; i++ {
 			conn, err := ln.Accept()
 			if err != nil {
 				return
 			}
-			<-c
-			if _, err := conn.Write([]byte{packet.TypePUBACK << 4, 0x02, 0x00, 0x01}); err != nil {
+
+			r := bufio.NewReader(conn)
+
+			// Receive the CONNECT Packet.
+			if _, _, err := readTestPacket(r); err != nil {
+				return
+			}
+
+			conn.Write(testCONNACK)
+
+			// Receive the SUBSCRIBE Packet.
+			b, remaining, err := readTestPacket(r)
+			if err != nil || b>>4 != packet.TypeSUBSCRIBE {
 				return
 			}
+
+			topicFilters <- string(remaining[4 : 4+int(remaining[3])])
+
+			conn.Write([]byte{packet.TypeSUBACK << 4, 0x03, remaining[0], remaining[1], mqtt.QoS1})
+
+			if i == 0 {
+				// Drop the first Network Connection.
+				conn.Close()
+			} else {
+				defer conn.Close()
+				io.Copy(ioutil.Discard, conn)
+			}
 		}
 	}()
 
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		Reconnect: &ReconnectOptions{
+			InitialInterval: 10 * time.Millisecond,
+		},
 	})
 
+	defer cli.Terminate()
+
 	err = cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  "localhost:1883",
-		ClientID: []byte("clientID"),
+		Network:      "tcp",
+		Address:      ln.Addr().String(),
+		ClientID:     []byte("clientID"),
+		CleanSession: true,
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	defer cli.Disconnect()
-
-	c <- struct{}{}
+	err = cli.Subscribe(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("a/b"),
+				QoS:         mqtt.QoS1,
+			},
+		},
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-	cli.conn.wg.Wait()
+	for i := 0; i < 2; i++ {
+		select {
+		case topicFilter := <-topicFilters:
+			if topicFilter != "a/b" {
+				t.Errorf("topicFilter => %q, want => %q", topicFilter, "a/b")
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("the SUBSCRIBE Packet was not received")
+			return
+		}
+	}
 
-	if err := ln.Close(); err != nil {
+	if err := cli.Disconnect(); err != nil {
 		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_handlePacket_TypeErr(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+func TestClient_reconnect_resubscribeSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-	p := &packetErr{}
+	defer ln.Close()
 
-	if err := cli.handlePacket(p); err != errTest {
-		invalidError(t, err, errTest)
-	}
-}
+	// subscribes receives the signal of the SUBSCRIBE Packets
+	// sent over the second and later Network Connections.
+	subscribes := make(chan struct{}, 128)
+
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			if i > 0 {
+				go serveTestBroker(conn, func(b byte, _ []byte) {
+					if b>>4 != packet.TypeSUBSCRIBE {
+						return
+					}
+
+					select {
+					case subscribes <- struct{}{}:
+					default:
+					}
+				})
+
+				continue
+			}
+
+			r := bufio.NewReader(conn)
+
+			// Receive the CONNECT Packet.
+			if _, _, err := readTestPacket(r); err != nil {
+				return
+			}
+
+			conn.Write(testCONNACK)
+
+			// Receive the SUBSCRIBE Packet.
+			b, remaining, err := readTestPacket(r)
+			if err != nil || b>>4 != packet.TypeSUBSCRIBE {
+				return
+			}
+
+			conn.Write([]byte{packet.TypeSUBACK << 4, 0x03, remaining[0], remaining[1], mqtt.QoS1})
+
+			// Drop the first Network Connection.
+			conn.Close()
+		}
+	}()
 
-func TestClient_handlePacket_PUBLISH(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		Reconnect: &ReconnectOptions{
+			InitialInterval: 10 * time.Millisecond,
+		},
 	})
 
-	err := cli.Connect(&ConnectOptions{
+	defer cli.Terminate()
+
+	err = cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
-
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
+	err = cli.Subscribe(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("a/b"),
+				QoS:         mqtt.QoS1,
+			},
+		},
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	cli.handlePacket(p)
-}
+	select {
+	case <-subscribes:
+	case <-time.After(5 * time.Second):
+		t.Error("the SUBSCRIBE Packet was not resent")
+		return
+	}
 
-func TestClient_handlePacket_PUBACK(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+	// The SUBACK Packet of the resent SUBSCRIBE Packet is accepted
+	// and the Client keeps the Network Connection.
+	time.Sleep(200 * time.Millisecond)
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if n := len(subscribes); n != 0 {
+		t.Errorf("the SUBSCRIBE Packet was resent %d more times", n)
 	}
 
-	defer cli.Disconnect()
+	cli.muConn.RLock()
 
-	p, err := packet.NewPUBACK(&packet.PUBACKOptions{
-		PacketID: 1,
-	})
+	if cli.conn == nil {
+		t.Error("the Client is not connected")
+	} else if _, ok := cli.conn.ackedSubs["a/b"]; !ok {
+		t.Error("the resent subscription was not acknowledged")
+	}
 
-	cli.handlePacket(p)
-}
+	cli.muConn.RUnlock()
 
-func TestClient_handlePacket_PUBREC(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
+func TestClient_reconnect_ErrReconnectFailed(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
-
-	p, err := packet.NewPUBREC(&packet.PUBRECOptions{
-		PacketID: 1,
-	})
+	// closec handles the signal to lose the Network Connection.
+	closec := make(chan struct{})
 
-	cli.handlePacket(p)
-}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		conn.Write(testCONNACK)
+
+		<-closec
+
+		// Lose the Network Connection and stop the Server.
+		ln.Close()
+		conn.Close()
+	}()
+
+	errc := make(chan error, 10)
 
-func TestClient_handlePacket_PUBREL(t *testing.T) {
 	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
+		ErrorHandler: func(err error) {
+			errc <- err
+		},
+		Reconnect: &ReconnectOptions{
+			InitialInterval: 10 * time.Millisecond,
+			MaxRetries:      2,
+		},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
+	defer cli.Terminate()
+
+	err = cli.Connect(&ConnectOptions{
+		Network:      "tcp",
+		Address:      ln.Addr().String(),
+		ClientID:     []byte("clientID"),
+		CleanSession: true,
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
+	close(closec)
 
-	p, err := packet.NewPUBREL(&packet.PUBRELOptions{
-		PacketID: 1,
+	for {
+		select {
+		case err := <-errc:
+			if err == ErrReconnectFailed {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("ErrReconnectFailed was not handled")
+			return
+		}
+	}
+}
+
+func TestClient_ConnectContext_DeadlineExceeded(t *testing.T) {
+	ln := newTestServer(t, nil)
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
 	})
 
-	cli.handlePacket(p)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := cli.ConnectContext(ctx, &ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
+	}
+
+	if cli.conn != nil {
+		t.Error("cli.conn => not nil, want => nil")
+	}
 }
 
-func TestClient_handlePacket_PUBCOMP(t *testing.T) {
+func TestClient_ConnectContext(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := cli.ConnectContext(ctx, &ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p, err := packet.NewPUBCOMP(&packet.PUBCOMPOptions{
-		PacketID: 1,
-	})
+	// The Network Connection must outlive the context.
+	cancel()
 
-	cli.handlePacket(p)
+	if err := cli.PublishContext(context.Background(), &PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a"),
+	}); err != nil {
+		nilErrorExpected(t, err)
+	}
 }
 
-func TestClient_handlePacket_SUBACK(t *testing.T) {
+func TestClient_PublishContext(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p, err := packet.NewSUBACKFromBytes([]byte{packet.TypeSUBACK << 4, 0x03}, []byte{0x00, 0x01, 0x00})
-	if err != nil {
-		nilErrorExpected(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, qos := range []byte{mqtt.QoS0, mqtt.QoS1, mqtt.QoS2} {
+		err := cli.PublishContext(ctx, &PublishOptions{
+			QoS:       qos,
+			TopicName: []byte("a/b"),
+			Message:   []byte("message"),
+		})
+		if err != nil {
+			nilErrorExpected(t, err)
+		}
 	}
 
-	cli.handlePacket(p)
+	cli.muSess.RLock()
+	n := len(cli.sess.sendingPackets)
+	cli.muSess.RUnlock()
+
+	if n != 0 {
+		t.Errorf("len(cli.sess.sendingPackets) => %d, want => 0", n)
+	}
 }
 
-func TestClient_handlePacket_UNSUBACK(t *testing.T) {
+func TestClient_PublishContext_enqueueDeadlineExceeded(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
+	cli.conn = &connection{}
+
+	cli.conn.tokens = make(map[uint16]*Token)
+
+	cli.conn.send = make(chan packet.Packet)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := cli.PublishContext(ctx, &PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
 	}
 
-	defer cli.Disconnect()
-
-	p, err := packet.NewUNSUBACKFromBytes([]byte{packet.TypeUNSUBACK << 4, 0x02}, []byte{0x00, 0x01})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if n := len(cli.sess.sendingPackets); n != 0 {
+		t.Errorf("len(cli.sess.sendingPackets) => %d, want => 0", n)
 	}
 
-	cli.handlePacket(p)
+	if n := len(cli.conn.tokens); n != 0 {
+		t.Errorf("len(cli.conn.tokens) => %d, want => 0", n)
+	}
 }
 
-func TestClient_handlePacket_ErrInvalidPacketType(t *testing.T) {
+func TestClient_PublishContext_ErrDisconnected(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
+	errc := make(chan error, 1)
 
-	p, err := packet.NewCONNECT(&packet.CONNECTOptions{
-		ClientID: []byte("cliendID"),
-	})
-	if err != nil {
+	go func() {
+		errc <- cli.PublishContext(context.Background(), &PublishOptions{
+			QoS:       mqtt.QoS1,
+			TopicName: []byte("a/b"),
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := cli.Disconnect(); err != nil {
 		nilErrorExpected(t, err)
 	}
 
-	cli.handlePacket(p)
+	if err := <-errc; err != ErrDisconnected {
+		invalidError(t, err, ErrDisconnected)
+	}
 }
 
-func TestClient_handleCONNACK_default(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
-
-	cli.conn = &connection{}
-
-	cli.conn.connack = make(chan struct{})
+func TestClient_SubscribeContext_UnsubscribeContext(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
 
-	cli.handleCONNACK()
-}
-
-func TestClient_handlePUBLISH_QoS0(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = cli.SubscribeContext(ctx, &SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("a/#"),
+				QoS:         mqtt.QoS1,
+			},
+		},
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	if err = cli.handlePUBLISH(p); err != nil {
+	cli.muConn.RLock()
+	_, exist := cli.conn.ackedSubs["a/#"]
+	cli.muConn.RUnlock()
+
+	if !exist {
+		t.Error("the subscription was not acknowledged")
+	}
+
+	err = cli.UnsubscribeContext(ctx, &UnsubscribeOptions{
+		TopicFilters: [][]byte{
+			[]byte("a/#"),
+		},
+	})
+	if err != nil {
 		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_handlePUBLISH_QoS1_Err(t *testing.T) {
+func TestClient_SubscribeContext_refused(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		QoS:      mqtt.QoS1,
-		PacketID: 1,
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = cli.SubscribeContext(ctx, &SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("a/#"),
+				QoS:         mqtt.QoS1,
+			},
+			&SubReq{
+				TopicFilter: []byte("refused/a"),
+				QoS:         mqtt.QoS1,
+			},
+		},
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
-		return
+	if e, ok := err.(*SubRefusedError); !ok || string(e.TopicFilter) != "refused/a" {
+		t.Errorf("err => %v, want => SubRefusedError for \"refused/a\"", err)
 	}
 
-	p.(*packet.PUBLISH).PacketID = 0
+	cli.muConn.RLock()
+	_, exist := cli.conn.ackedSubs["a/#"]
+	cli.muConn.RUnlock()
 
-	if err = cli.handlePUBLISH(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if !exist {
+		t.Error("the accepted subscription was not acknowledged")
 	}
 }
 
-func TestClient_handlePUBLISH_QoS1(t *testing.T) {
+func TestClient_Disconnect_sendEndDefault(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
@@ -909,1086 +1337,2953 @@ func TestClient_handlePUBLISH_QoS1(t *testing.T) {
 		nilErrorExpected(t, err)
 	}
 
-	defer cli.Disconnect()
+	cli.conn.sendEnd <- struct{}{}
 
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		QoS:      mqtt.QoS1,
-		PacketID: 1,
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-		return
-	}
+	time.Sleep(3 * time.Second)
 
-	if err = cli.handlePUBLISH(p); err != nil {
+	cli.conn.sendEnd <- struct{}{}
+
+	if err := cli.Disconnect(); err != nil {
 		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_handlePUBLISH_QoS2_ErrInvalidPacketID(t *testing.T) {
+func TestClient_PublishAsync(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		QoS:      mqtt.QoS2,
-		PacketID: 1,
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-		return
+	for _, qos := range []byte{mqtt.QoS0, mqtt.QoS1, mqtt.QoS2} {
+		token, err := cli.PublishAsync(&PublishOptions{
+			QoS:       qos,
+			TopicName: []byte("a/b"),
+			Message:   []byte("message"),
+		})
+		if err != nil {
+			nilErrorExpected(t, err)
+			continue
+		}
+
+		if err := token.WaitTimeout(5 * time.Second); err != nil {
+			nilErrorExpected(t, err)
+		}
+
+		select {
+		case <-token.Done():
+		default:
+			t.Error("token.Done() should be closed")
+		}
 	}
 
-	cli.sess.receivingPackets[1] = p
+	cli.muSess.RLock()
+	n := len(cli.sess.sendingPackets)
+	cli.muSess.RUnlock()
 
-	if err = cli.handlePUBLISH(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if n != 0 {
+		t.Errorf("len(cli.sess.sendingPackets) => %d, want => 0", n)
 	}
 }
 
-func TestClient_handlePUBLISH_QoS2_NewPUBRECErr(t *testing.T) {
+func TestClient_PublishAsync_connNil(t *testing.T) {
+	cli := New(nil)
+
+	if _, err := cli.PublishAsync(nil); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
+	}
+}
+
+func TestClient_PublishAsync_ErrDisconnected(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
-
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		QoS:      mqtt.QoS2,
-		PacketID: 1,
+	token, err := cli.PublishAsync(&PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	p.(*packet.PUBLISH).PacketID = 0
+	if err := token.WaitTimeout(100 * time.Millisecond); err != ErrTokenTimeout {
+		invalidError(t, err, ErrTokenTimeout)
+	}
 
-	if err = cli.handlePUBLISH(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := token.Wait(); err != ErrDisconnected {
+		invalidError(t, err, ErrDisconnected)
 	}
 }
 
-func TestClient_handlePUBLISH_QoS2(t *testing.T) {
+func TestClient_SubscribeAsync(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
+	errc := make(chan error, 1)
+
 	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
+		ErrorHandler: func(err error) {
+			errc <- err
+		},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		QoS:      mqtt.QoS2,
-		PacketID: 1,
+	token, err := cli.SubscribeAsync(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("a/b"),
+				QoS:         mqtt.QoS2,
+			},
+			&SubReq{
+				TopicFilter: []byte("refused/a"),
+				QoS:         mqtt.QoS1,
+			},
+			&SubReq{
+				TopicFilter: []byte("limited/a"),
+				QoS:         mqtt.QoS2,
+			},
+		},
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	if err = cli.handlePUBLISH(p); err != nil {
+	if err := token.WaitTimeout(5 * time.Second); err != nil {
 		nilErrorExpected(t, err)
+		return
+	}
+
+	want := []*SubResult{
+		&SubResult{TopicFilter: []byte("a/b"), RequestedQoS: mqtt.QoS2, GrantedQoS: mqtt.QoS2},
+		&SubResult{TopicFilter: []byte("refused/a"), RequestedQoS: mqtt.QoS1, Refused: true},
+		&SubResult{TopicFilter: []byte("limited/a"), RequestedQoS: mqtt.QoS2, GrantedQoS: mqtt.QoS1},
+	}
+
+	if got := token.Results(); !reflect.DeepEqual(got, want) {
+		t.Errorf("token.Results() => %+v, want => %+v", got, want)
+	}
+
+	select {
+	case err := <-errc:
+		if e, ok := err.(*SubRefusedError); !ok || string(e.TopicFilter) != "refused/a" {
+			t.Errorf("err => %v, want => SubRefusedError for \"refused/a\"", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the refusal was not notified to the error handler")
+	}
+
+	cli.muConn.RLock()
+	_, acked := cli.conn.ackedSubs["refused/a"]
+	_, unacked := cli.conn.unackSubs["refused/a"]
+	cli.muConn.RUnlock()
+
+	if acked || unacked {
+		t.Error("the refused subscription should be discarded")
 	}
 }
 
-func TestClient_handlePUBACK_validatePacketIDErr(t *testing.T) {
+func TestClient_SubscribeAsync_connNil(t *testing.T) {
+	cli := New(nil)
+
+	if _, err := cli.SubscribeAsync(nil); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
+	}
+}
+
+func TestClient_UnsubscribeAsync(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p := &packet.PUBACK{
-		PacketID: 1,
-	}
+	token, err := cli.UnsubscribeAsync(&UnsubscribeOptions{
+		TopicFilters: [][]byte{[]byte("a/b")},
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
 
-	if err := cli.handlePUBACK(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if err := token.WaitTimeout(5 * time.Second); err != nil {
+		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_handlePUBACK(t *testing.T) {
+func TestClient_Store_restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
+	store := newTestFileStore(t, path)
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		Store:        store,
 	})
 
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	defer cli.Disconnect()
-
-	p := &packet.PUBACK{
-		PacketID: 1,
-	}
-
-	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
-	})
-	if err != nil {
+	if err := cli.Publish(&PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
+		Message:   []byte("message"),
+	}); err != nil {
 		nilErrorExpected(t, err)
-		return
 	}
 
-	cli.sess.sendingPackets[1] = publish
+	cli.Disconnect()
+	cli.Terminate()
+	store.Close()
 
-	if err := cli.handlePUBACK(p); err != nil {
+	// Restart the Client with the FileStore.
+	broker := newTestBroker(t)
+	defer broker.Close()
+
+	store = newTestFileStore(t, path)
+	defer store.Close()
+
+	if _, err := store.Get(DirectionSending, 1); err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
-}
 
-func TestClient_handlePUBREC_validatePacketIDErr(t *testing.T) {
-	cli := New(&Options{
+	cli = New(&Options{
 		ErrorHandler: func(_ error) {},
+		Store:        store,
 	})
 
-	err := cli.Connect(&ConnectOptions{
+	defer cli.Terminate()
+
+	err = cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  broker.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p := &packet.PUBREC{
-		PacketID: 1,
-	}
+	// Wait for the PUBACK Packet of the resent PUBLISH Packet.
+	for i := 0; i < 100; i++ {
+		if _, err := store.Get(DirectionSending, 1); err == ErrPacketNotStored {
+			return
+		}
 
-	if err := cli.handlePUBREC(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+		time.Sleep(50 * time.Millisecond)
 	}
+
+	t.Error("the resent PUBLISH Packet was not acknowledged")
 }
 
-func TestClient_handlePUBREC_NewPUBRELErr(t *testing.T) {
+func TestClient_Store_cleanSession(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
+	store := NewMemoryStore()
+
+	store.Put(DirectionSending, 1, newTestPUBREL(t, 1))
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		Store:        store,
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
-
-	defer cli.Disconnect()
-
-	p := &packet.PUBREC{
-		PacketID: 0,
-	}
+	defer cli.Terminate()
 
-	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
+	err := cli.Connect(&ConnectOptions{
+		Network:      "tcp",
+		Address:      ln.Addr().String(),
+		ClientID:     []byte("clientID"),
+		CleanSession: true,
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	publish.(*packet.PUBLISH).PacketID = 0
-
-	cli.sess.sendingPackets[0] = publish
+	defer cli.Disconnect()
 
-	if err := cli.handlePUBREC(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if _, err := store.Get(DirectionSending, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
 	}
 }
 
-func TestClient_handlePUBREC(t *testing.T) {
+func TestClient_MaxInflight(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		MaxInflight:  2,
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p := &packet.PUBREC{
-		PacketID: 1,
+	opts := &PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
 	}
 
-	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-		return
+	for i := 0; i < 2; i++ {
+		if _, err := cli.PublishAsync(opts); err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
 	}
 
-	cli.sess.sendingPackets[1] = publish
-
-	if err := cli.handlePUBREC(p); err != nil {
-		nilErrorExpected(t, err)
+	if n := cli.Inflight(); n != 2 {
+		t.Errorf("cli.Inflight() => %d, want => 2", n)
 	}
-}
 
-func TestClient_handlePUBREL_validatePacketIDErr(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+	if err := cli.Publish(opts); err != ErrMaxInflightExceeded {
+		invalidError(t, err, ErrMaxInflightExceeded)
+	}
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
+	// QoS 0 is not limited.
+	if err := cli.Publish(&PublishOptions{TopicName: []byte("a/b")}); err != nil {
 		nilErrorExpected(t, err)
 	}
 
-	defer cli.Disconnect()
-
-	p := &packet.PUBREL{
-		PacketID: 1,
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
 
-	if err := cli.handlePUBREL(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if err := cli.PublishContext(ctx, opts); err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
 	}
 }
 
-func TestClient_handlePUBREL_NewPUBCOMPErr(t *testing.T) {
+func TestClient_MaxInflight_wait(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
+		MaxInflight:  1,
 	})
 
+	defer cli.Terminate()
+
 	err := cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  ln.Addr().String(),
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
 	defer cli.Disconnect()
 
-	p := &packet.PUBREL{
-		PacketID: 0,
+	opts := &PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
 	}
 
-	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
-	})
-	if err != nil {
+	if _, err := cli.PublishAsync(opts); err != nil {
 		nilErrorExpected(t, err)
 		return
 	}
 
-	publish.(*packet.PUBLISH).PacketID = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	cli.sess.receivingPackets[0] = publish
+	errc := make(chan error, 1)
 
-	if err := cli.handlePUBREL(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
-	}
-}
+	go func() {
+		errc <- cli.PublishContext(ctx, opts)
+	}()
 
-func TestClient_handlePUBREL(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+	time.Sleep(50 * time.Millisecond)
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if n := cli.Inflight(); n != 1 {
+		t.Errorf("cli.Inflight() => %d, want => 1", n)
 	}
 
-	defer cli.Disconnect()
+	// Acknowledge the PUBLISH Packets one by one. The released
+	// Packet Identifier is not reused right away.
+	for _, id := range []uint16{1, 2} {
+		for i := 0; i < 100; i++ {
+			cli.muSess.RLock()
+			_, exist := cli.sess.sendingPackets[id]
+			cli.muSess.RUnlock()
 
-	p := &packet.PUBREL{
-		PacketID: 1,
+			if exist {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		puback, err := packet.NewPUBACK(&packet.PUBACKOptions{
+			PacketID: id,
+		})
+		if err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+
+		if err := cli.handlePUBACK(puback); err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
 	}
 
-	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
-		PacketID: 1,
-	})
-	if err != nil {
+	if err := <-errc; err != nil {
 		nilErrorExpected(t, err)
-		return
 	}
 
-	cli.sess.receivingPackets[1] = publish
-
-	if err := cli.handlePUBREL(p); err != nil {
-		nilErrorExpected(t, err)
+	if n := cli.Inflight(); n != 0 {
+		t.Errorf("cli.Inflight() => %d, want => 0", n)
 	}
 }
 
-func TestClient_handlePUBCOMP_validatePacketIDErr(t *testing.T) {
-	cli := New(&Options{
-		ErrorHandler: func(_ error) {},
-	})
+func TestClient_QueueLen(t *testing.T) {
+	cli := New(nil)
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if n := cli.QueueLen(); n != 0 {
+		t.Errorf("cli.QueueLen() => %d, want => 0", n)
 	}
 
-	defer cli.Disconnect()
+	cli.conn = &connection{
+		send: make(chan packet.Packet, 2),
+	}
 
-	p := &packet.PUBCOMP{
-		PacketID: 1,
+	cli.conn.send <- &packet.PUBACK{}
+
+	if n := cli.QueueLen(); n != 1 {
+		t.Errorf("cli.QueueLen() => %d, want => 1", n)
 	}
+}
 
-	if err := cli.handlePUBCOMP(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+func TestClient_Inflight_sessNil(t *testing.T) {
+	cli := New(nil)
+
+	if n := cli.Inflight(); n != 0 {
+		t.Errorf("cli.Inflight() => %d, want => 0", n)
 	}
 }
 
-func TestClient_handlePUBCOMP(t *testing.T) {
+func TestClient_Publish_connNil(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if err := cli.Publish(nil); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
 	}
+}
 
-	defer cli.Disconnect()
+func TestClient_Publish_newPUBLISHPacketErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	p := &packet.PUBCOMP{
-		PacketID: 1,
-	}
+	cli.conn = &connection{}
 
-	pubrel, err := packet.NewPUBREL(&packet.PUBRELOptions{
-		PacketID: 1,
+	cli.sess = newSession(false, []byte("cliendID"), nil)
+
+	err := cli.Publish(&PublishOptions{
+		QoS: 0x03,
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
-		return
+
+	if err != packet.ErrInvalidQoS {
+		invalidError(t, err, packet.ErrInvalidQoS)
 	}
+}
 
-	cli.sess.sendingPackets[1] = pubrel
+func TestClient_Publish(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	if err := cli.handlePUBCOMP(p); err != nil {
+	cli.conn = &connection{}
+
+	cli.conn.send = make(chan packet.Packet, 1)
+
+	if err := cli.Publish(nil); err != nil {
 		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_handleSUBACK_validatePacketIDErr(t *testing.T) {
+func TestClient_Subscribe_connNil(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	if err := cli.Subscribe(nil); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
 	}
+}
 
-	defer cli.Disconnect()
+func TestClient_Subscribe_ErrInvalidNoSubReq(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	p := &packet.SUBACK{
-		PacketID:    1,
-		ReturnCodes: []byte{mqtt.QoS0},
-	}
+	cli.conn = &connection{}
 
-	if err := cli.handleSUBACK(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if err := cli.Subscribe(nil); err != packet.ErrInvalidNoSubReq {
+		invalidError(t, err, packet.ErrInvalidNoSubReq)
 	}
 }
 
-func TestClient_handleSUBACK_ErrInvalidSUBACK(t *testing.T) {
+func TestClient_Subscribe_generatePacketIDErr(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
+	cli.conn = &connection{}
 
-	defer cli.Disconnect()
+	cli.sess = newSession(false, []byte("clientID"), nil)
 
-	p := &packet.SUBACK{
-		PacketID:    1,
-		ReturnCodes: []byte{mqtt.QoS0},
+	id := minPacketID
+
+	for {
+		cli.sess.sendingPackets[id] = nil
+
+		if id == maxPacketID {
+			break
+		}
+
+		id++
 	}
 
-	subscribe, err := packet.NewSUBSCRIBE(&packet.SUBSCRIBEOptions{
-		PacketID: 1,
-		SubReqs: []*packet.SubReq{
-			&packet.SubReq{
-				TopicFilter: []byte("test"),
-				QoS:         mqtt.QoS0,
-			},
-			&packet.SubReq{
-				TopicFilter: []byte("test2"),
-				QoS:         mqtt.QoS0,
-			},
+	err := cli.Subscribe(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{},
 		},
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
-
-	cli.sess.sendingPackets[1] = subscribe
 
-	if err := cli.handleSUBACK(p); err != ErrInvalidSUBACK {
-		invalidError(t, err, ErrInvalidSUBACK)
+	if err != ErrPacketIDExhaused {
+		invalidError(t, err, ErrPacketIDExhaused)
 	}
 }
 
-func TestClient_handleSUBACK(t *testing.T) {
+func TestClient_Subscribe_NewSUBSCRIBEErr(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
-
-	defer cli.Disconnect()
+	cli.conn = &connection{}
 
-	p := &packet.SUBACK{
-		PacketID:    1,
-		ReturnCodes: []byte{packet.SUBACKRetFailure, mqtt.QoS0},
-	}
+	cli.sess = newSession(false, []byte("clientID"), nil)
 
-	subscribe, err := packet.NewSUBSCRIBE(&packet.SUBSCRIBEOptions{
-		PacketID: 1,
-		SubReqs: []*packet.SubReq{
-			&packet.SubReq{
-				TopicFilter: []byte("test"),
-				QoS:         mqtt.QoS0,
-			},
-			&packet.SubReq{
-				TopicFilter: []byte("test2"),
-				QoS:         mqtt.QoS0,
-			},
+	err := cli.Subscribe(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{},
 		},
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
-
-	cli.sess.sendingPackets[1] = subscribe
 
-	if err := cli.handleSUBACK(p); err != nil {
-		nilErrorExpected(t, err)
+	if err != packet.ErrNoTopicFilter {
+		invalidError(t, err, packet.ErrNoTopicFilter)
 	}
 }
 
-func TestClient_handleUNSUBACK_validatePacketIDErr(t *testing.T) {
+func TestClient_Subscribe_ErrDisconnected(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
+	// Set the Network Connection which has stopped sending the Packets.
+	cli.conn = &connection{
+		send:      make(chan packet.Packet),
+		sendDone:  make(chan struct{}),
+		unackSubs: make(map[string]*SubReq),
+		tokens:    make(map[uint16]*Token),
+	}
+
+	close(cli.conn.sendDone)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	err := cli.Subscribe(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("topicFilter"),
+			},
+		},
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
+
+	if err != ErrDisconnected {
+		invalidError(t, err, ErrDisconnected)
 	}
 
-	defer cli.Disconnect()
+	// The Mutexes have been unlocked.
+	cli.muConn.Lock()
+	cli.muSess.Lock()
 
-	p := &packet.UNSUBACK{
-		PacketID: 1,
+	if n := len(cli.sess.sendingPackets); n != 0 {
+		t.Errorf("len(cli.sess.sendingPackets) => %d, want => %d", n, 0)
 	}
 
-	if err := cli.handleUNSUBACK(p); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	if n := len(cli.conn.unackSubs); n != 0 {
+		t.Errorf("len(cli.conn.unackSubs) => %d, want => %d", n, 0)
 	}
+
+	cli.muSess.Unlock()
+	cli.muConn.Unlock()
 }
 
-func TestClient_handleUNSUBACK(t *testing.T) {
+func TestClient_Subscribe(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
+	cli.conn = &connection{}
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	cli.conn.unackSubs = make(map[string]*SubReq)
+
+	cli.conn.tokens = make(map[uint16]*Token)
+
+	cli.conn.send = make(chan packet.Packet, 1)
+
+	err := cli.Subscribe(&SubscribeOptions{
+		SubReqs: []*SubReq{
+			&SubReq{
+				TopicFilter: []byte("topicFilter"),
+			},
+		},
 	})
+
 	if err != nil {
 		nilErrorExpected(t, err)
 	}
+}
 
-	defer cli.Disconnect()
+func TestClient_Unsubscribe_connNil(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	p := &packet.UNSUBACK{
-		PacketID: 1,
+	if err := cli.Unsubscribe(nil); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
 	}
+}
 
-	unsubscribe, err := packet.NewUNSUBSCRIBE(&packet.UNSUBSCRIBEOptions{
-		PacketID:     1,
-		TopicFilters: [][]byte{[]byte("test")},
+func TestClient_Unsubscribe_ErrNoTopicFilter(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
 	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
 
-	cli.sess.sendingPackets[1] = unsubscribe
+	cli.conn = &connection{}
 
-	if err := cli.handleUNSUBACK(p); err != nil {
-		nilErrorExpected(t, err)
+	if err := cli.Unsubscribe(nil); err != packet.ErrNoTopicFilter {
+		invalidError(t, err, packet.ErrNoTopicFilter)
 	}
 }
 
-func TestClient_handlePINGRESP_ErrInvalidPINGRESP(t *testing.T) {
+func TestClient_Unsubscribe_generatePacketIDErr(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
+	cli.conn = &connection{}
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	id := minPacketID
+
+	for {
+		cli.sess.sendingPackets[id] = nil
+
+		if id == maxPacketID {
+			break
+		}
+
+		id++
 	}
 
-	defer cli.Disconnect()
+	err := cli.Unsubscribe(&UnsubscribeOptions{
+		TopicFilters: [][]byte{
+			[]byte{0x00},
+		},
+	})
 
-	if err := cli.handlePINGRESP(); err != ErrInvalidPINGRESP {
-		invalidError(t, err, ErrInvalidPINGRESP)
+	if err != ErrPacketIDExhaused {
+		invalidError(t, err, ErrPacketIDExhaused)
 	}
 }
 
-func TestClient_handlePINGRESP_default(t *testing.T) {
+func TestClient_Unsubscribe_NewUNSUBSCRIBEErr(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
+	cli.conn = &connection{}
 
-	defer cli.Disconnect()
+	cli.sess = newSession(false, []byte("clientID"), nil)
 
-	cli.conn.pingresps = append(cli.conn.pingresps, make(chan struct{}))
+	err := cli.Unsubscribe(&UnsubscribeOptions{
+		TopicFilters: [][]byte{
+			make([]byte, 0),
+		},
+	})
 
-	if err := cli.handlePINGRESP(); err != nil {
-		nilErrorExpected(t, err)
+	if err != packet.ErrNoTopicFilter {
+		invalidError(t, err, packet.ErrNoTopicFilter)
 	}
 }
 
-func TestClient_handlePINGRESP(t *testing.T) {
+func TestClient_Unsubscribe(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
-	if err != nil {
-		nilErrorExpected(t, err)
-	}
-
-	defer cli.Disconnect()
+	cli.conn = &connection{}
 
-	cli.conn.pingresps = append(cli.conn.pingresps, make(chan struct{}, 1))
+	cli.sess = newSession(false, []byte("clientID"), nil)
 
-	if err := cli.handlePINGRESP(); err != nil {
-		nilErrorExpected(t, err)
-	}
-}
+	cli.conn.tokens = make(map[uint16]*Token)
 
-func TestClient_handleErrorAndDisconn_connNil(t *testing.T) {
-	cli := New(nil)
+	cli.conn.send = make(chan packet.Packet, 1)
 
-	cli.handleErrorAndDisconn(errTest)
-}
+	err := cli.Unsubscribe(&UnsubscribeOptions{
+		TopicFilters: [][]byte{
+			[]byte{0x00},
+		},
+	})
 
-func TestClient_handleErrorAndDisconn_default(t *testing.T) {
-	cli := &Client{
-		errorHandler: func(_ error) {},
+	if err != nil {
+		nilErrorExpected(t, err)
 	}
+}
 
-	cli.conn = &connection{}
+func TestClient_Terminate(t *testing.T) {
+	cli := &Client{}
 
-	cli.disconnc = make(chan struct{})
+	cli.disconnEndc = make(chan struct{}, 1)
 
-	cli.handleErrorAndDisconn(errTest)
+	cli.Terminate()
 }
 
-func TestClient_handleErrorAndDisconn(t *testing.T) {
+func TestClient_send_connNil(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	err := cli.Connect(&ConnectOptions{
-		Network:  "tcp",
-		Address:  testAddress,
-		ClientID: []byte("clientID"),
-	})
+	if err := cli.send(nil); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
+	}
+}
+
+func TestClient_sendCONNECT_optsNil(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	if err := cli.sendCONNECT(nil, nil); err != packet.ErrInvalidClientIDCleanSession {
+		invalidError(t, err, packet.ErrInvalidClientIDCleanSession)
+	}
+}
+
+func TestClient_receive_connNil(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	if _, err := cli.receive(); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
+	}
+}
+
+func TestClient_receive_ReadByteErr(t *testing.T) {
+	ln, err := net.Listen("tcp", ":1883")
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	cli.handleErrorAndDisconn(errTest)
+	c := make(chan struct{})
 
-	time.Sleep(1 * time.Second)
-}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(testCONNACK)
+			<-c
+			conn.Write([]byte{packet.TypePUBACK << 4})
+			conn.Close()
+		}
+	}()
 
-func TestClient_sendPackets_sendErr(t *testing.T) {
-	cli := New(nil)
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	err := cli.Connect(&ConnectOptions{
+	err = cli.Connect(&ConnectOptions{
 		Network:  "tcp",
-		Address:  testAddress,
+		Address:  "localhost:1883",
 		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	if err := cli.conn.Close(); err != nil {
-		nilErrorExpected(t, err)
-	}
+	defer cli.Disconnect()
 
-	cli.conn.send <- &packetErr{}
+	c <- struct{}{}
 
 	cli.conn.wg.Wait()
-}
-
-func TestClient_sendPackets_keepAliveErr(t *testing.T) {
-	cli := New(nil)
 
-	err := cli.Connect(&ConnectOptions{
-		Network:   "tcp",
-		Address:   testAddress,
-		ClientID:  []byte("clientID"),
-		KeepAlive: 2,
-	})
-	if err != nil {
+	if err := ln.Close(); err != nil {
 		nilErrorExpected(t, err)
 	}
+}
 
-	if err := cli.conn.Close(); err != nil {
+func TestClient_receive_ReadFullErr(t *testing.T) {
+	ln, err := net.Listen("tcp", ":1884")
+	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	cli.conn.wg.Wait()
-}
+	c := make(chan struct{})
 
-func TestClient_sendPackets_sendEnd(t *testing.T) {
-	cli := New(nil)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(testCONNACK)
+			<-c
+			conn.Write([]byte{packet.TypePUBACK << 4, 0x80, 0x01})
+			conn.Close()
+		}
+	}()
 
-	err := cli.Connect(&ConnectOptions{
-		Network:   "tcp",
-		Address:   testAddress,
-		ClientID:  []byte("clientID"),
-		KeepAlive: 3,
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err = cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  "localhost:1884",
+		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	time.Sleep(5 * time.Second)
-
-	cli.conn.muPINGRESPs.Lock()
-	cli.conn.pingresps = append(cli.conn.pingresps, make(chan struct{}))
-	cli.conn.muPINGRESPs.Unlock()
+	defer cli.Disconnect()
 
-	cli.conn.sendEnd <- struct{}{}
+	c <- struct{}{}
 
-	cli.muConn.Lock()
-	wg := &cli.conn.wg
-	cli.muConn.Unlock()
+	cli.conn.wg.Wait()
 
-	wg.Wait()
+	if err := ln.Close(); err != nil {
+		nilErrorExpected(t, err)
+	}
 }
 
-func TestClient_newPUBLISHPacket_generatePacketID(t *testing.T) {
-	cli := New(nil)
-
-	cli.sess = newSession(false, []byte("clientID"))
-
-	id := minPacketID
-
-	for {
-		cli.sess.sendingPackets[id] = nil
+func TestClient_clean_cleanSess(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-		if id == maxPacketID {
-			break
-		}
+	cli.sess = newSession(true, []byte("clientID"), nil)
 
-		id++
-	}
+	cli.clean()
+}
 
-	_, err := cli.newPUBLISHPacket(&PublishOptions{
-		QoS: mqtt.QoS1,
+func TestClient_waitPacket_timeout(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
 	})
 
-	if err != ErrPacketIDExhaused {
-		invalidError(t, err, ErrPacketIDExhaused)
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
 	}
-}
 
-func TestClient_newPUBLISHPacket_ErrInvalidQoS(t *testing.T) {
-	cli := New(nil)
+	defer cli.Disconnect()
 
-	cli.sess = newSession(false, []byte("clientID"))
+	cli.conn.wg.Add(1)
 
-	_, err := cli.newPUBLISHPacket(&PublishOptions{
-		QoS: 0x03,
-	})
+	cli.waitPacket(nil, 1, errTest)
+}
 
-	if err != packet.ErrInvalidQoS {
-		invalidError(t, err, packet.ErrInvalidQoS)
+func TestClient_receivePackets_handlePacketErr(t *testing.T) {
+	ln, err := net.Listen("tcp", ":1883")
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
 	}
-}
 
-func TestClient_newPUBLISHPacket(t *testing.T) {
-	cli := New(nil)
+	c := make(chan struct{})
 
-	cli.sess = newSession(false, []byte("clientID"))
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(testCONNACK)
+			<-c
+			if _, err := conn.Write([]byte{packet.TypePUBACK << 4, 0x02, 0x00, 0x01}); err != nil {
+				return
+			}
+		}
+	}()
 
-	_, err := cli.newPUBLISHPacket(&PublishOptions{
-		QoS: mqtt.QoS1,
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
 	})
 
+	err = cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  "localhost:1883",
+		ClientID: []byte("clientID"),
+	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
-}
 
-func TestClient_validatePacketID_notExist(t *testing.T) {
-	cli := New(nil)
+	defer cli.Disconnect()
 
-	if err := cli.validatePacketID(map[uint16]packet.Packet{}, 1, packet.TypePUBLISH); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
+	c <- struct{}{}
+
+	cli.conn.wg.Wait()
+
+	if err := ln.Close(); err != nil {
+		nilErrorExpected(t, err)
 	}
 }
 
-func TestClient_validatePacketID_ptypeErr(t *testing.T) {
-	cli := New(nil)
+func TestClient_handlePacket_TypeErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	if err := cli.validatePacketID(map[uint16]packet.Packet{1: &packetErr{}}, 1, packet.TypePUBLISH); err != errTest {
+	p := &packetErr{}
+
+	if err := cli.handlePacket(p); err != errTest {
 		invalidError(t, err, errTest)
 	}
 }
 
-func TestClient_validatePacketID_ErrInvalidPacketID(t *testing.T) {
-	cli := New(nil)
+func TestClient_handlePacket_PUBLISH(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	p, err := packet.NewPUBACK(&packet.PUBACKOptions{
-		PacketID: 1,
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
 	}
 
-	if err := cli.validatePacketID(map[uint16]packet.Packet{1: p}, 1, packet.TypePUBLISH); err != packet.ErrInvalidPacketID {
-		invalidError(t, err, packet.ErrInvalidPacketID)
-	}
-}
-
-func TestClient_validatePacketID(t *testing.T) {
-	cli := New(nil)
+	defer cli.Disconnect()
 
 	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
 		PacketID: 1,
 	})
 	if err != nil {
 		nilErrorExpected(t, err)
+		return
 	}
 
-	if err := cli.validatePacketID(map[uint16]packet.Packet{1: p}, 1, packet.TypePUBLISH); err != nil {
-		nilErrorExpected(t, err)
-	}
+	cli.handlePacket(p)
 }
 
-func TestClient_handleMessage_continue(t *testing.T) {
-	cli := New(nil)
-
-	cli.conn = &connection{}
-
-	cli.conn.ackedSubs = map[string]MessageHandler{
-		"test": nil,
-	}
+func TestClient_handlePacket_PUBACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	cli.handleMessage([]byte("test"), nil)
-}
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
 
-func TestClient_handleMessage(t *testing.T) {
-	cli := New(nil)
+	defer cli.Disconnect()
 
-	cli.conn = &connection{}
+	p, err := packet.NewPUBACK(&packet.PUBACKOptions{
+		PacketID: 1,
+	})
+
+	cli.handlePacket(p)
+}
+
+func TestClient_handlePacket_PUBREC(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
 
-	cli.conn.ackedSubs = map[string]MessageHandler{
-		"test": func(_, _ []byte) {},
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
 	}
 
-	cli.handleMessage([]byte("test"), nil)
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBREC(&packet.PUBRECOptions{
+		PacketID: 1,
+	})
+
+	cli.handlePacket(p)
 }
 
-func TestNew_optsNil(t *testing.T) {
-	cli := New(nil)
+func TestClient_handlePacket_PUBREL(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
 
-	cli.disconnc <- struct{}{}
+	defer cli.Disconnect()
 
-	time.Sleep(500 * time.Millisecond)
+	p, err := packet.NewPUBREL(&packet.PUBRELOptions{
+		PacketID: 1,
+	})
 
-	cli.disconnEndc <- struct{}{}
+	cli.handlePacket(p)
+}
 
-	cli.wg.Wait()
+func TestClient_handlePacket_PUBCOMP(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBCOMP(&packet.PUBCOMPOptions{
+		PacketID: 1,
+	})
 
+	cli.handlePacket(p)
 }
 
-func TestNew(t *testing.T) {
+func TestClient_handlePacket_SUBACK(t *testing.T) {
 	cli := New(&Options{
 		ErrorHandler: func(_ error) {},
 	})
 
-	cli.disconnc <- struct{}{}
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
 
-	time.Sleep(500 * time.Millisecond)
+	defer cli.Disconnect()
 
-	cli.disconnEndc <- struct{}{}
+	p, err := packet.NewSUBACKFromBytes([]byte{packet.TypeSUBACK << 4, 0x03}, []byte{0x00, 0x01, 0x00})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
 
-	cli.wg.Wait()
+	cli.handlePacket(p)
 }
 
-func Test_match(t *testing.T) {
-	testCases := []struct {
-		in struct {
-			topicName   string
-			topicFilter string
-		}
-		out bool
-	}{
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player1",
-				topicFilter: "sport/tennis/player1/#",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player1/ranking",
-				topicFilter: "sport/tennis/player1/#",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player1/score/wimbledon",
-				topicFilter: "sport/tennis/player1/#",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player2",
-				topicFilter: "sport/tennis/player1/#",
-			},
-			out: false,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "",
-				topicFilter: "#",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "test",
-				topicFilter: "#",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "test/test",
-				topicFilter: "#",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player1",
-				topicFilter: "sport/tennis/+",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player2",
-				topicFilter: "sport/tennis/+",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/player1/ranking",
-				topicFilter: "sport/tennis/+",
-			},
-			out: false,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis/",
-				topicFilter: "sport/tennis/+",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "sport/tennis",
-				topicFilter: "sport/tennis/+",
-			},
-			out: false,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "",
-				topicFilter: "+",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "test",
-				topicFilter: "+",
-			},
-			out: true,
-		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "test/test",
-				topicFilter: "+",
-			},
+func TestClient_handlePacket_UNSUBACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewUNSUBACKFromBytes([]byte{packet.TypeUNSUBACK << 4, 0x02}, []byte{0x00, 0x01})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.handlePacket(p)
+}
+
+func TestClient_handlePacket_ErrInvalidPacketType(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewCONNECT(&packet.CONNECTOptions{
+		ClientID: []byte("cliendID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.handlePacket(p)
+}
+
+func TestClient_handlePacket_CONNACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	p, err := packet.NewCONNACKFromBytes(testCONNACK[:2], testCONNACK[2:])
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := cli.handlePacket(p); err != ErrInvalidCONNACK {
+		invalidError(t, err, ErrInvalidCONNACK)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS0(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err = cli.handlePUBLISH(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS1_Err(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:      mqtt.QoS1,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	p.(*packet.PUBLISH).PacketID = 0
+
+	if err = cli.handlePUBLISH(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS1(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:      mqtt.QoS1,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err = cli.handlePUBLISH(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS2_ErrInvalidPacketID(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:      mqtt.QoS2,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.receivingPackets[1] = p
+
+	if err = cli.handlePUBLISH(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS2_DUP(t *testing.T) {
+	ln := newTestServer(t, testCONNACK)
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		DUP:      true,
+		QoS:      mqtt.QoS2,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.muSess.Lock()
+	cli.sess.receivingPackets[1] = p
+	cli.muSess.Unlock()
+
+	if err = cli.handlePUBLISH(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS2_NewPUBRECErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:      mqtt.QoS2,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	p.(*packet.PUBLISH).PacketID = 0
+
+	if err = cli.handlePUBLISH(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBLISH_QoS2(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:      mqtt.QoS2,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err = cli.handlePUBLISH(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBACK_validatePacketIDErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBACK{
+		PacketID: 1,
+	}
+
+	if err := cli.handlePUBACK(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBACK{
+		PacketID: 1,
+	}
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.sendingPackets[1] = publish
+
+	if err := cli.handlePUBACK(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBREC_validatePacketIDErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBREC{
+		PacketID: 1,
+	}
+
+	if err := cli.handlePUBREC(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBREC_NewPUBRELErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBREC{
+		PacketID: 0,
+	}
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	publish.(*packet.PUBLISH).PacketID = 0
+
+	cli.sess.sendingPackets[0] = publish
+
+	if err := cli.handlePUBREC(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBREC(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBREC{
+		PacketID: 1,
+	}
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.sendingPackets[1] = publish
+
+	if err := cli.handlePUBREC(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBREC_ErrDisconnected(t *testing.T) {
+	cli := New(nil)
+
+	// Set the Network Connection which has stopped sending the Packets.
+	cli.conn = &connection{
+		send:     make(chan packet.Packet),
+		sendDone: make(chan struct{}),
+	}
+
+	close(cli.conn.sendDone)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:      mqtt.QoS2,
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.sendingPackets[1] = publish
+
+	if err := cli.handlePUBREC(&packet.PUBREC{PacketID: 1}); err != ErrDisconnected {
+		invalidError(t, err, ErrDisconnected)
+	}
+
+	// The Mutexes have been unlocked.
+	cli.muConn.Lock()
+	cli.muSess.Lock()
+
+	// The PUBREL Packet remains in the Session to be resent.
+	if _, ok := cli.sess.sendingPackets[1].(*packet.PUBREL); !ok {
+		t.Error("the PUBREL Packet should remain in the Session")
+	}
+
+	cli.muSess.Unlock()
+	cli.muConn.Unlock()
+}
+
+func TestClient_handlePUBREL_validatePacketIDErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBREL{
+		PacketID: 1,
+	}
+
+	if err := cli.handlePUBREL(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBREL_NewPUBCOMPErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBREL{
+		PacketID: 0,
+	}
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	publish.(*packet.PUBLISH).PacketID = 0
+
+	cli.sess.receivingPackets[0] = publish
+
+	if err := cli.handlePUBREL(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBREL(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBREL{
+		PacketID: 1,
+	}
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.receivingPackets[1] = publish
+
+	if err := cli.handlePUBREL(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePUBCOMP_validatePacketIDErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBCOMP{
+		PacketID: 1,
+	}
+
+	if err := cli.handlePUBCOMP(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handlePUBCOMP(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.PUBCOMP{
+		PacketID: 1,
+	}
+
+	pubrel, err := packet.NewPUBREL(&packet.PUBRELOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.sendingPackets[1] = pubrel
+
+	if err := cli.handlePUBCOMP(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handleSUBACK_validatePacketIDErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.SUBACK{
+		PacketID:    1,
+		ReturnCodes: []byte{mqtt.QoS0},
+	}
+
+	if err := cli.handleSUBACK(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handleSUBACK_ErrInvalidSUBACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.SUBACK{
+		PacketID:    1,
+		ReturnCodes: []byte{mqtt.QoS0},
+	}
+
+	subscribe, err := packet.NewSUBSCRIBE(&packet.SUBSCRIBEOptions{
+		PacketID: 1,
+		SubReqs: []*packet.SubReq{
+			&packet.SubReq{
+				TopicFilter: []byte("test"),
+				QoS:         mqtt.QoS0,
+			},
+			&packet.SubReq{
+				TopicFilter: []byte("test2"),
+				QoS:         mqtt.QoS0,
+			},
+		},
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.sess.sendingPackets[1] = subscribe
+
+	if err := cli.handleSUBACK(p); err != ErrInvalidSUBACK {
+		invalidError(t, err, ErrInvalidSUBACK)
+	}
+}
+
+func TestClient_handleSUBACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.SUBACK{
+		PacketID:    1,
+		ReturnCodes: []byte{packet.SUBACKRetFailure, mqtt.QoS0},
+	}
+
+	subscribe, err := packet.NewSUBSCRIBE(&packet.SUBSCRIBEOptions{
+		PacketID: 1,
+		SubReqs: []*packet.SubReq{
+			&packet.SubReq{
+				TopicFilter: []byte("test"),
+				QoS:         mqtt.QoS0,
+			},
+			&packet.SubReq{
+				TopicFilter: []byte("test2"),
+				QoS:         mqtt.QoS0,
+			},
+		},
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.sess.sendingPackets[1] = subscribe
+
+	if err := cli.handleSUBACK(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handleUNSUBACK_validatePacketIDErr(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.UNSUBACK{
+		PacketID: 1,
+	}
+
+	if err := cli.handleUNSUBACK(p); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_handleUNSUBACK(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	p := &packet.UNSUBACK{
+		PacketID: 1,
+	}
+
+	unsubscribe, err := packet.NewUNSUBSCRIBE(&packet.UNSUBSCRIBEOptions{
+		PacketID:     1,
+		TopicFilters: [][]byte{[]byte("test")},
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.sess.sendingPackets[1] = unsubscribe
+
+	if err := cli.handleUNSUBACK(p); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePINGRESP_ErrInvalidPINGRESP(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	if err := cli.handlePINGRESP(); err != ErrInvalidPINGRESP {
+		invalidError(t, err, ErrInvalidPINGRESP)
+	}
+}
+
+func TestClient_handlePINGRESP_default(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	cli.conn.pingresps = append(cli.conn.pingresps, make(chan struct{}))
+
+	if err := cli.handlePINGRESP(); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handlePINGRESP(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	defer cli.Disconnect()
+
+	cli.conn.pingresps = append(cli.conn.pingresps, make(chan struct{}, 1))
+
+	if err := cli.handlePINGRESP(); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handleErrorAndDisconn_connNil(t *testing.T) {
+	cli := New(nil)
+
+	cli.handleErrorAndDisconn(errTest)
+}
+
+func TestClient_handleErrorAndDisconn_default(t *testing.T) {
+	cli := &Client{
+		errorHandler: func(_ error) {},
+	}
+
+	cli.conn = &connection{}
+
+	cli.disconnc = make(chan error)
+
+	cli.handleErrorAndDisconn(errTest)
+}
+
+func TestClient_handleErrorAndDisconn(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.handleErrorAndDisconn(errTest)
+
+	time.Sleep(1 * time.Second)
+}
+
+func TestClient_sendPackets_sendErr(t *testing.T) {
+	cli := New(nil)
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  testAddress,
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := cli.conn.Close(); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.conn.send <- &packetErr{}
+
+	cli.conn.wg.Wait()
+}
+
+func TestClient_sendPackets_keepAliveErr(t *testing.T) {
+	cli := New(nil)
+
+	err := cli.Connect(&ConnectOptions{
+		Network:   "tcp",
+		Address:   testAddress,
+		ClientID:  []byte("clientID"),
+		KeepAlive: 2,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := cli.conn.Close(); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	cli.conn.wg.Wait()
+}
+
+func TestClient_sendPackets_sendEnd(t *testing.T) {
+	cli := New(nil)
+
+	err := cli.Connect(&ConnectOptions{
+		Network:   "tcp",
+		Address:   testAddress,
+		ClientID:  []byte("clientID"),
+		KeepAlive: 3,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	time.Sleep(5 * time.Second)
+
+	cli.conn.muPINGRESPs.Lock()
+	cli.conn.pingresps = append(cli.conn.pingresps, make(chan struct{}))
+	cli.conn.muPINGRESPs.Unlock()
+
+	cli.conn.sendEnd <- struct{}{}
+
+	cli.muConn.Lock()
+	wg := &cli.conn.wg
+	cli.muConn.Unlock()
+
+	wg.Wait()
+}
+
+func TestClient_newPUBLISHPacket_generatePacketID(t *testing.T) {
+	cli := New(nil)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	id := minPacketID
+
+	for {
+		cli.sess.sendingPackets[id] = nil
+
+		if id == maxPacketID {
+			break
+		}
+
+		id++
+	}
+
+	_, err := cli.newPUBLISHPacket(&PublishOptions{
+		QoS: mqtt.QoS1,
+	})
+
+	if err != ErrPacketIDExhaused {
+		invalidError(t, err, ErrPacketIDExhaused)
+	}
+}
+
+func TestClient_newPUBLISHPacket_ErrInvalidQoS(t *testing.T) {
+	cli := New(nil)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	_, err := cli.newPUBLISHPacket(&PublishOptions{
+		QoS: 0x03,
+	})
+
+	if err != packet.ErrInvalidQoS {
+		invalidError(t, err, packet.ErrInvalidQoS)
+	}
+}
+
+func TestClient_newPUBLISHPacket(t *testing.T) {
+	cli := New(nil)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	_, err := cli.newPUBLISHPacket(&PublishOptions{
+		QoS: mqtt.QoS1,
+	})
+
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_validatePacketID_notExist(t *testing.T) {
+	cli := New(nil)
+
+	if err := cli.validatePacketID(map[uint16]packet.Packet{}, 1, packet.TypePUBLISH); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_validatePacketID_ptypeErr(t *testing.T) {
+	cli := New(nil)
+
+	if err := cli.validatePacketID(map[uint16]packet.Packet{1: &packetErr{}}, 1, packet.TypePUBLISH); err != errTest {
+		invalidError(t, err, errTest)
+	}
+}
+
+func TestClient_validatePacketID_ErrInvalidPacketID(t *testing.T) {
+	cli := New(nil)
+
+	p, err := packet.NewPUBACK(&packet.PUBACKOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := cli.validatePacketID(map[uint16]packet.Packet{1: p}, 1, packet.TypePUBLISH); err != packet.ErrInvalidPacketID {
+		invalidError(t, err, packet.ErrInvalidPacketID)
+	}
+}
+
+func TestClient_validatePacketID(t *testing.T) {
+	cli := New(nil)
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		PacketID: 1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := cli.validatePacketID(map[uint16]packet.Packet{1: p}, 1, packet.TypePUBLISH); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_handleMessage_continue(t *testing.T) {
+	cli := New(nil)
+
+	cli.conn = &connection{}
+
+	cli.conn.addAckedSub("test", &SubReq{})
+
+	cli.handleMessage(&packet.PUBLISH{TopicName: []byte("test")}, nil)
+}
+
+func TestClient_handleMessage(t *testing.T) {
+	cli := New(nil)
+
+	cli.conn = &connection{}
+
+	cli.conn.addAckedSub("test", &SubReq{
+		Handler: func(_, _ []byte) {},
+	})
+
+	cli.handleMessage(&packet.PUBLISH{TopicName: []byte("test")}, nil)
+}
+
+func TestClient_handleMessage_ordered(t *testing.T) {
+	cli := New(&Options{
+		Dispatch: &DispatchOptions{
+			Mode: DispatchOrderedPerTopic,
+		},
+	})
+
+	defer cli.Terminate()
+
+	const n = 100
+
+	var wg sync.WaitGroup
+
+	wg.Add(n)
+
+	var messages []string
+
+	cli.conn = &connection{}
+
+	cli.conn.addAckedSub("a/#", &SubReq{
+		Handler: func(_, message []byte) {
+			messages = append(messages, string(message))
+			wg.Done()
+		},
+	})
+
+	for i := 0; i < n; i++ {
+		cli.handleMessage(&packet.PUBLISH{
+			TopicName: []byte("a/b"),
+			Message:   []byte(fmt.Sprint(i)),
+		}, nil)
+	}
+
+	wg.Wait()
+
+	for i, message := range messages {
+		if message != fmt.Sprint(i) {
+			t.Errorf("messages[%d] => %q, want => %q", i, message, fmt.Sprint(i))
+			return
+		}
+	}
+}
+
+func TestClient_handleMessage_messageFunc(t *testing.T) {
+	cli := New(nil)
+
+	defer cli.Terminate()
+
+	msgc := make(chan *Message, 1)
+
+	cli.conn = &connection{}
+
+	cli.conn.addAckedSub("a/+", &SubReq{
+		TopicFilter: []byte("a/+"),
+		Handler: func(_, _ []byte) {
+			t.Error("Handler should not be called")
+		},
+		MessageFunc: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	cli.handleMessage(&packet.PUBLISH{
+		DUP:       true,
+		QoS:       mqtt.QoS1,
+		Retain:    true,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+		Message:   []byte("message"),
+	}, nil)
+
+	msg := <-msgc
+
+	want := &Message{
+		TopicName:   []byte("a/b"),
+		Payload:     []byte("message"),
+		QoS:         mqtt.QoS1,
+		Retain:      true,
+		DUP:         true,
+		PacketID:    1,
+		TopicFilter: []byte("a/+"),
+	}
+
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("msg => %+v, want => %+v", msg, want)
+	}
+}
+
+func TestClient_handleMessage_defaultMessageHandler(t *testing.T) {
+	msgc := make(chan *Message, 1)
+
+	cli := New(&Options{
+		DefaultMessageHandler: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	defer cli.Terminate()
+
+	cli.conn = &connection{}
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		Handler: func(_, _ []byte) {
+			t.Error("Handler should not be called")
+		},
+	})
+
+	cli.handleMessage(&packet.PUBLISH{
+		TopicName: []byte("c/d"),
+		Message:   []byte("message"),
+	}, nil)
+
+	msg := <-msgc
+
+	if string(msg.TopicName) != "c/d" {
+		t.Errorf("msg.TopicName => %q, want => %q", msg.TopicName, "c/d")
+	}
+
+	if msg.TopicFilter != nil {
+		t.Errorf("msg.TopicFilter => %q, want => nil", msg.TopicFilter)
+	}
+}
+
+func TestClient_handleMessage_defaultMessageHandlerNotCalled(t *testing.T) {
+	msgc := make(chan *Message, 1)
+
+	cli := New(&Options{
+		DefaultMessageHandler: func(_ *Message) {
+			t.Error("DefaultMessageHandler should not be called")
+		},
+	})
+
+	defer cli.Terminate()
+
+	cli.conn = &connection{}
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		MessageFunc: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	cli.handleMessage(&packet.PUBLISH{
+		TopicName: []byte("a/b"),
+	}, nil)
+
+	<-msgc
+}
+
+func newTestManualAckClient(errorHandler ErrorHandler) *Client {
+	cli := New(&Options{
+		ErrorHandler: errorHandler,
+		ManualAck:    true,
+	})
+
+	cli.conn = &connection{
+		send:     make(chan packet.Packet, 1),
+		sendDone: make(chan struct{}),
+	}
+
+	cli.sess = newSession(false, nil, nil)
+
+	return cli
+}
+
+func TestClient_handlePUBLISH_manualAckQoS1(t *testing.T) {
+	cli := newTestManualAckClient(nil)
+
+	defer cli.Terminate()
+
+	msgc := make(chan *Message, 1)
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		MessageFunc: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	publish := &packet.PUBLISH{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+	}
+
+	if err := cli.handlePUBLISH(publish); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	msg := <-msgc
+
+	if len(cli.conn.send) != 0 {
+		t.Error("the PUBACK Packet should not be sent before the acknowledgment")
+		return
+	}
+
+	if cli.sess.unackedMessages[1] != publish {
+		t.Error("the PUBLISH Packet should be unacknowledged")
+		return
+	}
+
+	msg.Ack()
+	msg.Ack()
+
+	if p := <-cli.conn.send; p.(*packet.PUBACK).PacketID != 1 {
+		t.Errorf("PacketID => %d, want => %d", p.(*packet.PUBACK).PacketID, 1)
+	}
+
+	if len(cli.sess.unackedMessages) != 0 {
+		t.Errorf("len(unackedMessages) => %d, want => %d", len(cli.sess.unackedMessages), 0)
+	}
+
+	if len(cli.conn.send) != 0 {
+		t.Error("the PUBACK Packet should be sent only once")
+	}
+}
+
+func TestClient_handlePUBREL_manualAck(t *testing.T) {
+	cli := newTestManualAckClient(nil)
+
+	defer cli.Terminate()
+
+	msgc := make(chan *Message, 2)
+
+	for _, topicFilter := range []string{"a/b", "a/+"} {
+		cli.conn.addAckedSub(topicFilter, &SubReq{
+			TopicFilter: []byte(topicFilter),
+			MessageFunc: func(msg *Message) {
+				msgc <- msg
+			},
+		})
+	}
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:       mqtt.QoS2,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.sess.receivingPackets[1] = publish
+
+	if err := cli.handlePUBREL(&packet.PUBREL{PacketID: 1}); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	msg1, msg2 := <-msgc, <-msgc
+
+	msg1.Ack()
+
+	if len(cli.conn.send) != 0 {
+		t.Error("the PUBCOMP Packet should not be sent before all message handlers acknowledge")
+		return
+	}
+
+	msg2.Ack()
+
+	if p := <-cli.conn.send; p.(*packet.PUBCOMP).PacketID != 1 {
+		t.Errorf("PacketID => %d, want => %d", p.(*packet.PUBCOMP).PacketID, 1)
+	}
+
+	if len(cli.sess.receivingPackets) != 0 {
+		t.Errorf("len(receivingPackets) => %d, want => %d", len(cli.sess.receivingPackets), 0)
+	}
+}
+
+func TestClient_handlePUBLISH_manualAckMessageHandler(t *testing.T) {
+	cli := newTestManualAckClient(nil)
+
+	defer cli.Terminate()
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		Handler:     func(_, _ []byte) {},
+	})
+
+	err := cli.handlePUBLISH(&packet.PUBLISH{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, ok := (<-cli.conn.send).(*packet.PUBACK); !ok {
+		t.Error("the PUBACK Packet should be sent after the MessageHandler returns")
+	}
+}
+
+func TestClient_handlePUBLISH_manualAckNoHandler(t *testing.T) {
+	cli := newTestManualAckClient(nil)
+
+	defer cli.Terminate()
+
+	err := cli.handlePUBLISH(&packet.PUBLISH{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if len(cli.conn.send) != 1 {
+		t.Error("the PUBACK Packet should be sent immediately")
+	}
+}
+
+func TestClient_ackMessage_ErrNotYetConnected(t *testing.T) {
+	errc := make(chan error, 1)
+
+	cli := newTestManualAckClient(func(err error) {
+		errc <- err
+	})
+
+	defer cli.Terminate()
+
+	msgc := make(chan *Message, 1)
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		MessageFunc: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	publish := &packet.PUBLISH{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+	}
+
+	if err := cli.handlePUBLISH(publish); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	msg := <-msgc
+
+	cli.muConn.Lock()
+	cli.conn = nil
+	cli.muConn.Unlock()
+
+	msg.Ack()
+
+	if err := <-errc; err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
+	}
+
+	if cli.sess.unackedMessages[1] != publish {
+		t.Error("the PUBLISH Packet should remain unacknowledged")
+	}
+}
+
+func TestClient_ackMessage_ErrDisconnected(t *testing.T) {
+	errc := make(chan error, 1)
+
+	cli := newTestManualAckClient(func(err error) {
+		errc <- err
+	})
+
+	defer cli.Terminate()
+
+	msgc := make(chan *Message, 1)
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		MessageFunc: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	publish := &packet.PUBLISH{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+	}
+
+	if err := cli.handlePUBLISH(publish); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	msg := <-msgc
+
+	// Fill the send channel and end sending the Packets.
+	cli.conn.send <- packet.NewPINGREQ()
+	close(cli.conn.sendDone)
+
+	msg.Ack()
+
+	if err := <-errc; err != ErrDisconnected {
+		invalidError(t, err, ErrDisconnected)
+	}
+
+	if cli.sess.unackedMessages[1] != publish {
+		t.Error("the PUBLISH Packet should remain unacknowledged")
+	}
+}
+
+func TestClient_handleMessage_manualAckDropped(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+		ManualAck:    true,
+		Dispatch: &DispatchOptions{
+			QueueSize:       1,
+			QueueFullPolicy: QueueFullDrop,
+		},
+	})
+
+	defer cli.Terminate()
+
+	cli.conn = &connection{
+		send:     make(chan packet.Packet, 1),
+		sendDone: make(chan struct{}),
+	}
+
+	cli.sess = newSession(false, nil, nil)
+
+	startc := make(chan struct{}, 1)
+	blockc := make(chan struct{})
+
+	defer close(blockc)
+
+	cli.conn.addAckedSub("a/b", &SubReq{
+		TopicFilter: []byte("a/b"),
+		MessageFunc: func(_ *Message) {
+			startc <- struct{}{}
+			<-blockc
+		},
+	})
+
+	for id := uint16(1); id <= 2; id++ {
+		err := cli.handlePUBLISH(&packet.PUBLISH{
+			QoS:       mqtt.QoS1,
+			TopicName: []byte("a/b"),
+			PacketID:  id,
+		})
+		if err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+
+		if id == 1 {
+			<-startc
+		}
+	}
+
+	cli.muSess.Lock()
+	_, exist1 := cli.sess.unackedMessages[1]
+	_, exist2 := cli.sess.unackedMessages[2]
+	cli.muSess.Unlock()
+
+	if !exist1 {
+		t.Error("the dispatched PUBLISH Packet should remain unacknowledged")
+	}
+
+	if exist2 {
+		t.Error("the dropped PUBLISH Packet should not remain unacknowledged")
+	}
+}
+
+func TestNew_optsNil(t *testing.T) {
+	cli := New(nil)
+
+	cli.disconnc <- nil
+
+	time.Sleep(500 * time.Millisecond)
+
+	cli.disconnEndc <- struct{}{}
+
+	cli.wg.Wait()
+
+}
+
+func TestNew(t *testing.T) {
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	if cli.store != nil {
+		t.Errorf("cli.store => %v, want => nil", cli.store)
+	}
+
+	cli.disconnc <- nil
+
+	time.Sleep(500 * time.Millisecond)
+
+	cli.disconnEndc <- struct{}{}
+
+	cli.wg.Wait()
+}
+
+func Test_match(t *testing.T) {
+	testCases := []struct {
+		in struct {
+			topicName   string
+			topicFilter string
+		}
+		out bool
+	}{
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player1",
+				topicFilter: "sport/tennis/player1/#",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player1/ranking",
+				topicFilter: "sport/tennis/player1/#",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player1/score/wimbledon",
+				topicFilter: "sport/tennis/player1/#",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player2",
+				topicFilter: "sport/tennis/player1/#",
+			},
+			out: false,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "",
+				topicFilter: "#",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "test",
+				topicFilter: "#",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "test/test",
+				topicFilter: "#",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player1",
+				topicFilter: "sport/tennis/+",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player2",
+				topicFilter: "sport/tennis/+",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/player1/ranking",
+				topicFilter: "sport/tennis/+",
+			},
+			out: false,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis/",
+				topicFilter: "sport/tennis/+",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "sport/tennis",
+				topicFilter: "sport/tennis/+",
+			},
+			out: false,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "",
+				topicFilter: "+",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "test",
+				topicFilter: "+",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "test/test",
+				topicFilter: "+",
+			},
 			out: false,
 		},
 		{
@@ -2171,39 +4466,806 @@ func Test_match(t *testing.T) {
 			},
 			out: true,
 		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "$SYS/monitor/Clients",
-				topicFilter: "$SYS/monitor/+",
-			},
-			out: true,
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "$SYS/monitor/Clients",
+				topicFilter: "$SYS/monitor/+",
+			},
+			out: true,
+		},
+		{
+			in: struct {
+				topicName   string
+				topicFilter string
+			}{
+				topicName:   "$SYS/monitor/Clients/test",
+				topicFilter: "$SYS/monitor/+",
+			},
+			out: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := match(tc.in.topicName, tc.in.topicFilter); got != tc.out {
+			t.Errorf("got => %t, want => %t", got, tc.out)
+		}
+	}
+}
+
+// newTestServer launches a Server on the local address which writes
+// the byte data to each accepted Network Connection and keeps it open.
+func newTestServer(t *testing.T, b []byte) net.Listener {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				conn.Write(b)
+				io.Copy(ioutil.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	return ln
+}
+
+// newTestBroker launches a Server on the local address which accepts
+// the connections and acknowledges each Packet sent from the Client.
+func newTestBroker(t *testing.T) net.Listener {
+	return newTestBrokerHook(t, nil)
+}
+
+// newTestBrokerHook launches the Server of newTestBroker which
+// calls the hook with each Packet sent from the Client.
+func newTestBrokerHook(t *testing.T, hook func(b byte, remaining []byte)) net.Listener {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveTestBroker(conn, hook)
+		}
+	}()
+
+	return ln
+}
+
+// serveTestBroker acknowledges each Packet sent from the Client.
+// The hook is called with the Packet before it is acknowledged
+// if it is not nil.
+func serveTestBroker(conn net.Conn, hook func(b byte, remaining []byte)) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		b, remaining, err := readTestPacket(r)
+		if err != nil {
+			return
+		}
+
+		if hook != nil {
+			hook(b, remaining)
+		}
+
+		var resp []byte
+
+		switch b >> 4 {
+		case packet.TypeCONNECT:
+			resp = testCONNACK
+		case packet.TypePUBLISH:
+			// Get the offset of the Packet Identifier.
+			i := 2 + int(remaining[0])<<8 + int(remaining[1])
+
+			switch b & 0x06 >> 1 {
+			case mqtt.QoS1:
+				resp = []byte{packet.TypePUBACK << 4, 0x02, remaining[i], remaining[i+1]}
+			case mqtt.QoS2:
+				resp = []byte{packet.TypePUBREC << 4, 0x02, remaining[i], remaining[i+1]}
+			}
+		case packet.TypePUBREL:
+			resp = []byte{packet.TypePUBCOMP << 4, 0x02, remaining[0], remaining[1]}
+		case packet.TypeSUBSCRIBE:
+			// Grant the requested QoS for each Topic Filter except that
+			// the "refused/" Topic Filters are refused and the "limited/"
+			// Topic Filters are granted QoS 1 at most.
+			var returnCodes []byte
+
+			for i := 2; i < len(remaining); {
+				n := int(remaining[i])<<8 + int(remaining[i+1])
+				topicFilter := string(remaining[i+2 : i+2+n])
+				i += 2 + n
+
+				code := remaining[i]
+
+				switch {
+				case strings.HasPrefix(topicFilter, "refused/"):
+					code = packet.SUBACKRetFailure
+				case strings.HasPrefix(topicFilter, "limited/") && code > mqtt.QoS1:
+					code = mqtt.QoS1
+				}
+
+				returnCodes = append(returnCodes, code)
+				i++
+			}
+
+			resp = append([]byte{packet.TypeSUBACK << 4, byte(2 + len(returnCodes)), remaining[0], remaining[1]}, returnCodes...)
+		case packet.TypeUNSUBSCRIBE:
+			resp = []byte{packet.TypeUNSUBACK << 4, 0x02, remaining[0], remaining[1]}
+		case packet.TypePINGREQ:
+			resp = []byte{packet.TypePINGRESP << 4, 0x00}
+		case packet.TypeDISCONNECT:
+			return
+		}
+
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// readTestPacket reads an MQTT Control Packet and returns
+// the first byte of its fixed header and its remaining.
+func readTestPacket(r *bufio.Reader) (byte, []byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var rl, mp int = 0, 1
+
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		rl += int(d&0x7F) * mp
+
+		if d&0x80 == 0 {
+			break
+		}
+
+		mp *= 128
+	}
+
+	remaining := make([]byte, rl)
+
+	if _, err := io.ReadFull(r, remaining); err != nil {
+		return 0, nil, err
+	}
+
+	return b, remaining, nil
+}
+
+func invalidError(t *testing.T, err, want error) {
+	if err == nil {
+		t.Errorf("err => nil, want => %q", want)
+	} else {
+		t.Errorf("err => %q, want => %q", err, want)
+	}
+}
+
+func TestClient_Publish_MessageReader(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	// The Application Message exceeds the maximum length of the strings.
+	message := make([]byte, 100000)
+
+	err = cli.Publish(&PublishOptions{
+		QoS:           mqtt.QoS1,
+		TopicName:     []byte("a/b"),
+		MessageReader: bytes.NewReader(message),
+		MessageLen:    len(message),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_PublishAsync_MessageReaderQoS0(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	pr, pw := io.Pipe()
+
+	token, err := cli.PublishAsync(&PublishOptions{
+		QoS:           mqtt.QoS0,
+		TopicName:     []byte("a/b"),
+		MessageReader: pr,
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// The Token is not completed until the Application Message is written.
+	select {
+	case <-token.Done():
+		t.Error("the Token was completed before the Application Message was written")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	go io.WriteString(pw, "message")
+
+	if err := token.WaitTimeout(5 * time.Second); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+// newTestStreamPUBLISH returns the encoded PUBLISH Packet
+// which has the Application Message of the length.
+func newTestStreamPUBLISH(t *testing.T, qos byte, packetID uint16, n int) []byte {
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:           qos,
+		TopicName:     []byte("a/b"),
+		PacketID:      packetID,
+		MessageReader: bytes.NewReader(bytes.Repeat([]byte{'x'}, n)),
+		MessageLen:    n,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bf bytes.Buffer
+
+	if _, err := p.WriteTo(&bf); err != nil {
+		t.Fatal(err)
+	}
+
+	return bf.Bytes()
+}
+
+func TestClient_StreamHandler(t *testing.T) {
+	var b []byte
+
+	b = append(b, testCONNACK...)
+	b = append(b, newTestStreamPUBLISH(t, mqtt.QoS1, 1, 1000)...)
+	b = append(b, newTestStreamPUBLISH(t, mqtt.QoS2, 2, 1000)...)
+	b = append(b, packet.TypePUBREL<<4|0x02, 0x02, 0x00, 0x02)
+	b = append(b, newTestStreamPUBLISH(t, mqtt.QoS0, 0, 10)...)
+
+	ln := newTestServer(t, b)
+	defer ln.Close()
+
+	streamedc := make(chan int, 2)
+	donec := make(chan *Message, 1)
+
+	cli := New(&Options{
+		ErrorHandler:    func(_ error) {},
+		StreamThreshold: 100,
+		StreamHandler: func(msg *Message) {
+			// Read a part of the Application Message.
+			n, _ := io.ReadFull(msg.PayloadReader, make([]byte, 10))
+
+			if string(msg.TopicName) != "a/b" || msg.PayloadLen != 1000 || n != 10 {
+				t.Errorf("msg.TopicName, msg.PayloadLen, n => %q, %d, %d, want => %q, %d, %d", msg.TopicName, msg.PayloadLen, n, "a/b", 1000, 10)
+			}
+
+			streamedc <- int(msg.QoS)
+		},
+		DefaultMessageHandler: func(msg *Message) {
+			donec <- msg
+		},
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	// The small Application Message is read in full.
+	select {
+	case msg := <-donec:
+		if len(msg.Payload) != 10 || msg.PayloadReader != nil {
+			t.Errorf("len(msg.Payload), msg.PayloadReader => %d, %v, want => %d, nil", len(msg.Payload), msg.PayloadReader, 10)
+		}
+	case <-time.After(time.Second):
+		t.Error("the Application Message was not handled")
+		return
+	}
+
+	close(streamedc)
+
+	var qoss []int
+
+	for qos := range streamedc {
+		qoss = append(qoss, qos)
+	}
+
+	if len(qoss) != 2 || qoss[0] != 1 || qoss[1] != 2 {
+		t.Errorf("qoss => %v, want => %v", qoss, []int{1, 2})
+	}
+
+	cli.muSess.RLock()
+	n := len(cli.sess.receivingPackets)
+	cli.muSess.RUnlock()
+
+	if n != 0 {
+		t.Errorf("len(cli.sess.receivingPackets) => %d, want => %d", n, 0)
+	}
+}
+
+func TestClient_Connect_resendNotRewindable(t *testing.T) {
+	ln := newTestServer(t, []byte{packet.TypeCONNACK << 4, 0x02, 0x01, 0x00})
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:           mqtt.QoS1,
+		TopicName:     []byte("a/b"),
+		PacketID:      1,
+		MessageReader: strings.NewReader("message"),
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// Consume the Application Message.
+	if _, err := p.WriteTo(ioutil.Discard); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// Hide the io.Seeker of the reader.
+	p.(*packet.PUBLISH).MessageReader = struct{ io.Reader }{p.(*packet.PUBLISH).MessageReader}
+
+	cli.sess.setSendingPacket(1, p)
+
+	freed := cli.inflightFreed()
+
+	err = cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	if n := cli.Inflight(); n != 0 {
+		t.Errorf("cli.Inflight() => %d, want => %d", n, 0)
+	}
+
+	// The release of the in-flight Packet has been notified.
+	select {
+	case <-freed:
+	default:
+		t.Error("the release of the in-flight Packet should be notified")
+	}
+}
+
+func TestClient_Connect_resendMany(t *testing.T) {
+	ln := newTestBroker(t)
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	// Store more PUBLISH Packets than the send channel can hold.
+	for id := uint16(1); id <= sendBufSize+1; id++ {
+		p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+			QoS:       mqtt.QoS1,
+			TopicName: []byte("a/b"),
+			PacketID:  id,
+			Message:   []byte("message"),
+		})
+		if err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+
+		cli.sess.setSendingPacket(id, p)
+	}
+
+	connected := make(chan error, 1)
+
+	go func() {
+		connected <- cli.Connect(&ConnectOptions{
+			Network:  "tcp",
+			Address:  ln.Addr().String(),
+			ClientID: []byte("clientID"),
+		})
+	}()
+
+	select {
+	case err := <-connected:
+		if err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the connection should not wait for resending the Packets")
+		return
+	}
+
+	defer cli.Disconnect()
+
+	// Wait until all PUBLISH Packets are acknowledged.
+	for i := 0; cli.Inflight() > 0; i++ {
+		if i == 500 {
+			t.Errorf("cli.Inflight() => %d, want => %d", cli.Inflight(), 0)
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_MaxIncomingPacketSize(t *testing.T) {
+	var b []byte
+
+	b = append(b, testCONNACK...)
+	b = append(b, newTestStreamPUBLISH(t, mqtt.QoS0, 0, 10)...)
+	b = append(b, packet.TypePUBLISH<<4, 0xFF, 0xFF, 0xFF, 0x7F)
+
+	ln := newTestServer(t, b)
+	defer ln.Close()
+
+	errc := make(chan error, 2)
+	msgc := make(chan *Message, 1)
+
+	cli := New(&Options{
+		ErrorHandler: func(err error) {
+			errc <- err
+		},
+		OnConnectionLost: func(cause error) {
+			errc <- cause
 		},
-		{
-			in: struct {
-				topicName   string
-				topicFilter string
-			}{
-				topicName:   "$SYS/monitor/Clients/test",
-				topicFilter: "$SYS/monitor/+",
-			},
-			out: false,
+		DefaultMessageHandler: func(msg *Message) {
+			msgc <- msg
 		},
+		MaxIncomingPacketSize: 1024,
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
 	}
 
-	for _, tc := range testCases {
-		if got := match(tc.in.topicName, tc.in.topicFilter); got != tc.out {
-			t.Errorf("got => %t, want => %t", got, tc.out)
+	// The Packet within the maximum packet size is handled.
+	select {
+	case <-msgc:
+	case <-time.After(time.Second):
+		t.Error("the Application Message was not handled")
+		return
+	}
+
+	// The Network Connection is closed on the oversized Packet.
+	select {
+	case err := <-errc:
+		if err != packet.ErrPacketTooLarge {
+			invalidError(t, err, packet.ErrPacketTooLarge)
 		}
+	case <-time.After(time.Second):
+		t.Error("the Network Connection was not closed")
 	}
 }
 
-func invalidError(t *testing.T, err, want error) {
-	if err == nil {
-		t.Errorf("err => nil, want => %q", want)
-	} else {
-		t.Errorf("err => %q, want => %q", err, want)
+func TestClient_readerOptions(t *testing.T) {
+	if opts := New(nil).readerOptions(); opts != nil {
+		t.Errorf("opts => %+v, want => nil", opts)
+	}
+
+	// StreamThreshold is not effective without the StreamHandler.
+	opts := New(&Options{
+		StreamThreshold:       100,
+		MaxIncomingPacketSize: 1024,
+	}).readerOptions()
+
+	if opts == nil || opts.StreamThreshold != 0 || opts.MaxPacketSize != 1024 {
+		t.Errorf("opts => %+v, want => %+v", opts, &packet.ReaderOptions{MaxPacketSize: 1024})
+	}
+}
+
+func TestClient_OfflineQueue(t *testing.T) {
+	topicNames := make(chan string, 16)
+
+	// Record the Topic Names of the PUBLISH Packets.
+	ln := newTestBrokerHook(t, func(b byte, remaining []byte) {
+		if b>>4 == packet.TypePUBLISH {
+			topicNames <- string(remaining[2 : 2+int(remaining[0])<<8+int(remaining[1])])
+		}
+	})
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+		OfflineQueue: &OfflineQueueOptions{},
+	})
+
+	defer cli.Terminate()
+
+	// Publish the Application Messages while disconnected.
+	if err := cli.Publish(&PublishOptions{TopicName: []byte("a")}); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	token, err := cli.PublishAsync(&PublishOptions{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("b"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// The invalid options are not queued.
+	if err := cli.Publish(&PublishOptions{QoS: 3}); err != packet.ErrInvalidQoS {
+		invalidError(t, err, packet.ErrInvalidQoS)
+	}
+
+	if n := cli.OfflineQueueLen(); n != 2 {
+		t.Errorf("cli.OfflineQueueLen() => %d, want => %d", n, 2)
+	}
+
+	err = cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	// The Application Message published after the connection
+	// is sent after the queued ones.
+	if err := cli.Publish(&PublishOptions{TopicName: []byte("c")}); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := token.WaitTimeout(time.Second); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case topicName := <-topicNames:
+			if topicName != want {
+				t.Errorf("topicName => %q, want => %q", topicName, want)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("the Application Message of %q was not sent", want)
+			return
+		}
+	}
+
+	if n := cli.OfflineQueueLen(); n != 0 {
+		t.Errorf("cli.OfflineQueueLen() => %d, want => %d", n, 0)
+	}
+}
+
+func TestClient_OfflineQueue_copy(t *testing.T) {
+	publishes := make(chan []byte, 1)
+
+	// Record the Variable Header and the Payload of the PUBLISH Packet.
+	ln := newTestBrokerHook(t, func(b byte, remaining []byte) {
+		if b>>4 == packet.TypePUBLISH {
+			publishes <- remaining
+		}
+	})
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+		OfflineQueue: &OfflineQueueOptions{},
+	})
+
+	defer cli.Terminate()
+
+	topicName := []byte("a/b")
+	message := []byte("message")
+
+	// Publish the Application Message while disconnected.
+	err := cli.Publish(&PublishOptions{
+		TopicName: topicName,
+		Message:   message,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// Reuse the buffers after the Application Message is queued.
+	copy(topicName, "c/d")
+	copy(message, "changed")
+
+	err = cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer cli.Disconnect()
+
+	want := "\x00\x03a/bmessage"
+
+	select {
+	case remaining := <-publishes:
+		if string(remaining) != want {
+			t.Errorf("remaining => %q, want => %q", remaining, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("the Application Message was not sent")
+	}
+}
+
+func TestClient_OfflineQueue_Terminate(t *testing.T) {
+	cli := New(&Options{
+		OfflineQueue: &OfflineQueueOptions{},
+	})
+
+	token, err := cli.PublishAsync(&PublishOptions{TopicName: []byte("a")})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	cli.Terminate()
+
+	if err := token.WaitTimeout(time.Second); err != ErrOfflineQueueClosed {
+		invalidError(t, err, ErrOfflineQueueClosed)
+	}
+}
+
+func TestClient_contextDuringConnect(t *testing.T) {
+	ln := newTestServer(t, nil)
+	defer ln.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	connectCtx, cancelConnect := context.WithCancel(context.Background())
+
+	connectErrc := make(chan error, 1)
+
+	// Connect to the Server which never sends the CONNACK Packet.
+	go func() {
+		connectErrc <- cli.ConnectContext(connectCtx, &ConnectOptions{
+			Network:  "tcp",
+			Address:  ln.Addr().String(),
+			ClientID: []byte("clientID"),
+		})
+	}()
+
+	// Wait for the start of the connection.
+	for i := 0; i < 100; i++ {
+		cli.muConn.RLock()
+		connecting := cli.connectingc != nil
+		cli.muConn.RUnlock()
+
+		if connecting {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := cli.PublishContext(ctx, &PublishOptions{QoS: mqtt.QoS1, TopicName: []byte("a")}); err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
+	}
+
+	if err := cli.SubscribeContext(ctx, &SubscribeOptions{SubReqs: []*SubReq{{TopicFilter: []byte("a")}}}); err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
+	}
+
+	if err := cli.UnsubscribeContext(ctx, &UnsubscribeOptions{TopicFilters: [][]byte{[]byte("a")}}); err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
+	}
+
+	cancelConnect()
+
+	if err := <-connectErrc; err != context.Canceled {
+		invalidError(t, err, context.Canceled)
+	}
+
+	// The methods proceed after the connection attempt ends.
+	if err := cli.Publish(&PublishOptions{TopicName: []byte("a")}); err != ErrNotYetConnected {
+		invalidError(t, err, ErrNotYetConnected)
 	}
 }
@@ -0,0 +1,6 @@
+package client
+
+// ConnectHandler is the handler which is called when the Server
+// accepts the connection. sessionPresent is the Session Present
+// of the CONNACK Packet.
+type ConnectHandler func(sessionPresent bool)
@@ -2,6 +2,7 @@ package client
 
 import (
 	"crypto/tls"
+	"net/url"
 	"time"
 )
 
@@ -9,11 +10,43 @@ import (
 // of the Client.
 type ConnectOptions struct {
 	// Network is the network on which the Client connects to.
+	// "ws" and "wss" connect over WebSocket.
 	Network string
 	// Address is the address which the Client connects to.
+	// A URL of the scheme "ws" or "wss" such as
+	// "wss://example.com/mqtt" connects over WebSocket.
+	// It is ignored if Addresses is not empty.
 	Address string
+	// Addresses is the list of the addresses of the Servers.
+	// The Client tries them in order, starting from the address
+	// of the latest successful connection, and moves to the next
+	// address when it fails to connect, the CONNACK Packet does
+	// not arrive within the CONNACKTimeout or the Server refuses
+	// the connection with ErrServerUnavailable.
+	Addresses []string
+	// RandomizeAddresses shuffles the Addresses on each connection
+	// attempt. The address of the latest successful connection is
+	// still tried first.
+	RandomizeAddresses bool
+	// WebSocket is the options for the connection over WebSocket.
+	WebSocket *WebSocketOptions
 	// TLSConfig is the configuration for the TLS connection.
 	TLSConfig *tls.Config
+	// Dialer is the function which connects to the Server instead
+	// of the built-in dialer. TLS is applied on top of the connection
+	// it returns if TLSConfig is not nil.
+	Dialer Dialer
+	// ProxyURL is the URL of the proxy which the Client connects to
+	// the Server through. The schemes "http" for the HTTP CONNECT
+	// method and "socks5" are supported. The user information of the
+	// URL is used for the authentication of the proxy. TLS to the
+	// Server is applied over the tunnel.
+	ProxyURL *url.URL
+	// ProxyFromEnvironment uses the proxy of the HTTPS_PROXY or
+	// ALL_PROXY environment variable if ProxyURL is nil. The Server
+	// which matches the NO_PROXY environment variable is connected
+	// to directly.
+	ProxyFromEnvironment bool
 	// CONNACKTimeout is timeout in seconds for the Client
 	// to wait for receiving the CONNACK Packet after sending
 	// the CONNECT Packet.
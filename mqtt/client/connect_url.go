@@ -0,0 +1,241 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default ports of the connection URL schemes
+const (
+	defaultTCPPort = "1883"
+	defaultTLSPort = "8883"
+	defaultWSPort  = "80"
+	defaultWSSPort = "443"
+)
+
+// Query parameters of the connection URL
+const (
+	urlQueryClientID        = "clientId"
+	urlQueryKeepAlive       = "keepAlive"
+	urlQueryClean           = "clean"
+	urlQueryCONNACKTimeout  = "connackTimeout"
+	urlQueryPINGRESPTimeout = "pingrespTimeout"
+	urlQueryWillTopic       = "willTopic"
+	urlQueryWillMessage     = "willMessage"
+	urlQueryWillQoS         = "willQos"
+	urlQueryWillRetain      = "willRetain"
+)
+
+// Error values
+var (
+	ErrUnsupportedURLScheme = errors.New("unsupported URL scheme")
+	ErrInvalidURLQuery      = errors.New("invalid URL query parameter")
+)
+
+// ParseURL parses the connection URL and returns the options for
+// the Connect method of the Client. The URL has the form of
+//
+//	scheme://[user[:password]@]host[:port][/path][?query]
+//
+// where the scheme is one of "tcp" or "mqtt", "ssl", "tls" or "mqtts"
+// for TLS, "unix", "ws" and "wss". The port defaults to 1883, 8883,
+// 80 and 443 respectively. The path is the socket file for "unix" and
+// the WebSocket endpoint for "ws" and "wss". The query parameters
+// clientId, keepAlive, clean, connackTimeout, pingrespTimeout,
+// willTopic, willMessage, willQos and willRetain set the fields of
+// the same names. The timeouts are measured in seconds. The Clean
+// Session is true unless clean is specified.
+func ParseURL(rawurl string) (*ConnectOptions, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &ConnectOptions{
+		CleanSession: true,
+	}
+
+	// Set the Network and the Address.
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		opts.Network = "tcp"
+		opts.Address = urlHost(u, defaultTCPPort)
+	case "ssl", "tls", "mqtts":
+		opts.Network = "tcp"
+		opts.Address = urlHost(u, defaultTLSPort)
+		opts.TLSConfig = &tls.Config{}
+	case "unix":
+		opts.Network = "unix"
+		opts.Address = u.Host + u.Path
+	case "ws", "wss":
+		opts.Network = u.Scheme
+		opts.Address = urlHost(u, defaultWSPort)
+
+		if u.Scheme == "wss" {
+			opts.Address = urlHost(u, defaultWSSPort)
+		}
+
+		if u.Path != "" {
+			opts.WebSocket = &WebSocketOptions{Path: u.Path}
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedURLScheme, u.Scheme)
+	}
+
+	// Set the User Name and the Password.
+	if u.User != nil {
+		opts.UserName = []byte(u.User.Username())
+
+		if password, ok := u.User.Password(); ok {
+			opts.Password = []byte(password)
+		}
+	}
+
+	// Set the query parameters.
+	for key, values := range u.Query() {
+		if err := setURLQuery(opts, key, values[len(values)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// urlHost returns the host of the URL with the default port
+// if the URL does not have a port.
+func urlHost(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// setURLQuery sets the value of the query parameter to the options.
+func setURLQuery(opts *ConnectOptions, key, value string) error {
+	var err error
+
+	switch key {
+	case urlQueryClientID:
+		opts.ClientID = []byte(value)
+	case urlQueryKeepAlive:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 16)
+		opts.KeepAlive = uint16(n)
+	case urlQueryClean:
+		opts.CleanSession, err = strconv.ParseBool(value)
+	case urlQueryCONNACKTimeout:
+		opts.CONNACKTimeout, err = parseURLSeconds(value)
+	case urlQueryPINGRESPTimeout:
+		opts.PINGRESPTimeout, err = parseURLSeconds(value)
+	case urlQueryWillTopic:
+		opts.WillTopic = []byte(value)
+	case urlQueryWillMessage:
+		opts.WillMessage = []byte(value)
+	case urlQueryWillQoS:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 8)
+		opts.WillQoS = byte(n)
+	case urlQueryWillRetain:
+		opts.WillRetain, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidURLQuery, key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidURLQuery, key, err)
+	}
+
+	return nil
+}
+
+// parseURLSeconds parses the number of seconds.
+func parseURLSeconds(value string) (time.Duration, error) {
+	n, err := strconv.ParseUint(value, 10, 32)
+	return time.Duration(n), err
+}
+
+// String returns the connection URL of the options which ParseURL
+// accepts. The Password is redacted.
+func (opts *ConnectOptions) String() string {
+	u := &url.URL{
+		Scheme: opts.Network,
+		Host:   opts.Address,
+	}
+
+	// Set the scheme and the host.
+	switch opts.Network {
+	case "", "tcp":
+		u.Scheme = "mqtt"
+
+		if opts.TLSConfig != nil {
+			u.Scheme = "mqtts"
+		}
+	case "unix":
+		u.Host = ""
+		u.Path = opts.Address
+	case "ws", "wss":
+		u.Path = opts.WebSocket.path()
+	}
+
+	// Use the Address as it is if it is a URL.
+	if a, err := url.Parse(opts.Address); err == nil && strings.Contains(opts.Address, "://") {
+		u = a
+	}
+
+	// Set the User Name and the Password.
+	if len(opts.Password) > 0 {
+		u.User = url.UserPassword(string(opts.UserName), string(opts.Password))
+	} else if len(opts.UserName) > 0 {
+		u.User = url.User(string(opts.UserName))
+	}
+
+	// Set the query parameters.
+	q := make(url.Values)
+
+	if len(opts.ClientID) > 0 {
+		q.Set(urlQueryClientID, string(opts.ClientID))
+	}
+
+	if opts.KeepAlive > 0 {
+		q.Set(urlQueryKeepAlive, strconv.Itoa(int(opts.KeepAlive)))
+	}
+
+	if !opts.CleanSession {
+		q.Set(urlQueryClean, "false")
+	}
+
+	if opts.CONNACKTimeout > 0 {
+		q.Set(urlQueryCONNACKTimeout, strconv.FormatInt(int64(opts.CONNACKTimeout), 10))
+	}
+
+	if opts.PINGRESPTimeout > 0 {
+		q.Set(urlQueryPINGRESPTimeout, strconv.FormatInt(int64(opts.PINGRESPTimeout), 10))
+	}
+
+	if len(opts.WillTopic) > 0 {
+		q.Set(urlQueryWillTopic, string(opts.WillTopic))
+	}
+
+	if len(opts.WillMessage) > 0 {
+		q.Set(urlQueryWillMessage, string(opts.WillMessage))
+	}
+
+	if opts.WillQoS > 0 {
+		q.Set(urlQueryWillQoS, strconv.Itoa(int(opts.WillQoS)))
+	}
+
+	if opts.WillRetain {
+		q.Set(urlQueryWillRetain, "true")
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.Redacted()
+}
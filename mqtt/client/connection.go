@@ -2,9 +2,13 @@ package client
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"net"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/yosssi/gmq/mqtt/packet"
 )
@@ -15,25 +19,33 @@ const sendBufSize = 1024
 // connection represents a Network Connection.
 type connection struct {
 	net.Conn
-	// r is the buffered reader.
-	r *bufio.Reader
-	// w is the buffered writer.
-	w *bufio.Writer
+	// r is the reader of the Packets.
+	r *packet.Reader
 	// disconnected is true if the Network Connection
 	// has been disconnected by the Client.
 	disconnected bool
+	// sessionPresent is the Session Present of
+	// the CONNACK Packet sent from the Server.
+	sessionPresent bool
+	// address is the address of the Server which
+	// the Network Connection is established to.
+	address string
+
+	// muWrite is the Mutex which serializes
+	// the writes of the Packets.
+	muWrite sync.Mutex
 
 	// wg is the Wait Group for the goroutines
 	// which are launched by the Connect method.
 	wg sync.WaitGroup
-	// connack is the channel which handles the signal
-	// to notify the arrival of the CONNACK Packet.
-	connack chan struct{}
 	// send is the channel which handles the Packet.
 	send chan packet.Packet
 	// sendEnd is the channel which ends the goroutine
 	// which sends a Packet to the Server.
 	sendEnd chan struct{}
+	// sendDone is closed when the goroutine which
+	// sends a Packet to the Server ends.
+	sendDone chan struct{}
 
 	// muPINGRESPs is the Mutex for pingresps.
 	muPINGRESPs sync.RWMutex
@@ -42,26 +54,251 @@ type connection struct {
 	// the PINGRESP Packet.
 	pingresps []chan struct{}
 
+	// muTokens is the Mutex for tokens.
+	muTokens sync.Mutex
+	// tokens contains the pairs of the Packet Identifier and
+	// the Token which the Client completes on the acknowledgment.
+	tokens map[uint16]*Token
+	// subTokens contains the pairs of the Packet Identifier and
+	// the SubscribeToken which receives the results of the SUBACK Packet.
+	// The Token of each SubscribeToken is also registered to tokens.
+	subTokens map[uint16]*SubscribeToken
+	// writeTokens contains the pairs of the Packet and the Token
+	// which the Client completes when the Packet is written.
+	writeTokens map[packet.Packet]*Token
+
 	// unackSubs contains the subscription information
 	// which are not acknowledged by the Server.
-	unackSubs map[string]MessageHandler
+	unackSubs map[string]*SubReq
 	// ackedSubs contains the subscription information
 	// which are acknowledged by the Server.
-	ackedSubs map[string]MessageHandler
+	ackedSubs map[string]*SubReq
+	// ackedSubTrie is the index of ackedSubs
+	// for matching the Topic Names.
+	ackedSubTrie *subTrie
+}
+
+// addToken registers a Token of the Packet which
+// has the Packet Identifier and returns it.
+func (c *connection) addToken(id uint16) *Token {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	// Create a Token.
+	t := newToken()
+
+	// Set the Token to tokens.
+	c.tokens[id] = t
+
+	return t
+}
+
+// addSubToken registers a SubscribeToken of the SUBSCRIBE Packet
+// which has the Packet Identifier and returns it.
+func (c *connection) addSubToken(id uint16) *SubscribeToken {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	// Create a SubscribeToken.
+	t := newSubscribeToken()
+
+	// Create subTokens if it does not exist.
+	if c.subTokens == nil {
+		c.subTokens = make(map[uint16]*SubscribeToken)
+	}
+
+	// Set the SubscribeToken to tokens and subTokens.
+	c.tokens[id] = t.Token
+	c.subTokens[id] = t
+
+	return t
+}
+
+// addWriteToken registers a Token which is completed
+// when the Packet is written and returns it.
+func (c *connection) addWriteToken(p packet.Packet) *Token {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	// Create a Token.
+	t := newToken()
+
+	// Create writeTokens if it does not exist.
+	if c.writeTokens == nil {
+		c.writeTokens = make(map[packet.Packet]*Token)
+	}
+
+	// Set the Token to writeTokens.
+	c.writeTokens[p] = t
+
+	return t
+}
+
+// removeWriteToken unregisters the Token of the Packet
+// which is completed when the Packet is written.
+func (c *connection) removeWriteToken(p packet.Packet) {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	delete(c.writeTokens, p)
+}
+
+// completeWriteToken completes the Token of the written
+// Packet with the error if it is registered.
+func (c *connection) completeWriteToken(p packet.Packet, err error) {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	if t, exist := c.writeTokens[p]; exist {
+		t.complete(err)
+		delete(c.writeTokens, p)
+	}
+}
+
+// removeToken unregisters the Token of the Packet
+// which has the Packet Identifier.
+func (c *connection) removeToken(id uint16) {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	delete(c.tokens, id)
+	delete(c.subTokens, id)
 }
 
-// newConnection connects to the address on the named network,
-// creates a Network Connection and returns it.
-func newConnection(network, address string, tlsConfig *tls.Config) (*connection, error) {
+// completeToken completes the Token of the Packet
+// which has the Packet Identifier if it is registered.
+func (c *connection) completeToken(id uint16, err error) {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	if t, exist := c.tokens[id]; exist {
+		t.complete(err)
+		delete(c.tokens, id)
+		delete(c.subTokens, id)
+	}
+}
+
+// addAckedSub sets the subscription information to ackedSubs
+// and its index.
+func (c *connection) addAckedSub(topicFilter string, s *SubReq) {
+	// Create ackedSubs and its index if they do not exist.
+	if c.ackedSubs == nil {
+		c.ackedSubs = make(map[string]*SubReq)
+	}
+
+	if c.ackedSubTrie == nil {
+		c.ackedSubTrie = newSubTrie()
+	}
+
+	c.ackedSubs[topicFilter] = s
+	c.ackedSubTrie.add(topicFilter, s)
+}
+
+// removeAckedSub deletes the subscription information
+// from ackedSubs and its index.
+func (c *connection) removeAckedSub(topicFilter string) {
+	delete(c.ackedSubs, topicFilter)
+
+	if c.ackedSubTrie != nil {
+		c.ackedSubTrie.remove(topicFilter)
+	}
+}
+
+// removeUnackSubs deletes the subscription information of
+// the subscription requests from unackSubs unless it has been
+// replaced by the later one.
+func (c *connection) removeUnackSubs(subReqs []*SubReq) {
+	for _, s := range subReqs {
+		topicFilter := string(s.TopicFilter)
+
+		if c.unackSubs[topicFilter] == s {
+			delete(c.unackSubs, topicFilter)
+		}
+	}
+}
+
+// completeSubToken sets the results of the subscription requests
+// to the SubscribeToken of the SUBSCRIBE Packet which has the Packet
+// Identifier and completes it if it is registered.
+func (c *connection) completeSubToken(id uint16, results []*SubResult) {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	if t, exist := c.subTokens[id]; exist {
+		t.results = results
+		t.complete(nil)
+		delete(c.tokens, id)
+		delete(c.subTokens, id)
+	}
+}
+
+// completeTokens completes all registered Tokens with the error.
+func (c *connection) completeTokens(err error) {
+	// Lock for updating tokens.
+	c.muTokens.Lock()
+
+	// Unlock.
+	defer c.muTokens.Unlock()
+
+	for id, t := range c.tokens {
+		t.complete(err)
+		delete(c.tokens, id)
+	}
+
+	for id := range c.subTokens {
+		delete(c.subTokens, id)
+	}
+
+	for p, t := range c.writeTokens {
+		t.complete(err)
+		delete(c.writeTokens, p)
+	}
+}
+
+// newConnection connects to the Server according to the options,
+// creates a Network Connection whose Packets are read with the reader
+// options and returns it. The default reader is used if readerOpts
+// is nil. Connecting, the proxy tunneling, the TLS handshake and the
+// WebSocket opening handshake are interrupted when the context is done.
+func newConnection(ctx context.Context, opts *ConnectOptions, readerOpts *packet.ReaderOptions) (*connection, error) {
+	// Get the Dialer.
+	dialer, err := connectDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Define the local variables.
 	var conn net.Conn
-	var err error
 
-	// Connect to the address on the named network.
-	if tlsConfig != nil {
-		conn, err = tls.Dial(network, address, tlsConfig)
+	// Connect to the Server.
+	if secure, host, path, ok := webSocketTarget(opts); ok {
+		conn, err = dialWebSocket(ctx, dialer, opts, secure, host, path)
 	} else {
-		conn, err = net.Dial(network, address)
+		conn, err = dial(ctx, dialer, opts.Network, opts.Address, opts.TLSConfig)
 	}
 	if err != nil {
 		return nil, err
@@ -69,16 +306,200 @@ func newConnection(network, address string, tlsConfig *tls.Config) (*connection,
 
 	// Create a Network Connection.
 	c := &connection{
-		Conn:      conn,
-		r:         bufio.NewReader(conn),
-		w:         bufio.NewWriter(conn),
-		connack:   make(chan struct{}, 1),
-		send:      make(chan packet.Packet, sendBufSize),
-		sendEnd:   make(chan struct{}, 1),
-		unackSubs: make(map[string]MessageHandler),
-		ackedSubs: make(map[string]MessageHandler),
+		Conn:         conn,
+		r:            packet.NewReader(bufio.NewReader(conn), readerOpts),
+		send:         make(chan packet.Packet, sendBufSize),
+		sendEnd:      make(chan struct{}, 1),
+		sendDone:     make(chan struct{}),
+		tokens:       make(map[uint16]*Token),
+		unackSubs:    make(map[string]*SubReq),
+		ackedSubs:    make(map[string]*SubReq),
+		ackedSubTrie: newSubTrie(),
 	}
 
 	// Return the Network Connection.
 	return c, nil
 }
+
+// connectDialer returns the Dialer of the options or the built-in
+// dialer if the options have no Dialer. The returned Dialer connects
+// through the proxy if the options specify it.
+func connectDialer(opts *ConnectOptions) (Dialer, error) {
+	// Use the built-in dialer if no dialer is specified.
+	dialer := opts.Dialer
+
+	if dialer == nil {
+		dialer = (&net.Dialer{}).DialContext
+	}
+
+	// Get the address which the Dialer connects to.
+	address := opts.Address
+
+	if _, host, _, ok := webSocketTarget(opts); ok {
+		address = host
+	}
+
+	// Get the URL of the proxy.
+	u, err := proxyURL(opts, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		return dialer, nil
+	}
+
+	return proxyDialer(u, dialer)
+}
+
+// dial connects to the address on the named network with the dialer
+// and returns the connection. TLS is applied on top of the connection
+// if tlsConfig is not nil.
+func dial(ctx context.Context, dialer Dialer, network, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	// Connect to the address on the named network.
+	conn, err := dialer(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply TLS to the connection.
+	if tlsConfig != nil {
+		return tlsClient(ctx, conn, address, tlsConfig)
+	}
+
+	return conn, nil
+}
+
+// dialWebSocket connects to the host over TCP, performs the opening
+// handshake of WebSocket and returns the WebSocket connection. TLS is
+// applied if secure is true.
+func dialWebSocket(ctx context.Context, dialer Dialer, opts *ConnectOptions, secure bool, host, path string) (net.Conn, error) {
+	// Define the configuration for the TLS connection.
+	var tlsConfig *tls.Config
+
+	if secure {
+		tlsConfig = opts.TLSConfig
+
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+	}
+
+	// Connect to the host.
+	conn, err := dial(ctx, dialer, "tcp", host, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Perform the opening handshake.
+	wsConn, err := newWebSocketConn(ctx, conn, secure, host, path, opts.WebSocket.header())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return wsConn, nil
+}
+
+// webSocketTarget returns whether TLS is used, the host and the path
+// of the WebSocket endpoint if the options specify the connection over
+// WebSocket by the Network "ws" or "wss" or by the Address which is
+// a URL of the scheme "ws" or "wss".
+func webSocketTarget(opts *ConnectOptions) (bool, string, string, bool) {
+	// Parse the Address if it is a URL.
+	if strings.HasPrefix(opts.Address, "ws://") || strings.HasPrefix(opts.Address, "wss://") {
+		u, err := url.Parse(opts.Address)
+		if err != nil {
+			return false, "", "", false
+		}
+
+		path := u.Path
+		if path == "" {
+			path = opts.WebSocket.path()
+		}
+
+		return u.Scheme == "wss", webSocketHost(u.Host, u.Scheme == "wss"), path, true
+	}
+
+	switch opts.Network {
+	case "ws", "wss":
+		return opts.Network == "wss", webSocketHost(opts.Address, opts.Network == "wss"), opts.WebSocket.path(), true
+	}
+
+	return false, "", "", false
+}
+
+// webSocketHost returns the host with the default port
+// of HTTP or HTTPS if it does not have a port.
+func webSocketHost(host string, secure bool) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	if secure {
+		return net.JoinHostPort(host, "443")
+	}
+
+	return net.JoinHostPort(host, "80")
+}
+
+// tlsClient performs the TLS handshake on the connection and returns
+// the TLS connection. The Server Name is taken from the address if the
+// configuration does not have it, so that it is sent to the Server even
+// if the verification is skipped. The connection is closed if the
+// handshake fails.
+func tlsClient(ctx context.Context, conn net.Conn, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	// Set the Server Name to the configuration.
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	// Perform the TLS handshake.
+	tlsConn := tls.Client(conn, tlsConfig)
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// watchContext interrupts the reading and writing of the connection
+// when the context is done. It returns the function which stops
+// watching the context and clears the deadline of the connection.
+func watchContext(ctx context.Context, conn net.Conn) func() {
+	// Do nothing if the context is never done.
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	// Create the channels which handle the signals to end
+	// the watching goroutine and to notify its end.
+	endc := make(chan struct{})
+	endedc := make(chan struct{})
+
+	go func() {
+		defer close(endedc)
+
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-endc:
+		}
+	}()
+
+	return func() {
+		close(endc)
+		<-endedc
+
+		// Clear the deadline which the watching goroutine may set.
+		conn.SetDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,6 @@
+package client
+
+// ConnectionLostHandler is the handler which is called when
+// the Network Connection is lost without calling the Disconnect
+// method. err is the cause of the loss.
+type ConnectionLostHandler func(err error)
@@ -1,24 +1,130 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 const testAddress = "iot.eclipse.org:1883"
 
 func Test_newConnection_tlsErr(t *testing.T) {
-	if _, err := newConnection("", "", &tls.Config{}); err == nil {
+	if _, err := newConnection(context.Background(), &ConnectOptions{TLSConfig: &tls.Config{}}, nil); err == nil {
 		notNilErrorExpected(t)
 	}
 }
 
 func Test_newConnection(t *testing.T) {
-	if _, err := newConnection("tcp", testAddress, nil); err != nil {
+	if _, err := newConnection(context.Background(), &ConnectOptions{Network: "tcp", Address: testAddress}, nil); err != nil {
 		nilErrorExpected(t, err)
 	}
 }
 
+func Test_newConnection_dialErr(t *testing.T) {
+	dial := func(_ context.Context, _, _ string) (net.Conn, error) {
+		return nil, errTest
+	}
+
+	if _, err := newConnection(context.Background(), &ConnectOptions{Network: "tcp", Address: "localhost:1883", Dialer: dial}, nil); err != errTest {
+		invalidError(t, err, errTest)
+	}
+}
+
+func Test_newConnection_dialerTLS(t *testing.T) {
+	// Borrow the certificate of the test server.
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: srv.TLS.Certificates,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		conn.Write([]byte("test"))
+		io.Copy(ioutil.Discard, conn)
+		conn.Close()
+	}()
+
+	var dialed bool
+
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = true
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	c, err := newConnection(context.Background(), &ConnectOptions{
+		Network:   "tcp",
+		Address:   ln.Addr().String(),
+		TLSConfig: tlsConfig,
+		Dialer:    dial,
+	}, nil)
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer c.Close()
+
+	if !dialed {
+		t.Error("the dialer should be used")
+	}
+
+	if _, ok := c.Conn.(*tls.Conn); !ok {
+		t.Errorf("c.Conn => %T, want => *tls.Conn", c.Conn)
+	}
+
+	b := make([]byte, 4)
+
+	if _, err := io.ReadFull(c.Conn, b); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if string(b) != "test" {
+		t.Errorf("b => %q, want => %q", b, "test")
+	}
+}
+
+func Test_newConnection_dialerTLSErr(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go io.Copy(ioutil.Discard, server)
+
+	dial := func(_ context.Context, _, _ string) (net.Conn, error) {
+		return client, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := newConnection(ctx, &ConnectOptions{
+		Network:   "tcp",
+		Address:   "localhost:1883",
+		TLSConfig: &tls.Config{},
+		Dialer:    dial,
+	}, nil); err == nil {
+		notNilErrorExpected(t)
+	}
+}
+
 func notNilErrorExpected(t *testing.T) {
 	t.Error("err => nil, want => not nil")
 }
@@ -26,3 +132,29 @@ func notNilErrorExpected(t *testing.T) {
 func nilErrorExpected(t *testing.T, err error) {
 	t.Errorf("err => %q, want => nil", err)
 }
+
+func Test_tlsClient_insecureSkipVerify(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+
+	serverNames := make(chan string, 1)
+
+	// Record the Server Name sent from the client and fail the handshake.
+	go func() {
+		defer serverConn.Close()
+
+		tls.Server(serverConn, &tls.Config{
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverNames <- hello.ServerName
+				return nil, errTest
+			},
+		}).Handshake()
+	}()
+
+	if _, err := tlsClient(context.Background(), clientConn, "example.com:8883", &tls.Config{InsecureSkipVerify: true}); err == nil {
+		notNilErrorExpected(t)
+	}
+
+	if serverName := <-serverNames; serverName != "example.com" {
+		t.Errorf("serverName => %q, want => %q", serverName, "example.com")
+	}
+}
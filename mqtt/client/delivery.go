@@ -0,0 +1,15 @@
+package client
+
+// delivery represents an Application Message which
+// is delivered to a message handler.
+type delivery struct {
+	// fn is the message handler.
+	fn MessageFunc
+	// msg is the Application Message.
+	msg *Message
+}
+
+// run executes the message handler with the Application Message.
+func (dl *delivery) run() {
+	dl.fn(dl.msg)
+}
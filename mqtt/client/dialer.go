@@ -0,0 +1,11 @@
+package client
+
+import (
+	"context"
+	"net"
+)
+
+// Dialer is the function which connects to the address
+// on the named network. The context is done when the
+// connection should be interrupted.
+type Dialer func(ctx context.Context, network, address string) (net.Conn, error)
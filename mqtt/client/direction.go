@@ -0,0 +1,20 @@
+package client
+
+// Direction represents the direction of the in-flight Packets
+// of a Session.
+type Direction byte
+
+// Directions
+const (
+	// DirectionSending is the direction of the Packets which
+	// are sent to the Server and not yet acknowledged.
+	DirectionSending Direction = iota
+	// DirectionReceiving is the direction of the Packets which
+	// are received from the Server and not yet acknowledged.
+	DirectionReceiving
+)
+
+// valid returns true if the Direction is valid.
+func (dir Direction) valid() bool {
+	return dir == DirectionSending || dir == DirectionReceiving
+}
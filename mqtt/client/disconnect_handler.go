@@ -0,0 +1,5 @@
+package client
+
+// DisconnectHandler is the handler which is called after
+// the Disconnect method disconnects the Network Connection.
+type DisconnectHandler func()
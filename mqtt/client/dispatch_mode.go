@@ -0,0 +1,20 @@
+package client
+
+// DispatchMode represents how the Application Messages
+// are dispatched to the message handlers.
+type DispatchMode byte
+
+// Dispatch modes
+const (
+	// DispatchConcurrent executes each message handler on its own
+	// goroutine. The order of the Application Messages is not kept.
+	DispatchConcurrent DispatchMode = iota
+	// DispatchOrderedPerSubscription executes the message handler of
+	// each subscription with the Application Messages in the order
+	// of their arrival.
+	DispatchOrderedPerSubscription
+	// DispatchOrderedPerTopic executes the message handlers with
+	// the Application Messages of each Topic Name in the order of
+	// their arrival.
+	DispatchOrderedPerTopic
+)
@@ -0,0 +1,44 @@
+package client
+
+import "runtime"
+
+// Default values
+const (
+	defaultDispatchQueueSize = 1024
+)
+
+// DispatchOptions represents options for dispatching
+// the Application Messages to the message handlers.
+type DispatchOptions struct {
+	// Mode is the dispatch mode.
+	Mode DispatchMode
+	// Workers is the number of the goroutines which execute
+	// the message handlers in the ordered modes. The number of
+	// the CPUs is used if this property is zero.
+	Workers int
+	// QueueSize is the capacity of the queue of each worker in
+	// the ordered modes and the maximum number of the message
+	// handlers running at once in the concurrent mode.
+	// 1024 is used if this property is zero.
+	QueueSize int
+	// QueueFullPolicy is the policy applied when the queue is full.
+	QueueFullPolicy QueueFullPolicy
+}
+
+// workers returns the number of the workers.
+func (opts *DispatchOptions) workers() int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+
+	return runtime.NumCPU()
+}
+
+// queueSize returns the capacity of the queue.
+func (opts *DispatchOptions) queueSize() int {
+	if opts.QueueSize > 0 {
+		return opts.QueueSize
+	}
+
+	return defaultDispatchQueueSize
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestDispatchOptions_workers(t *testing.T) {
+	if n := (&DispatchOptions{}).workers(); n != runtime.NumCPU() {
+		t.Errorf("n => %d, want => %d", n, runtime.NumCPU())
+	}
+
+	if n := (&DispatchOptions{Workers: 3}).workers(); n != 3 {
+		t.Errorf("n => %d, want => 3", n)
+	}
+}
+
+func TestDispatchOptions_queueSize(t *testing.T) {
+	if n := (&DispatchOptions{}).queueSize(); n != defaultDispatchQueueSize {
+		t.Errorf("n => %d, want => %d", n, defaultDispatchQueueSize)
+	}
+
+	if n := (&DispatchOptions{QueueSize: 3}).queueSize(); n != 3 {
+		t.Errorf("n => %d, want => 3", n)
+	}
+}
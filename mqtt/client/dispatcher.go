@@ -0,0 +1,184 @@
+package client
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+// Error value
+var ErrMessageDropped = errors.New("the Application Message was dropped because the dispatch queue was full")
+
+// dispatcher dispatches the Application Messages
+// to the message handlers.
+type dispatcher struct {
+	// mode is the dispatch mode.
+	mode DispatchMode
+	// policy is the policy applied when the queue is full.
+	policy QueueFullPolicy
+	// queues is the queues of the workers in the ordered modes.
+	queues []chan *delivery
+	// sem limits the number of the message handlers
+	// running at once in the concurrent mode.
+	sem chan struct{}
+	// errorHandler is the error handler.
+	errorHandler ErrorHandler
+	// wg is the Wait Group for the workers.
+	wg sync.WaitGroup
+	// endc is closed when the dispatcher is closed.
+	endc chan struct{}
+	// closeOnce closes endc only once.
+	closeOnce sync.Once
+}
+
+// dispatch dispatches the Application Message to the message handler
+// of the subscription. It returns false if the Application Message is
+// dropped or the dispatcher is closed.
+func (d *dispatcher) dispatch(s *SubReq, msg Message) bool {
+	// Set the Topic Filter of the subscription to the Message.
+	msg.TopicFilter = s.TopicFilter
+
+	dl := &delivery{
+		fn:  s.messageFunc(),
+		msg: &msg,
+	}
+
+	switch d.mode {
+	case DispatchOrderedPerSubscription:
+		return d.enqueue(d.queues[d.index(s.TopicFilter)], dl)
+	case DispatchOrderedPerTopic:
+		return d.enqueue(d.queues[d.index(msg.TopicName)], dl)
+	default:
+		return d.launch(dl)
+	}
+}
+
+// enqueue puts the delivery into the queue according to the policy.
+// It returns false if the delivery is not put into the queue.
+func (d *dispatcher) enqueue(q chan *delivery, dl *delivery) bool {
+	if d.policy == QueueFullDrop {
+		select {
+		case q <- dl:
+			return true
+		case <-d.endc:
+			return false
+		default:
+			d.drop()
+			return false
+		}
+	}
+
+	select {
+	case q <- dl:
+		return true
+	case <-d.endc:
+		return false
+	}
+}
+
+// launch executes the message handler on a new goroutine if the
+// number of the running handlers allows it. It returns false if
+// the message handler is not executed.
+func (d *dispatcher) launch(dl *delivery) bool {
+	if d.policy == QueueFullDrop {
+		select {
+		case d.sem <- struct{}{}:
+		case <-d.endc:
+			return false
+		default:
+			d.drop()
+			return false
+		}
+	} else {
+		select {
+		case d.sem <- struct{}{}:
+		case <-d.endc:
+			return false
+		}
+	}
+
+	go func() {
+		defer func() {
+			<-d.sem
+		}()
+
+		dl.run()
+	}()
+
+	return true
+}
+
+// drop notifies the drop of an Application Message.
+func (d *dispatcher) drop() {
+	if d.errorHandler != nil {
+		d.errorHandler(ErrMessageDropped)
+	}
+}
+
+// index returns the index of the queue for the key.
+func (d *dispatcher) index(key []byte) int {
+	h := fnv.New32a()
+
+	h.Write(key)
+
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// work executes the message handlers with the Application
+// Messages of the queue one by one.
+func (d *dispatcher) work(q chan *delivery) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case dl := <-q:
+			dl.run()
+		case <-d.endc:
+			return
+		}
+	}
+}
+
+// close stops the workers and waits for them to end.
+// The Application Messages left in the queues are discarded.
+func (d *dispatcher) close() {
+	d.closeOnce.Do(func() {
+		close(d.endc)
+	})
+
+	d.wg.Wait()
+}
+
+// newDispatcher creates a dispatcher, launches its workers
+// and returns it.
+func newDispatcher(opts *DispatchOptions, errorHandler ErrorHandler) *dispatcher {
+	// Initialize the options.
+	if opts == nil {
+		opts = &DispatchOptions{}
+	}
+
+	// Create a dispatcher.
+	d := &dispatcher{
+		mode:         opts.Mode,
+		policy:       opts.QueueFullPolicy,
+		errorHandler: errorHandler,
+		endc:         make(chan struct{}),
+	}
+
+	switch d.mode {
+	case DispatchOrderedPerSubscription, DispatchOrderedPerTopic:
+		// Launch the workers.
+		d.queues = make([]chan *delivery, opts.workers())
+
+		for i := range d.queues {
+			d.queues[i] = make(chan *delivery, opts.queueSize())
+
+			d.wg.Add(1)
+			go d.work(d.queues[i])
+		}
+	default:
+		d.sem = make(chan struct{}, opts.queueSize())
+	}
+
+	return d
+}
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_dispatcher_dispatch_orderedPerTopic(t *testing.T) {
+	testDispatcherOrder(t, DispatchOrderedPerTopic)
+}
+
+func Test_dispatcher_dispatch_orderedPerSubscription(t *testing.T) {
+	testDispatcherOrder(t, DispatchOrderedPerSubscription)
+}
+
+func Test_dispatcher_dispatch_concurrent(t *testing.T) {
+	d := newDispatcher(nil, nil)
+	defer d.close()
+
+	var wg sync.WaitGroup
+
+	wg.Add(10)
+
+	s := &SubReq{
+		TopicFilter: []byte("a/#"),
+		Handler: func(_, _ []byte) {
+			wg.Done()
+		},
+	}
+
+	for i := 0; i < 10; i++ {
+		d.dispatch(s, Message{TopicName: []byte("a/b")})
+	}
+
+	wg.Wait()
+}
+
+func Test_dispatcher_dispatch_QueueFullDrop(t *testing.T) {
+	for _, mode := range []DispatchMode{DispatchConcurrent, DispatchOrderedPerTopic} {
+		errc := make(chan error, 1)
+
+		d := newDispatcher(&DispatchOptions{
+			Mode:            mode,
+			Workers:         1,
+			QueueSize:       1,
+			QueueFullPolicy: QueueFullDrop,
+		}, func(err error) {
+			errc <- err
+		})
+
+		startc := make(chan struct{}, 3)
+		blockc := make(chan struct{})
+
+		s := &SubReq{
+			TopicFilter: []byte("a/b"),
+			Handler: func(_, _ []byte) {
+				startc <- struct{}{}
+				<-blockc
+			},
+		}
+
+		// Occupy the handler.
+		d.dispatch(s, Message{TopicName: []byte("a/b")})
+
+		<-startc
+
+		// Fill the queue in the ordered mode.
+		if mode == DispatchOrderedPerTopic {
+			d.dispatch(s, Message{TopicName: []byte("a/b")})
+		}
+
+		d.dispatch(s, Message{TopicName: []byte("a/b")})
+
+		select {
+		case err := <-errc:
+			if err != ErrMessageDropped {
+				invalidError(t, err, ErrMessageDropped)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("mode %d: the drop was not notified", mode)
+		}
+
+		close(blockc)
+
+		d.close()
+	}
+}
+
+func Test_dispatcher_dispatch_QueueFullBlock(t *testing.T) {
+	d := newDispatcher(&DispatchOptions{
+		Mode:      DispatchOrderedPerTopic,
+		Workers:   1,
+		QueueSize: 1,
+	}, nil)
+
+	startc := make(chan struct{}, 3)
+	blockc := make(chan struct{})
+
+	s := &SubReq{
+		TopicFilter: []byte("a/b"),
+		Handler: func(_, _ []byte) {
+			startc <- struct{}{}
+			<-blockc
+		},
+	}
+
+	// Occupy the worker and fill the queue.
+	d.dispatch(s, Message{TopicName: []byte("a/b")})
+
+	<-startc
+
+	d.dispatch(s, Message{TopicName: []byte("a/b")})
+
+	dispatchedc := make(chan struct{})
+
+	go func() {
+		d.dispatch(s, Message{TopicName: []byte("a/b")})
+		close(dispatchedc)
+	}()
+
+	select {
+	case <-dispatchedc:
+		t.Error("the dispatch should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Free the worker.
+	close(blockc)
+
+	select {
+	case <-dispatchedc:
+	case <-time.After(5 * time.Second):
+		t.Error("the dispatch should end after the queue has room")
+	}
+
+	d.close()
+}
+
+func Test_dispatcher_close(t *testing.T) {
+	d := newDispatcher(&DispatchOptions{
+		Mode:      DispatchOrderedPerTopic,
+		Workers:   1,
+		QueueSize: 1,
+	}, nil)
+
+	blockc := make(chan struct{})
+
+	s := &SubReq{
+		TopicFilter: []byte("a/b"),
+		Handler: func(_, _ []byte) {
+			<-blockc
+		},
+	}
+
+	d.dispatch(s, Message{TopicName: []byte("a/b")})
+
+	closedc := make(chan struct{})
+
+	go func() {
+		d.close()
+		close(closedc)
+	}()
+
+	// The dispatch to the full queue ends after the close.
+	for i := 0; i < 3; i++ {
+		d.dispatch(s, Message{TopicName: []byte("a/b")})
+	}
+
+	// Free the worker so that the close ends.
+	close(blockc)
+
+	<-closedc
+}
+
+// testDispatcherOrder tests that the dispatcher keeps the order
+// of the Application Messages of each Topic Name.
+func testDispatcherOrder(t *testing.T, mode DispatchMode) {
+	d := newDispatcher(&DispatchOptions{
+		Mode:    mode,
+		Workers: 4,
+	}, nil)
+
+	defer d.close()
+
+	const n = 1000
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	received := make(map[string][]string)
+
+	wg.Add(2 * n)
+
+	handler := func(topicName, message []byte) {
+		mu.Lock()
+		received[string(topicName)] = append(received[string(topicName)], string(message))
+		mu.Unlock()
+
+		wg.Done()
+	}
+
+	for i := 0; i < n; i++ {
+		for _, topicName := range []string{"a/1", "a/2"} {
+			d.dispatch(&SubReq{
+				TopicFilter: []byte(topicName),
+				Handler:     handler,
+			}, Message{
+				TopicName: []byte(topicName),
+				Payload:   []byte(fmt.Sprint(i)),
+			})
+		}
+	}
+
+	wg.Wait()
+
+	for topicName, messages := range received {
+		for i, message := range messages {
+			if message != fmt.Sprint(i) {
+				t.Errorf("received[%q][%d] => %q, want => %q", topicName, i, message, fmt.Sprint(i))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+// Operations of the records of the log
+const (
+	fileStoreOpPut byte = iota + 1
+	fileStoreOpDelete
+	fileStoreOpReset
+)
+
+// Length of the header of a record which consists of
+// the CRC-32 checksum and the length of the body
+const lenFileStoreRecordHeader = 8
+
+// Length of the body of a record except the Packet data
+// which consists of the operation, the Direction and
+// the Packet Identifier
+const lenFileStoreRecordBody = 4
+
+// Minimum number of the records of the log to be compacted
+const minFileStoreCompactionRecords = 1024
+
+// Error values
+var (
+	ErrFileStoreClosed        = errors.New("the FileStore has already been closed")
+	ErrInvalidFileStoreRecord = errors.New("invalid FileStore record")
+	ErrInvalidFileStorePacket = errors.New("invalid FileStore Packet data")
+)
+
+// FileStore is a Store which keeps the Packets in a file so that
+// they survive the restart of the process. Each update is appended
+// to the file as a checksummed record and synced to the disk before
+// the method returns. The records which are torn by a crash are
+// discarded on the opening and the file is compacted when most of
+// its records become obsolete.
+type FileStore struct {
+	// mu is the Mutex for the fields.
+	mu sync.Mutex
+	// path is the path of the file.
+	path string
+	// f is the file which the records are appended to.
+	f *os.File
+	// records is the number of the records of the file.
+	records int
+	// packets contains the pairs of the Packet Identifier
+	// and the Packet for each Direction.
+	packets [2]map[uint16]packet.Packet
+}
+
+// Put stores the Packet which has the Packet Identifier in the direction.
+// It returns packet.ErrMessageStreamed for the PUBLISH Packet whose
+// Application Message is a MessageReader because it cannot be encoded.
+func (s *FileStore) Put(dir Direction, id uint16, p packet.Packet) error {
+	// Validate the Direction.
+	if !dir.valid() {
+		return ErrInvalidDirection
+	}
+
+	// Reject the Packet whose Application Message is streamed.
+	if publish, ok := p.(*packet.PUBLISH); ok && publish.MessageReader != nil {
+		return packet.ErrMessageStreamed
+	}
+
+	// Encode the Packet.
+	data := p.AppendTo(nil)
+
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	// Append the record to the file.
+	if err := s.append(fileStoreOpPut, dir, id, data); err != nil {
+		return err
+	}
+
+	s.packets[dir][id] = p
+
+	return s.compactIfNeeded()
+}
+
+// Get returns the Packet which has the Packet Identifier in the direction.
+func (s *FileStore) Get(dir Direction, id uint16) (packet.Packet, error) {
+	// Validate the Direction.
+	if !dir.valid() {
+		return nil, ErrInvalidDirection
+	}
+
+	// Lock for reading.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	p, exist := s.packets[dir][id]
+	if !exist {
+		return nil, ErrPacketNotStored
+	}
+
+	return p, nil
+}
+
+// Delete deletes the Packet which has the Packet Identifier in the direction.
+func (s *FileStore) Delete(dir Direction, id uint16) error {
+	// Validate the Direction.
+	if !dir.valid() {
+		return ErrInvalidDirection
+	}
+
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	// Do nothing if the Packet is not stored.
+	if _, exist := s.packets[dir][id]; !exist {
+		return nil
+	}
+
+	// Append the record to the file.
+	if err := s.append(fileStoreOpDelete, dir, id, nil); err != nil {
+		return err
+	}
+
+	delete(s.packets[dir], id)
+
+	return s.compactIfNeeded()
+}
+
+// ForEach calls the function for each Packet in the direction.
+func (s *FileStore) ForEach(dir Direction, fn func(id uint16, p packet.Packet) error) error {
+	// Validate the Direction.
+	if !dir.valid() {
+		return ErrInvalidDirection
+	}
+
+	// Lock for reading.
+	s.mu.Lock()
+
+	// Copy the Packets so that the function can update the Store.
+	packets := make(map[uint16]packet.Packet, len(s.packets[dir]))
+
+	for id, p := range s.packets[dir] {
+		packets[id] = p
+	}
+
+	// Unlock.
+	s.mu.Unlock()
+
+	for id, p := range packets {
+		if err := fn(id, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset deletes all Packets.
+func (s *FileStore) Reset() error {
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	// Append the record to the file.
+	if err := s.append(fileStoreOpReset, 0, 0, nil); err != nil {
+		return err
+	}
+
+	for dir := range s.packets {
+		s.packets[dir] = make(map[uint16]packet.Packet)
+	}
+
+	return s.compactIfNeeded()
+}
+
+// Close closes the file of the FileStore.
+func (s *FileStore) Close() error {
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrFileStoreClosed
+	}
+
+	err := s.f.Close()
+
+	s.f = nil
+
+	return err
+}
+
+// append appends a record to the file and syncs it.
+func (s *FileStore) append(op byte, dir Direction, id uint16, data []byte) error {
+	if s.f == nil {
+		return ErrFileStoreClosed
+	}
+
+	if _, err := s.f.Write(encodeFileStoreRecord(op, dir, id, data)); err != nil {
+		return err
+	}
+
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+
+	s.records++
+
+	return nil
+}
+
+// compactIfNeeded compacts the file if most of its records are obsolete.
+func (s *FileStore) compactIfNeeded() error {
+	// Count the live records.
+	live := len(s.packets[DirectionSending]) + len(s.packets[DirectionReceiving])
+
+	if s.records < minFileStoreCompactionRecords || s.records < 2*live {
+		return nil
+	}
+
+	return s.compact()
+}
+
+// compact rewrites the file so that it contains only the records of
+// the stored Packets. The new file is written to a temporary file and
+// renamed to the path so that the file is always complete.
+func (s *FileStore) compact() error {
+	// Create the content of the new file.
+	var bf bytes.Buffer
+
+	for dir, packets := range s.packets {
+		for id, p := range packets {
+			bf.Write(encodeFileStoreRecord(fileStoreOpPut, Direction(dir), id, p.AppendTo(nil)))
+		}
+	}
+
+	// Write the content to the temporary file.
+	tmp := s.path + ".tmp"
+
+	if err := writeFileSync(tmp, bf.Bytes()); err != nil {
+		return err
+	}
+
+	// Replace the file with the temporary file.
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	// Sync the directory so that the renaming is persisted.
+	if err := syncDir(filepath.Dir(s.path)); err != nil {
+		return err
+	}
+
+	// Reopen the file.
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if s.f != nil {
+		s.f.Close()
+	}
+
+	s.f = f
+
+	s.records = len(s.packets[DirectionSending]) + len(s.packets[DirectionReceiving])
+
+	return nil
+}
+
+// load reads the records from the file and applies them to the Packets.
+// The records after the first invalid one are regarded as torn by
+// a crash and the file is truncated to the end of the valid records.
+func (s *FileStore) load() error {
+	// Read the file.
+	b, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Apply the records.
+	var offset int
+
+	for offset < len(b) {
+		op, dir, id, data, n, err := decodeFileStoreRecord(b[offset:])
+		if err != nil {
+			break
+		}
+
+		switch op {
+		case fileStoreOpPut:
+			p, err := decodeFileStorePacket(data)
+			if err != nil {
+				return err
+			}
+
+			s.packets[dir][id] = p
+		case fileStoreOpDelete:
+			delete(s.packets[dir], id)
+		case fileStoreOpReset:
+			for dir := range s.packets {
+				s.packets[dir] = make(map[uint16]packet.Packet)
+			}
+		}
+
+		offset += n
+		s.records++
+	}
+
+	// Open the file.
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	// Discard the torn records.
+	if err := f.Truncate(int64(offset)); err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+
+	return nil
+}
+
+// NewFileStore opens the file of the path, creates a FileStore
+// which keeps the Packets in it and returns the FileStore.
+// The file is created if it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	// Create a FileStore.
+	s := &FileStore{
+		path: path,
+		packets: [2]map[uint16]packet.Packet{
+			make(map[uint16]packet.Packet),
+			make(map[uint16]packet.Packet),
+		},
+	}
+
+	// Load the records from the file.
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	// Compact the file if necessary.
+	if err := s.compactIfNeeded(); err != nil {
+		s.f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// encodeFileStoreRecord encodes a record and returns it.
+func encodeFileStoreRecord(op byte, dir Direction, id uint16, data []byte) []byte {
+	// Create the body.
+	body := make([]byte, lenFileStoreRecordBody, lenFileStoreRecordBody+len(data))
+
+	body[0] = op
+	body[1] = byte(dir)
+
+	binary.BigEndian.PutUint16(body[2:], id)
+
+	body = append(body, data...)
+
+	// Create the record.
+	b := make([]byte, lenFileStoreRecordHeader, lenFileStoreRecordHeader+len(body))
+
+	binary.BigEndian.PutUint32(b[0:], crc32.ChecksumIEEE(body))
+	binary.BigEndian.PutUint32(b[4:], uint32(len(body)))
+
+	return append(b, body...)
+}
+
+// decodeFileStoreRecord decodes the record at the beginning of
+// the byte data and returns its fields and length.
+func decodeFileStoreRecord(b []byte) (byte, Direction, uint16, []byte, int, error) {
+	// Check the length of the header.
+	if len(b) < lenFileStoreRecordHeader {
+		return 0, 0, 0, nil, 0, ErrInvalidFileStoreRecord
+	}
+
+	// Extract the body.
+	n := int(binary.BigEndian.Uint32(b[4:]))
+
+	if n < lenFileStoreRecordBody || len(b)-lenFileStoreRecordHeader < n {
+		return 0, 0, 0, nil, 0, ErrInvalidFileStoreRecord
+	}
+
+	body := b[lenFileStoreRecordHeader : lenFileStoreRecordHeader+n]
+
+	// Verify the checksum.
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(b[0:]) {
+		return 0, 0, 0, nil, 0, ErrInvalidFileStoreRecord
+	}
+
+	op, dir := body[0], Direction(body[1])
+
+	if op < fileStoreOpPut || op > fileStoreOpReset || (op != fileStoreOpReset && !dir.valid()) {
+		return 0, 0, 0, nil, 0, ErrInvalidFileStoreRecord
+	}
+
+	return op, dir, binary.BigEndian.Uint16(body[2:]), body[lenFileStoreRecordBody:], lenFileStoreRecordHeader + n, nil
+}
+
+// decodeFileStorePacket creates a Packet from the byte data
+// of the whole Packet and returns it.
+func decodeFileStorePacket(b []byte) (packet.Packet, error) {
+	// Find the end of the Remaining Length.
+	i := 1
+
+	for ; i < len(b) && i <= 4; i++ {
+		if b[i]&0x80 == 0 {
+			break
+		}
+	}
+
+	if i >= len(b) || i > 4 {
+		return nil, ErrInvalidFileStorePacket
+	}
+
+	// Copy the byte data so that the Packet does not
+	// share the memory with the file content.
+	b = append([]byte(nil), b...)
+
+	return packet.NewFromBytes(packet.FixedHeader(b[:i+1]), b[i+1:])
+}
+
+// writeFileSync writes the data to the file of the path and syncs it.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// syncDir syncs the directory of the path.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
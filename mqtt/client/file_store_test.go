@@ -0,0 +1,238 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt"
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+func TestFileStore_ErrInvalidDirection(t *testing.T) {
+	s := newTestFileStore(t, filepath.Join(t.TempDir(), "store"))
+	defer s.Close()
+
+	testStoreErrInvalidDirection(t, s)
+}
+
+func TestFileStore(t *testing.T) {
+	s := newTestFileStore(t, filepath.Join(t.TempDir(), "store"))
+	defer s.Close()
+
+	testStore(t, s)
+}
+
+func TestFileStore_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+
+	s := newTestFileStore(t, path)
+
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:       mqtt.QoS2,
+		Retain:    true,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+		Message:   []byte("message"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	for _, err := range []error{
+		s.Put(DirectionSending, 1, publish),
+		s.Put(DirectionSending, 2, newTestPUBREL(t, 2)),
+		s.Put(DirectionReceiving, 3, newTestPUBREL(t, 3)),
+		s.Delete(DirectionSending, 2),
+		s.Close(),
+	} {
+		if err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+	}
+
+	s = newTestFileStore(t, path)
+	defer s.Close()
+
+	p, err := s.Get(DirectionSending, 1)
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	got := p.(*packet.PUBLISH)
+
+	if got.QoS != mqtt.QoS2 || got.PacketID != 1 || string(got.TopicName) != "a/b" || string(got.Message) != "message" {
+		t.Errorf("s.Get(DirectionSending, 1) => %+v, want => %+v", got, publish)
+	}
+
+	if _, err := s.Get(DirectionSending, 2); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+
+	if _, err := s.Get(DirectionReceiving, 3); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestFileStore_tornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+
+	s := newTestFileStore(t, path)
+
+	if err := s.Put(DirectionSending, 1, newTestPUBREL(t, 1)); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := s.Close(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// Append a record which is torn by a crash.
+	torn := encodeFileStoreRecord(fileStoreOpPut, DirectionSending, 2, []byte{packet.TypePUBREL<<4 | 0x02, 0x02, 0x00, 0x02})
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	f.Write(torn[:len(torn)-1])
+	f.Close()
+
+	s = newTestFileStore(t, path)
+	defer s.Close()
+
+	if _, err := s.Get(DirectionSending, 1); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := s.Get(DirectionSending, 2); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+
+	if fi2, err := os.Stat(path); err != nil || fi2.Size() != fi.Size() {
+		t.Errorf("the torn record should be truncated")
+	}
+
+	// Append a record after the truncation.
+	if err := s.Put(DirectionSending, 3, newTestPUBREL(t, 3)); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestFileStore_compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+
+	s := newTestFileStore(t, path)
+	defer s.Close()
+
+	pubrel := newTestPUBREL(t, 1)
+
+	for i := 0; i < minFileStoreCompactionRecords; i++ {
+		if err := s.Put(DirectionSending, 1, pubrel); err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+	}
+
+	if s.records != 1 {
+		t.Errorf("s.records => %d, want => 1", s.records)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("the temporary file should not exist")
+	}
+
+	if err := s.Put(DirectionSending, 2, newTestPUBREL(t, 2)); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	s.Close()
+
+	s = newTestFileStore(t, path)
+
+	for _, id := range []uint16{1, 2} {
+		if _, err := s.Get(DirectionSending, id); err != nil {
+			nilErrorExpected(t, err)
+		}
+	}
+}
+
+func TestFileStore_ErrFileStoreClosed(t *testing.T) {
+	s := newTestFileStore(t, filepath.Join(t.TempDir(), "store"))
+
+	s.Close()
+
+	if err := s.Close(); err != ErrFileStoreClosed {
+		invalidError(t, err, ErrFileStoreClosed)
+	}
+
+	if err := s.Put(DirectionSending, 1, newTestPUBREL(t, 1)); err != ErrFileStoreClosed {
+		invalidError(t, err, ErrFileStoreClosed)
+	}
+}
+
+func TestFileStore_ErrMessageStreamed(t *testing.T) {
+	s := newTestFileStore(t, filepath.Join(t.TempDir(), "store"))
+	defer s.Close()
+
+	p, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:           mqtt.QoS1,
+		PacketID:      1,
+		TopicName:     []byte("a"),
+		MessageReader: bytes.NewReader([]byte("message")),
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := s.Put(DirectionSending, 1, p); err != packet.ErrMessageStreamed {
+		invalidError(t, err, packet.ErrMessageStreamed)
+	}
+}
+
+func TestNewFileStore_ErrInvalidFileStorePacket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+
+	b := encodeFileStoreRecord(fileStoreOpPut, DirectionSending, 1, []byte{packet.TypePUBREL << 4})
+
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, err := NewFileStore(path); err != ErrInvalidFileStorePacket {
+		invalidError(t, err, ErrInvalidFileStorePacket)
+	}
+}
+
+func TestNewFileStore_openErr(t *testing.T) {
+	if _, err := NewFileStore(filepath.Join(t.TempDir(), "none", "store")); err == nil {
+		notNilErrorExpected(t)
+	}
+}
+
+// newTestFileStore creates a FileStore of the path.
+func newTestFileStore(t *testing.T, path string) *FileStore {
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
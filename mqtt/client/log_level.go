@@ -0,0 +1,35 @@
+package client
+
+// LogLevel represents the level of the log.
+type LogLevel int
+
+// Log levels
+const (
+	// LogLevelDebug is the level of the Packets sent and received.
+	LogLevelDebug LogLevel = iota
+	// LogLevelInfo is the level of the state transitions.
+	LogLevelInfo
+	// LogLevelWarn is the level of the recoverable failures
+	// such as the loss of the Network Connection.
+	LogLevelWarn
+	// LogLevelError is the level of the failures which
+	// need the intervention of the application.
+	LogLevelError
+)
+
+// Names of the log levels
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "DEBUG",
+	LogLevelInfo:  "INFO",
+	LogLevelWarn:  "WARN",
+	LogLevelError: "ERROR",
+}
+
+// String returns the name of the log level.
+func (level LogLevel) String() string {
+	if name, exist := logLevelNames[level]; exist {
+		return name
+	}
+
+	return "UNKNOWN"
+}
@@ -0,0 +1,12 @@
+package client
+
+// Logger is the interface which the Client uses to record
+// its activity.
+type Logger interface {
+	// Log records the message of a state transition of the Client.
+	Log(level LogLevel, msg string)
+	// TracePacket records the summary of a Packet which is
+	// sent to or received from the Server. It is called
+	// only if the log level is LogLevelDebug.
+	TracePacket(s *PacketSummary)
+}
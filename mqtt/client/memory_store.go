@@ -0,0 +1,128 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+// MemoryStore is a Store which keeps the Packets in memory.
+// The Packets are lost when the process exits.
+type MemoryStore struct {
+	// mu is the Mutex for packets.
+	mu sync.RWMutex
+	// packets contains the pairs of the Packet Identifier
+	// and the Packet for each Direction.
+	packets [2]map[uint16]packet.Packet
+}
+
+// Put stores the Packet which has the Packet Identifier in the direction.
+func (s *MemoryStore) Put(dir Direction, id uint16, p packet.Packet) error {
+	// Validate the Direction.
+	if !dir.valid() {
+		return ErrInvalidDirection
+	}
+
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	s.packets[dir][id] = p
+
+	return nil
+}
+
+// Get returns the Packet which has the Packet Identifier in the direction.
+func (s *MemoryStore) Get(dir Direction, id uint16) (packet.Packet, error) {
+	// Validate the Direction.
+	if !dir.valid() {
+		return nil, ErrInvalidDirection
+	}
+
+	// Lock for reading.
+	s.mu.RLock()
+
+	// Unlock.
+	defer s.mu.RUnlock()
+
+	p, exist := s.packets[dir][id]
+	if !exist {
+		return nil, ErrPacketNotStored
+	}
+
+	return p, nil
+}
+
+// Delete deletes the Packet which has the Packet Identifier in the direction.
+func (s *MemoryStore) Delete(dir Direction, id uint16) error {
+	// Validate the Direction.
+	if !dir.valid() {
+		return ErrInvalidDirection
+	}
+
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	delete(s.packets[dir], id)
+
+	return nil
+}
+
+// ForEach calls the function for each Packet in the direction.
+func (s *MemoryStore) ForEach(dir Direction, fn func(id uint16, p packet.Packet) error) error {
+	// Validate the Direction.
+	if !dir.valid() {
+		return ErrInvalidDirection
+	}
+
+	// Lock for reading.
+	s.mu.RLock()
+
+	// Copy the Packets so that the function can update the Store.
+	packets := make(map[uint16]packet.Packet, len(s.packets[dir]))
+
+	for id, p := range s.packets[dir] {
+		packets[id] = p
+	}
+
+	// Unlock.
+	s.mu.RUnlock()
+
+	for id, p := range packets {
+		if err := fn(id, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset deletes all Packets.
+func (s *MemoryStore) Reset() error {
+	// Lock for updating.
+	s.mu.Lock()
+
+	// Unlock.
+	defer s.mu.Unlock()
+
+	for dir := range s.packets {
+		s.packets[dir] = make(map[uint16]packet.Packet)
+	}
+
+	return nil
+}
+
+// NewMemoryStore creates and returns a MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		packets: [2]map[uint16]packet.Packet{
+			make(map[uint16]packet.Packet),
+			make(map[uint16]packet.Packet),
+		},
+	}
+}
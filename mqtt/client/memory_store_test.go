@@ -0,0 +1,108 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+func TestMemoryStore_ErrInvalidDirection(t *testing.T) {
+	testStoreErrInvalidDirection(t, NewMemoryStore())
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+// testStoreErrInvalidDirection tests that the Store
+// rejects an invalid Direction.
+func testStoreErrInvalidDirection(t *testing.T, s Store) {
+	dir := Direction(2)
+
+	if err := s.Put(dir, 1, newTestPUBREL(t, 1)); err != ErrInvalidDirection {
+		invalidError(t, err, ErrInvalidDirection)
+	}
+
+	if _, err := s.Get(dir, 1); err != ErrInvalidDirection {
+		invalidError(t, err, ErrInvalidDirection)
+	}
+
+	if err := s.Delete(dir, 1); err != ErrInvalidDirection {
+		invalidError(t, err, ErrInvalidDirection)
+	}
+
+	if err := s.ForEach(dir, nil); err != ErrInvalidDirection {
+		invalidError(t, err, ErrInvalidDirection)
+	}
+}
+
+// testStore tests putting, getting, deleting,
+// iterating and resetting the Packets of the Store.
+func testStore(t *testing.T, s Store) {
+	pubrel := newTestPUBREL(t, 1)
+
+	if err := s.Put(DirectionSending, 1, pubrel); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := s.Put(DirectionReceiving, 2, newTestPUBREL(t, 2)); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if p, err := s.Get(DirectionSending, 1); err != nil || p.(*packet.PUBREL).PacketID != 1 {
+		t.Errorf("s.Get(DirectionSending, 1) => %v, %v, want => %v, nil", p, err, pubrel)
+	}
+
+	if _, err := s.Get(DirectionReceiving, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+
+	if err := s.ForEach(DirectionSending, func(_ uint16, _ packet.Packet) error {
+		return errTest
+	}); err != errTest {
+		invalidError(t, err, errTest)
+	}
+
+	var ids []uint16
+
+	if err := s.ForEach(DirectionReceiving, func(id uint16, _ packet.Packet) error {
+		ids = append(ids, id)
+		return s.Delete(DirectionReceiving, id)
+	}); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("ids => %v, want => [2]", ids)
+	}
+
+	if _, err := s.Get(DirectionReceiving, 2); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+
+	if err := s.Delete(DirectionReceiving, 2); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := s.Reset(); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := s.Get(DirectionSending, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+}
+
+// newTestPUBREL creates a PUBREL Packet which has the Packet Identifier.
+func newTestPUBREL(t *testing.T, id uint16) packet.Packet {
+	p, err := packet.NewPUBREL(&packet.PUBRELOptions{
+		PacketID: id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
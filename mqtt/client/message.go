@@ -0,0 +1,46 @@
+package client
+
+import "io"
+
+// Message represents an Application Message sent from the Server.
+type Message struct {
+	// TopicName is the Topic Name of the PUBLISH Packet.
+	TopicName []byte
+	// Payload is the Application Message of the PUBLISH Packet.
+	// It is nil if the Application Message is read as a stream.
+	Payload []byte
+	// PayloadReader reads the Application Message of the PUBLISH
+	// Packet which is passed to the StreamHandler. It is valid only
+	// until the StreamHandler returns.
+	PayloadReader io.Reader
+	// PayloadLen is the length of the Application Message
+	// which is read from PayloadReader.
+	PayloadLen int
+	// QoS is the QoS of the PUBLISH Packet.
+	QoS byte
+	// Retain is true if the Application Message was retained
+	// by the Server and is not a live one.
+	Retain bool
+	// DUP is true if the PUBLISH Packet may be a redelivery.
+	DUP bool
+	// PacketID is the Packet Identifier of the PUBLISH Packet.
+	// It is zero for QoS 0.
+	PacketID uint16
+	// TopicFilter is the Topic Filter of the subscription
+	// which matched the Topic Name.
+	TopicFilter []byte
+
+	// ack acknowledges the Application Message
+	// in the manual acknowledgment mode.
+	ack func()
+}
+
+// Ack acknowledges the Application Message. In the manual acknowledgment
+// mode, the PUBACK (QoS 1) or PUBCOMP (QoS 2) Packet is sent to the Server
+// after all message handlers which received the Application Message call
+// this method. It does nothing in the other cases.
+func (msg *Message) Ack() {
+	if msg.ack != nil {
+		msg.ack()
+	}
+}
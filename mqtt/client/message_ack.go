@@ -0,0 +1,52 @@
+package client
+
+import "sync"
+
+// messageAck represents the acknowledgment of an Application
+// Message which is shared by the message handlers.
+type messageAck struct {
+	// mu is the Mutex for remaining.
+	mu sync.Mutex
+	// remaining is the number of the message handlers
+	// which have not yet acknowledged the Application Message.
+	remaining int
+	// fn is the function which is called when all message handlers
+	// have acknowledged the Application Message.
+	fn func()
+}
+
+// done counts the acknowledgment of a message handler and calls
+// the function when all message handlers have acknowledged.
+func (a *messageAck) done() {
+	// Lock for updating.
+	a.mu.Lock()
+
+	a.remaining--
+
+	last := a.remaining == 0
+
+	// Unlock.
+	a.mu.Unlock()
+
+	if last {
+		a.fn()
+	}
+}
+
+// ackFunc returns the function for a message handler which
+// acknowledges the Application Message only once.
+func (a *messageAck) ackFunc() func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(a.done)
+	}
+}
+
+// newMessageAck creates and returns a messageAck.
+func newMessageAck(remaining int, fn func()) *messageAck {
+	return &messageAck{
+		remaining: remaining,
+		fn:        fn,
+	}
+}
@@ -0,0 +1,5 @@
+package client
+
+// MessageFunc is the handler which handles the Application
+// Message sent from the Server with its attributes.
+type MessageFunc func(msg *Message)
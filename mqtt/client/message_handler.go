@@ -3,3 +3,14 @@ package client
 // MessageHandler is the handler which handles
 // the Application Message sent from the Server.
 type MessageHandler func(topicName, message []byte)
+
+// MessageFunc adapts the MessageHandler to a MessageFunc.
+// The MessageFunc acknowledges the Application Message
+// after the MessageHandler returns.
+func (h MessageHandler) MessageFunc() MessageFunc {
+	return func(msg *Message) {
+		h(msg.TopicName, msg.Payload)
+
+		msg.Ack()
+	}
+}
@@ -0,0 +1,24 @@
+package client
+
+import "testing"
+
+func TestMessageHandler_MessageFunc(t *testing.T) {
+	var topicName, message []byte
+
+	h := MessageHandler(func(t, m []byte) {
+		topicName, message = t, m
+	})
+
+	h.MessageFunc()(&Message{
+		TopicName: []byte("a/b"),
+		Payload:   []byte("message"),
+	})
+
+	if string(topicName) != "a/b" {
+		t.Errorf("topicName => %q, want => %q", topicName, "a/b")
+	}
+
+	if string(message) != "message" {
+		t.Errorf("message => %q, want => %q", message, "message")
+	}
+}
@@ -0,0 +1,418 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Error values
+var (
+	ErrOfflineQueueFull   = errors.New("the offline queue is full")
+	ErrOfflineQueueClosed = errors.New("the offline queue was closed before the Application Message was sent")
+	ErrMessageExpired     = errors.New("the Application Message expired in the offline queue")
+)
+
+// offlineEntry represents an Application Message in the offline queue.
+type offlineEntry struct {
+	// opts is the options for publishing the Application Message.
+	opts *PublishOptions
+	// token is the Token of the delivery.
+	token *Token
+	// expiry is the time when the Application Message expires.
+	// It never expires if it is zero.
+	expiry time.Time
+	// size is the length of the Topic Name and the Application Message.
+	size int
+}
+
+// expired returns true if the Application Message has expired.
+func (e *offlineEntry) expired(now time.Time) bool {
+	return !e.expiry.IsZero() && !now.Before(e.expiry)
+}
+
+// offlineQueue keeps the Application Messages which are published while
+// the Client is disconnected until they are sent after the reconnection.
+type offlineQueue struct {
+	// mu is the Mutex for the queue.
+	mu sync.Mutex
+	// entries is the queued Application Messages in order.
+	entries []*offlineEntry
+	// sending is the entry which is being sent. It is
+	// neither dropped nor expired while it is sent.
+	sending *offlineEntry
+	// bytes is the total size of the entries.
+	bytes int
+	// maxMessages is the maximum number of the entries.
+	maxMessages int
+	// maxBytes is the maximum total size of the entries.
+	maxBytes int
+	// policy is the overflow policy.
+	policy OverflowPolicy
+	// ttl is the default time to live of the entries.
+	ttl time.Duration
+	// expiryTimer drops the expired entries when
+	// the earliest expiry of the entries passes.
+	expiryTimer *time.Timer
+	// roomc is closed when an entry is removed.
+	roomc chan struct{}
+	// kickc is the channel which handles the signal
+	// to send the queued Application Messages.
+	kickc chan struct{}
+	// ctx is done when the queue is closed.
+	ctx context.Context
+	// cancel closes ctx.
+	cancel context.CancelFunc
+	// closed is true if the queue has been closed.
+	closed bool
+}
+
+// push appends the Application Message to the queue and returns the
+// Token of its delivery. It makes room for the Application Message
+// according to the overflow policy if the queue is full.
+func (q *offlineQueue) push(ctx context.Context, opts *PublishOptions) (*Token, error) {
+	t, _, err := q.pushUnless(ctx, opts, nil)
+
+	return t, err
+}
+
+// pushUnless works like push except that it does not append the
+// Application Message and returns false if the queue is empty and the
+// function returns true. The queue is checked and updated while holding
+// the lock so that no Application Message is appended in between.
+func (q *offlineQueue) pushUnless(ctx context.Context, opts *PublishOptions, direct func() bool) (*Token, bool, error) {
+	// Create an entry.
+	e := &offlineEntry{
+		opts:  opts,
+		token: newToken(),
+		size:  len(opts.TopicName) + len(opts.Message),
+	}
+
+	if opts.MessageReader != nil {
+		e.size += opts.MessageLen
+	}
+
+	// Set the expiry.
+	ttl := q.ttl
+	if opts.TTL > 0 {
+		ttl = opts.TTL
+	}
+
+	if ttl > 0 {
+		e.expiry = time.Now().Add(ttl)
+	}
+
+	// Lock for update.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	// Leave the Application Message to the caller
+	// if it can be sent directly.
+	if !q.closed && len(q.entries) == 0 && direct != nil && direct() {
+		return nil, false, nil
+	}
+
+	// Reject the Application Message which never fits.
+	if q.maxBytes > 0 && e.size > q.maxBytes {
+		return nil, false, ErrOfflineQueueFull
+	}
+
+	for {
+		if q.closed {
+			return nil, false, ErrOfflineQueueClosed
+		}
+
+		// Drop the expired Application Messages.
+		q.dropExpired()
+
+		if q.fits(e) {
+			break
+		}
+
+		switch q.policy {
+		case OverflowDropNewest:
+			return nil, false, ErrOfflineQueueFull
+		case OverflowBlock:
+			roomc := q.roomc
+
+			// Unlock while waiting for the room.
+			q.mu.Unlock()
+
+			select {
+			case <-roomc:
+			case <-ctx.Done():
+				// Lock for the deferred unlock.
+				q.mu.Lock()
+
+				return nil, false, ctx.Err()
+			}
+
+			// Lock for update.
+			q.mu.Lock()
+		default:
+			// Drop the oldest Application Message
+			// which is not being sent.
+			if !q.dropOldest() {
+				return nil, false, ErrOfflineQueueFull
+			}
+		}
+	}
+
+	// Append the entry.
+	q.entries = append(q.entries, e)
+	q.bytes += e.size
+
+	// Schedule the expiry of the entry.
+	q.scheduleExpiry()
+
+	// Send the signal to send the Application Message.
+	q.kick()
+
+	return e.token, true, nil
+}
+
+// fits returns true if the queue has room for the entry.
+// This method must be called while holding the lock.
+func (q *offlineQueue) fits(e *offlineEntry) bool {
+	if len(q.entries) >= q.maxMessages {
+		return false
+	}
+
+	return q.maxBytes <= 0 || q.bytes+e.size <= q.maxBytes
+}
+
+// dropExpired drops the expired entries and fails their Tokens.
+// This method must be called while holding the lock.
+func (q *offlineQueue) dropExpired() {
+	now := time.Now()
+
+	for i := 0; i < len(q.entries); {
+		if e := q.entries[i]; e != q.sending && e.expired(now) {
+			q.removeAt(i)
+			e.token.complete(ErrMessageExpired)
+			continue
+		}
+
+		i++
+	}
+}
+
+// scheduleExpiry sets the timer to the earliest expiry of the entries
+// which are not being sent. It stops the timer if there is no such
+// entry. This method must be called while holding the lock.
+func (q *offlineQueue) scheduleExpiry() {
+	var earliest time.Time
+
+	for _, e := range q.entries {
+		if e == q.sending || e.expiry.IsZero() {
+			continue
+		}
+
+		if earliest.IsZero() || e.expiry.Before(earliest) {
+			earliest = e.expiry
+		}
+	}
+
+	if earliest.IsZero() {
+		if q.expiryTimer != nil {
+			q.expiryTimer.Stop()
+		}
+
+		return
+	}
+
+	if q.expiryTimer == nil {
+		q.expiryTimer = time.AfterFunc(time.Until(earliest), q.expire)
+		return
+	}
+
+	q.expiryTimer.Reset(time.Until(earliest))
+}
+
+// expire drops the expired entries when the timer fires
+// and schedules the next expiry.
+func (q *offlineQueue) expire() {
+	// Lock for update.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	// Drop the expired Application Messages.
+	q.dropExpired()
+
+	q.scheduleExpiry()
+}
+
+// dropOldest drops the oldest entry which is not being sent and
+// fails its Token. It returns false if there is no such entry.
+// This method must be called while holding the lock.
+func (q *offlineQueue) dropOldest() bool {
+	for i, e := range q.entries {
+		if e == q.sending {
+			continue
+		}
+
+		q.removeAt(i)
+		e.token.complete(ErrOfflineQueueFull)
+
+		return true
+	}
+
+	return false
+}
+
+// removeAt removes the entry at the index and notifies the waiting
+// goroutines of the room. This method must be called while holding
+// the lock.
+func (q *offlineQueue) removeAt(i int) {
+	q.bytes -= q.entries[i].size
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+
+	close(q.roomc)
+
+	q.roomc = make(chan struct{})
+}
+
+// next drops the expired entries and marks the oldest entry as
+// being sent and returns it. It returns nil if the queue is empty.
+func (q *offlineQueue) next() *offlineEntry {
+	// Lock for update.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	// Drop the expired Application Messages.
+	q.dropExpired()
+
+	if len(q.entries) == 0 {
+		return nil
+	}
+
+	q.sending = q.entries[0]
+
+	// Exclude the entry being sent from the expiry.
+	q.scheduleExpiry()
+
+	return q.sending
+}
+
+// remove removes the entry which has been sent. It returns false
+// if the entry has already been removed by closing the queue.
+func (q *offlineQueue) remove(e *offlineEntry) bool {
+	// Lock for update.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	if q.sending == e {
+		q.sending = nil
+	}
+
+	for i, qe := range q.entries {
+		if qe == e {
+			q.removeAt(i)
+			return true
+		}
+	}
+
+	return false
+}
+
+// release unmarks the entry which could not be sent
+// so that it is sent after the next connection.
+func (q *offlineQueue) release(e *offlineEntry) {
+	// Lock for update.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	if q.sending == e {
+		q.sending = nil
+	}
+
+	// Let the entry expire while it waits for the next connection.
+	q.scheduleExpiry()
+}
+
+// len returns the number of the queued Application Messages.
+func (q *offlineQueue) len() int {
+	// Lock for reading.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	return len(q.entries)
+}
+
+// kick sends the signal to send the queued Application Messages
+// without blocking.
+func (q *offlineQueue) kick() {
+	select {
+	case q.kickc <- struct{}{}:
+	default:
+	}
+}
+
+// close closes the queue and fails the Tokens
+// of the queued Application Messages.
+func (q *offlineQueue) close() {
+	// Lock for update.
+	q.mu.Lock()
+
+	// Unlock.
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	q.closed = true
+
+	// Interrupt sending the Application Message.
+	q.cancel()
+
+	// Stop expiring the Application Messages.
+	if q.expiryTimer != nil {
+		q.expiryTimer.Stop()
+	}
+
+	for _, e := range q.entries {
+		e.token.complete(ErrOfflineQueueClosed)
+	}
+
+	q.entries = nil
+	q.bytes = 0
+
+	// Release the goroutines waiting for the room.
+	close(q.roomc)
+
+	q.roomc = make(chan struct{})
+}
+
+// newOfflineQueue creates and returns an offline queue.
+func newOfflineQueue(opts *OfflineQueueOptions) *offlineQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &offlineQueue{
+		maxMessages: opts.maxMessages(),
+		maxBytes:    opts.MaxBytes,
+		policy:      opts.OverflowPolicy,
+		ttl:         opts.TTL,
+		roomc:       make(chan struct{}),
+		kickc:       make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
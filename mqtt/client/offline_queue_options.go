@@ -0,0 +1,38 @@
+package client
+
+import "time"
+
+// Default values
+const (
+	defaultOfflineQueueMaxMessages = 1024
+)
+
+// OfflineQueueOptions represents options for the queue of the
+// Application Messages which are published while the Client is
+// disconnected from the Server.
+type OfflineQueueOptions struct {
+	// MaxMessages is the maximum number of the Application Messages
+	// in the queue. 1024 is used if this property is zero.
+	MaxMessages int
+	// MaxBytes is the maximum total length in bytes of the Topic Names
+	// and the Application Messages in the queue. The total length is
+	// not limited if this property is zero.
+	MaxBytes int
+	// OverflowPolicy is the policy applied when the queue is full.
+	OverflowPolicy OverflowPolicy
+	// TTL is the time for which an Application Message is kept in the
+	// queue. The Application Message is dropped when it expires and its
+	// Token fails with ErrMessageExpired. The TTL of the PublishOptions
+	// overrides it. The Application Messages do not expire if both
+	// are zero.
+	TTL time.Duration
+}
+
+// maxMessages returns the maximum number of the Application Messages.
+func (opts *OfflineQueueOptions) maxMessages() int {
+	if opts.MaxMessages > 0 {
+		return opts.MaxMessages
+	}
+
+	return defaultOfflineQueueMaxMessages
+}
@@ -0,0 +1,13 @@
+package client
+
+import "testing"
+
+func TestOfflineQueueOptions_maxMessages(t *testing.T) {
+	if n := (&OfflineQueueOptions{}).maxMessages(); n != defaultOfflineQueueMaxMessages {
+		t.Errorf("n => %d, want => %d", n, defaultOfflineQueueMaxMessages)
+	}
+
+	if n := (&OfflineQueueOptions{MaxMessages: 3}).maxMessages(); n != 3 {
+		t.Errorf("n => %d, want => 3", n)
+	}
+}
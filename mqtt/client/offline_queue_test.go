@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// pushTestMessages pushes the Application Messages of the Topic Names
+// to the queue and returns their Tokens.
+func pushTestMessages(t *testing.T, q *offlineQueue, topicNames ...string) []*Token {
+	var tokens []*Token
+
+	for _, topicName := range topicNames {
+		token, err := q.push(context.Background(), &PublishOptions{
+			TopicName: []byte(topicName),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// queuedTopicNames returns the Topic Names of the queued Application Messages.
+func queuedTopicNames(q *offlineQueue) []string {
+	var topicNames []string
+
+	for _, e := range q.entries {
+		topicNames = append(topicNames, string(e.opts.TopicName))
+	}
+
+	return topicNames
+}
+
+func Test_offlineQueue_push_OverflowDropOldest(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{
+		MaxMessages: 2,
+	})
+
+	tokens := pushTestMessages(t, q, "a", "b", "c")
+
+	if err := tokens[0].Error(); err != ErrOfflineQueueFull {
+		invalidError(t, err, ErrOfflineQueueFull)
+	}
+
+	if topicNames := queuedTopicNames(q); len(topicNames) != 2 || topicNames[0] != "b" || topicNames[1] != "c" {
+		t.Errorf("topicNames => %v, want => %v", topicNames, []string{"b", "c"})
+	}
+
+	// The entry which is being sent is not dropped.
+	if e := q.next(); string(e.opts.TopicName) != "b" {
+		t.Errorf("e.opts.TopicName => %q, want => %q", e.opts.TopicName, "b")
+	}
+
+	pushTestMessages(t, q, "d")
+
+	if topicNames := queuedTopicNames(q); len(topicNames) != 2 || topicNames[0] != "b" || topicNames[1] != "d" {
+		t.Errorf("topicNames => %v, want => %v", topicNames, []string{"b", "d"})
+	}
+}
+
+func Test_offlineQueue_push_OverflowDropNewest(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{
+		MaxMessages:    1,
+		OverflowPolicy: OverflowDropNewest,
+	})
+
+	pushTestMessages(t, q, "a")
+
+	if _, err := q.push(context.Background(), &PublishOptions{TopicName: []byte("b")}); err != ErrOfflineQueueFull {
+		invalidError(t, err, ErrOfflineQueueFull)
+	}
+
+	if n := q.len(); n != 1 {
+		t.Errorf("q.len() => %d, want => %d", n, 1)
+	}
+}
+
+func Test_offlineQueue_push_OverflowBlock(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{
+		MaxMessages:    1,
+		OverflowPolicy: OverflowBlock,
+	})
+
+	pushTestMessages(t, q, "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.push(ctx, &PublishOptions{TopicName: []byte("b")}); err != context.DeadlineExceeded {
+		invalidError(t, err, context.DeadlineExceeded)
+	}
+
+	// Send the queued Application Message after a while.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		q.remove(q.next())
+	}()
+
+	if _, err := q.push(context.Background(), &PublishOptions{TopicName: []byte("b")}); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if topicNames := queuedTopicNames(q); len(topicNames) != 1 || topicNames[0] != "b" {
+		t.Errorf("topicNames => %v, want => %v", topicNames, []string{"b"})
+	}
+}
+
+func Test_offlineQueue_push_MaxBytes(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{
+		MaxBytes: 10,
+	})
+
+	if _, err := q.push(context.Background(), &PublishOptions{TopicName: []byte("a"), Message: make([]byte, 10)}); err != ErrOfflineQueueFull {
+		invalidError(t, err, ErrOfflineQueueFull)
+	}
+
+	tokens := pushTestMessages(t, q, "aaaa", "bbbb", "cccc")
+
+	if err := tokens[0].Error(); err != ErrOfflineQueueFull {
+		invalidError(t, err, ErrOfflineQueueFull)
+	}
+
+	if q.bytes != 8 {
+		t.Errorf("q.bytes => %d, want => %d", q.bytes, 8)
+	}
+}
+
+func Test_offlineQueue_TTL(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{
+		TTL: 20 * time.Millisecond,
+	})
+
+	tokens := pushTestMessages(t, q, "a")
+
+	// The TTL of the PublishOptions overrides the one of the queue.
+	token, err := q.push(context.Background(), &PublishOptions{
+		TopicName: []byte("b"),
+		TTL:       time.Hour,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if e := q.next(); e == nil || e.token != token {
+		t.Errorf("e => %+v, want => the entry of %q", e, "b")
+	}
+
+	if err := tokens[0].Error(); err != ErrMessageExpired {
+		invalidError(t, err, ErrMessageExpired)
+	}
+}
+
+func Test_offlineQueue_TTL_timer(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{
+		TTL: 20 * time.Millisecond,
+	})
+
+	defer q.close()
+
+	tokens := pushTestMessages(t, q, "a")
+
+	// The Application Message expires without any other operation.
+	if err := tokens[0].WaitTimeout(time.Second); err != ErrMessageExpired {
+		invalidError(t, err, ErrMessageExpired)
+	}
+
+	if n := q.len(); n != 0 {
+		t.Errorf("q.len() => %d, want => %d", n, 0)
+	}
+}
+
+func Test_offlineQueue_pushUnless(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{})
+
+	defer q.close()
+
+	direct := func() bool { return true }
+
+	// The Application Message is left to the caller if the queue is empty.
+	if token, ok, err := q.pushUnless(context.Background(), &PublishOptions{TopicName: []byte("a")}, direct); token != nil || ok || err != nil {
+		t.Errorf("q.pushUnless() => %v, %t, %v, want => nil, false, nil", token, ok, err)
+	}
+
+	pushTestMessages(t, q, "b")
+
+	// The Application Message is queued after the queued one.
+	if _, ok, err := q.pushUnless(context.Background(), &PublishOptions{TopicName: []byte("c")}, direct); !ok || err != nil {
+		t.Errorf("q.pushUnless() => %t, %v, want => true, nil", ok, err)
+	}
+
+	if topicNames := queuedTopicNames(q); len(topicNames) != 2 || topicNames[0] != "b" || topicNames[1] != "c" {
+		t.Errorf("topicNames => %v, want => %v", topicNames, []string{"b", "c"})
+	}
+}
+
+func Test_offlineQueue_close(t *testing.T) {
+	q := newOfflineQueue(&OfflineQueueOptions{})
+
+	tokens := pushTestMessages(t, q, "a", "b")
+
+	e := q.next()
+
+	q.close()
+
+	for _, token := range tokens {
+		if err := token.Error(); err != ErrOfflineQueueClosed {
+			invalidError(t, err, ErrOfflineQueueClosed)
+		}
+	}
+
+	if q.remove(e) {
+		t.Error("q.remove(e) => true, want => false")
+	}
+
+	if _, err := q.push(context.Background(), &PublishOptions{}); err != ErrOfflineQueueClosed {
+		invalidError(t, err, ErrOfflineQueueClosed)
+	}
+
+	// Closing twice does nothing.
+	q.close()
+}
@@ -4,4 +4,90 @@ package client
 type Options struct {
 	// ErrorHandler is the error handler.
 	ErrorHandler ErrorHandler
+	// OnConnect is called when the Server accepts the connection,
+	// including the reconnection.
+	OnConnect ConnectHandler
+	// OnConnectionLost is called with the cause when the Network
+	// Connection is lost without calling the Disconnect method.
+	// It is called before the automatic reconnection starts.
+	OnConnectionLost ConnectionLostHandler
+	// OnDisconnect is called after the Disconnect method
+	// disconnects the Network Connection.
+	OnDisconnect DisconnectHandler
+	// Reconnect is the options for the automatic reconnection.
+	// If this property is not nil, the Client tries to reconnect
+	// to the Server when the Network Connection is lost.
+	Reconnect *ReconnectOptions
+	// Store is the Store of the in-flight Packets of the Session.
+	// If this property is nil, the in-flight Packets are kept only
+	// in the Session in memory and are not written to any Store,
+	// which is equivalent to a MemoryStore. Use a FileStore
+	// to keep the in-flight Packets across the restart of the process.
+	Store Store
+	// MaxInflight is the maximum number of the PUBLISH and PUBREL
+	// Packets which are sent to the Server and not yet acknowledged.
+	// Publish and PublishAsync return ErrMaxInflightExceeded and
+	// PublishContext waits for a free slot when the number reaches it.
+	// The number is not limited if this property is zero.
+	MaxInflight int
+	// Dispatch is the options for dispatching the Application
+	// Messages to the message handlers. If this property is nil,
+	// the message handlers run concurrently with a bounded queue
+	// of 1024 Application Messages. When the queue is full, the
+	// Client stops receiving the Packets from the Server until
+	// the queue has room, which applies backpressure to the Server.
+	// A message handler which calls the Client and waits for the
+	// Server, e.g. PublishContext with QoS 1, can deadlock then
+	// because the acknowledgment is not received.
+	Dispatch *DispatchOptions
+	// DefaultMessageHandler is the message handler which handles
+	// the Application Messages matching no acknowledged subscription,
+	// e.g. the ones the Server sends for the resumed Session before
+	// the SUBACK Packets arrive. Such Application Messages are
+	// discarded if this property is nil.
+	DefaultMessageHandler MessageFunc
+	// ManualAck enables the manual acknowledgment mode. In this mode,
+	// the PUBACK Packet for a QoS 1 PUBLISH Packet and the PUBCOMP Packet
+	// for a QoS 2 PUBLISH Packet are not sent until the message handlers
+	// call the Ack method of the Message. A MessageHandler acknowledges
+	// the Application Message after it returns.
+	ManualAck bool
+	// StreamThreshold is the length of the Remaining Length above which
+	// the PUBLISH Packet received from the Server is passed to the
+	// StreamHandler before its Application Message is read. Such an
+	// Application Message is not buffered in memory. The PUBLISH
+	// Packets are always read in full if this property is zero.
+	StreamThreshold int
+	// StreamHandler handles the Application Messages which are read
+	// as a stream regardless of the subscriptions. It is called on the
+	// goroutine which receives the Packets, so the Packets after the
+	// PUBLISH Packet are not received until it returns. The part of the
+	// Application Message which it does not read is discarded. The
+	// Application Message is acknowledged after it returns even in the
+	// manual acknowledgment mode. StreamThreshold is not effective if
+	// this property is nil.
+	StreamHandler MessageFunc
+	// MaxIncomingPacketSize is the maximum length in bytes of the
+	// Packet received from the Server, including the fixed header.
+	// The Client closes the Network Connection with
+	// packet.ErrPacketTooLarge on receipt of the fixed header of
+	// a longer Packet without allocating the buffer for it. The
+	// default is zero, which leaves the size unlimited: the Packets
+	// are limited only by the maximum Remaining Length of about
+	// 256 MB and the buffer of that length may be allocated.
+	MaxIncomingPacketSize int
+	// OfflineQueue is the options for the queue of the Application
+	// Messages which are published while the Client is disconnected.
+	// The queued Application Messages are sent in order after the
+	// next successful connection. The publish methods return
+	// ErrNotYetConnected while disconnected if this property is nil.
+	OfflineQueue *OfflineQueueOptions
+	// Logger records the state transitions of the Client and
+	// the Packets sent and received. Nothing is recorded if this
+	// property is nil. Use NewStdLogger to write to the standard
+	// log package.
+	Logger Logger
+	// LogLevel is the minimum level of the records. The Packets
+	// are traced only if this property is LogLevelDebug.
+	LogLevel LogLevel
 }
@@ -0,0 +1,18 @@
+package client
+
+// OverflowPolicy represents what the offline queue does when
+// an Application Message exceeds its capacity.
+type OverflowPolicy byte
+
+// Overflow policies
+const (
+	// OverflowDropOldest drops the oldest Application Messages to make
+	// room for the new one. Their Tokens fail with ErrOfflineQueueFull.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest rejects the new Application Message
+	// with ErrOfflineQueueFull.
+	OverflowDropNewest
+	// OverflowBlock blocks the caller until the queue has room for
+	// the Application Message or the context of the caller is done.
+	OverflowBlock
+)
@@ -0,0 +1,87 @@
+package client
+
+import "math/bits"
+
+// Number of the words of the bitmap of the Packet Identifiers
+const packetIDWords = (int(maxPacketID) + 1) / 64
+
+// packetIDAllocator allocates the Packet Identifiers in rotation.
+// It keeps a bitmap of the Packet Identifiers in use and a cursor
+// which points to the Packet Identifier to be tried next, so that
+// a released Packet Identifier is not reused right away.
+type packetIDAllocator struct {
+	// used is the bitmap of the Packet Identifiers in use.
+	// The bit of zero is always set because zero is not
+	// a valid Packet Identifier.
+	used [packetIDWords]uint64
+	// n is the number of the Packet Identifiers in use.
+	n int
+	// cursor is the Packet Identifier to be tried next.
+	cursor uint16
+}
+
+// next returns the first Packet Identifier which is not in use from
+// the cursor onward and moves the cursor past it. It does not mark
+// the Packet Identifier as in use. It returns false if all Packet
+// Identifiers are in use.
+func (a *packetIDAllocator) next() (uint16, bool) {
+	if a.n >= int(maxPacketID) {
+		return 0, false
+	}
+
+	// Mask the bits before the cursor in the first word.
+	i := int(a.cursor / 64)
+	free := ^a.used[i] &^ (1<<(a.cursor%64) - 1)
+
+	// Find the word which has a free bit. The search ends within
+	// one lap of the words because a free bit exists.
+	for free == 0 {
+		i = (i + 1) % packetIDWords
+		free = ^a.used[i]
+	}
+
+	id := uint16(i*64 + bits.TrailingZeros64(free))
+
+	// Move the cursor. It wraps around to zero,
+	// which is skipped because its bit is set.
+	a.cursor = id + 1
+
+	return id, true
+}
+
+// use marks the Packet Identifier as in use.
+func (a *packetIDAllocator) use(id uint16) {
+	if id == 0 || a.inUse(id) {
+		return
+	}
+
+	a.used[id/64] |= 1 << (id % 64)
+	a.n++
+}
+
+// release marks the Packet Identifier as not in use.
+func (a *packetIDAllocator) release(id uint16) {
+	if id == 0 || !a.inUse(id) {
+		return
+	}
+
+	a.used[id/64] &^= 1 << (id % 64)
+	a.n--
+}
+
+// inUse returns true if the Packet Identifier is in use.
+func (a *packetIDAllocator) inUse(id uint16) bool {
+	return a.used[id/64]&(1<<(id%64)) != 0
+}
+
+// newPacketIDAllocator creates and returns a Packet Identifier allocator.
+func newPacketIDAllocator() *packetIDAllocator {
+	a := &packetIDAllocator{
+		cursor: minPacketID,
+	}
+
+	// Exclude zero.
+	a.used[0] = 1
+
+	return a
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+func Test_packetIDAllocator_next(t *testing.T) {
+	a := newPacketIDAllocator()
+
+	for want := uint16(1); want <= 3; want++ {
+		id, ok := a.next()
+		if !ok || id != want {
+			t.Errorf("a.next() => %d, %t, want => %d, %t", id, ok, want, true)
+		}
+
+		a.use(id)
+	}
+
+	// The released Packet Identifier is not reused right away.
+	a.release(1)
+
+	if id, _ := a.next(); id != 4 {
+		t.Errorf("a.next() => %d, want => %d", id, 4)
+	}
+
+	// The Packet Identifiers in use are skipped.
+	a.use(5)
+	a.use(6)
+
+	if id, _ := a.next(); id != 7 {
+		t.Errorf("a.next() => %d, want => %d", id, 7)
+	}
+}
+
+func Test_packetIDAllocator_next_wrap(t *testing.T) {
+	a := newPacketIDAllocator()
+
+	a.use(2)
+	a.cursor = maxPacketID
+
+	if id, _ := a.next(); id != maxPacketID {
+		t.Errorf("a.next() => %d, want => %d", id, maxPacketID)
+	}
+
+	// The cursor wraps around and skips zero and the ones in use.
+	a.use(maxPacketID)
+	a.use(1)
+
+	if id, _ := a.next(); id != 3 {
+		t.Errorf("a.next() => %d, want => %d", id, 3)
+	}
+}
+
+func Test_packetIDAllocator_next_exhausted(t *testing.T) {
+	a := newPacketIDAllocator()
+
+	for id := minPacketID; ; id++ {
+		a.use(id)
+
+		if id == maxPacketID {
+			break
+		}
+	}
+
+	if _, ok := a.next(); ok {
+		t.Error("a.next() => true, want => false")
+	}
+
+	a.release(40000)
+
+	if id, ok := a.next(); !ok || id != 40000 {
+		t.Errorf("a.next() => %d, %t, want => %d, %t", id, ok, 40000, true)
+	}
+}
+
+func Test_packetIDAllocator_use_release(t *testing.T) {
+	a := newPacketIDAllocator()
+
+	a.use(0)
+	a.use(1)
+	a.use(1)
+
+	if a.n != 1 {
+		t.Errorf("a.n => %d, want => %d", a.n, 1)
+	}
+
+	a.release(0)
+	a.release(2)
+	a.release(1)
+
+	if a.n != 0 || a.inUse(1) || !a.inUse(0) {
+		t.Errorf("a.n, a.inUse(1), a.inUse(0) => %d, %t, %t, want => %d, %t, %t", a.n, a.inUse(1), a.inUse(0), 0, false, true)
+	}
+}
+
+func TestClient_generatePacketID_sessionPackets(t *testing.T) {
+	cli := New(nil)
+
+	cli.sess = newSession(false, []byte("clientID"), nil)
+
+	// Set the Packet without marking its Packet Identifier.
+	cli.sess.sendingPackets[1] = packet.NewPINGREQ()
+
+	id, err := cli.generatePacketID()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if id != 2 {
+		t.Errorf("id => %d, want => %d", id, 2)
+	}
+}
+
+func Benchmark_packetIDAllocator(b *testing.B) {
+	for _, inflight := range []int{100, 10000, 60000} {
+		b.Run(fmt.Sprintf("inflight=%d", inflight), func(b *testing.B) {
+			sess := newBenchSession(inflight)
+
+			cli := New(nil)
+			cli.sess = sess
+
+			p := packet.NewPINGREQ()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				id, err := cli.generatePacketID()
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				sess.setSendingPacket(id, p)
+				sess.deleteSendingPacket(id)
+			}
+		})
+	}
+}
+
+func Benchmark_packetIDAllocator_linear(b *testing.B) {
+	for _, inflight := range []int{100, 10000, 60000} {
+		b.Run(fmt.Sprintf("inflight=%d", inflight), func(b *testing.B) {
+			sess := newBenchSession(inflight)
+
+			p := packet.NewPINGREQ()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				// Scan from 1 upward as the former implementation did.
+				id := minPacketID
+
+				for {
+					if _, exist := sess.sendingPackets[id]; !exist {
+						break
+					}
+
+					id++
+				}
+
+				sess.sendingPackets[id] = p
+				delete(sess.sendingPackets, id)
+			}
+		})
+	}
+}
+
+// newBenchSession returns a Session which has the
+// Packets of the number of the in-flight Packets.
+func newBenchSession(inflight int) *session {
+	sess := newSession(true, []byte("clientID"), nil)
+
+	for id := 1; id <= inflight; id++ {
+		sess.setSendingPacket(uint16(id), packet.NewPINGREQ())
+	}
+
+	return sess
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+// Names of the MQTT Control Packet types
+var packetTypeNames = map[byte]string{
+	packet.TypeCONNECT:     "CONNECT",
+	packet.TypeCONNACK:     "CONNACK",
+	packet.TypePUBLISH:     "PUBLISH",
+	packet.TypePUBACK:      "PUBACK",
+	packet.TypePUBREC:      "PUBREC",
+	packet.TypePUBREL:      "PUBREL",
+	packet.TypePUBCOMP:     "PUBCOMP",
+	packet.TypeSUBSCRIBE:   "SUBSCRIBE",
+	packet.TypeSUBACK:      "SUBACK",
+	packet.TypeUNSUBSCRIBE: "UNSUBSCRIBE",
+	packet.TypeUNSUBACK:    "UNSUBACK",
+	packet.TypePINGREQ:     "PINGREQ",
+	packet.TypePINGRESP:    "PINGRESP",
+	packet.TypeDISCONNECT:  "DISCONNECT",
+}
+
+// PacketSummary represents the decoded summary of
+// a Packet which is sent or received.
+type PacketSummary struct {
+	// Direction is DirectionSending for the Packet sent to the Server
+	// and DirectionReceiving for the Packet received from the Server.
+	Direction Direction
+	// Type is the MQTT Control Packet type.
+	Type byte
+	// PacketID is the Packet Identifier.
+	PacketID uint16
+	// TopicName is the Topic Name of the PUBLISH Packet.
+	TopicName []byte
+	// QoS is the QoS of the PUBLISH Packet.
+	QoS byte
+	// DUP is the DUP flag of the PUBLISH Packet.
+	DUP bool
+	// Retain is the Retain flag of the PUBLISH Packet.
+	Retain bool
+	// SessionPresent is the Session Present of the CONNACK Packet.
+	SessionPresent bool
+	// Size is the length of the whole Packet in bytes.
+	Size int
+	// PayloadSize is the length of the Application Message
+	// of the PUBLISH Packet in bytes.
+	PayloadSize int
+}
+
+// String returns the text representation of the summary.
+func (s *PacketSummary) String() string {
+	dir := "send"
+	if s.Direction == DirectionReceiving {
+		dir = "receive"
+	}
+
+	name, exist := packetTypeNames[s.Type]
+	if !exist {
+		name = fmt.Sprintf("0x%02X", s.Type)
+	}
+
+	str := fmt.Sprintf("%s %s", dir, name)
+
+	switch s.Type {
+	case packet.TypePUBLISH:
+		str += fmt.Sprintf(" id=%d topic=%s qos=%d dup=%t retain=%t payload=%d", s.PacketID, s.TopicName, s.QoS, s.DUP, s.Retain, s.PayloadSize)
+	case packet.TypeCONNACK:
+		str += fmt.Sprintf(" sessionPresent=%t", s.SessionPresent)
+	case packet.TypePUBACK, packet.TypePUBREC, packet.TypePUBREL, packet.TypePUBCOMP,
+		packet.TypeSUBSCRIBE, packet.TypeSUBACK, packet.TypeUNSUBSCRIBE, packet.TypeUNSUBACK:
+		str += fmt.Sprintf(" id=%d", s.PacketID)
+	}
+
+	return str + fmt.Sprintf(" size=%d", s.Size)
+}
+
+// newPacketSummary creates and returns the summary of the Packet.
+func newPacketSummary(dir Direction, p packet.Packet, size int) *PacketSummary {
+	s := &PacketSummary{
+		Direction: dir,
+		Size:      size,
+	}
+
+	s.Type, _ = p.Type()
+
+	switch p := p.(type) {
+	case *packet.CONNACK:
+		s.SessionPresent = p.SessionPresent
+	case *packet.PUBLISH:
+		s.PacketID = p.PacketID
+		s.TopicName = p.TopicName
+		s.QoS = p.QoS
+		s.DUP = p.DUP
+		s.Retain = p.Retain
+		s.PayloadSize = len(p.Message)
+
+		// The Application Message read or written as a stream.
+		if p.MessageReader != nil {
+			s.PayloadSize = p.MessageLen
+		}
+	case *packet.PUBACK:
+		s.PacketID = p.PacketID
+	case *packet.PUBREC:
+		s.PacketID = p.PacketID
+	case *packet.PUBREL:
+		s.PacketID = p.PacketID
+	case *packet.PUBCOMP:
+		s.PacketID = p.PacketID
+	case *packet.SUBSCRIBE:
+		s.PacketID = p.PacketID
+	case *packet.SUBACK:
+		s.PacketID = p.PacketID
+	case *packet.UNSUBSCRIBE:
+		s.PacketID = p.PacketID
+	case *packet.UNSUBACK:
+		s.PacketID = p.PacketID
+	}
+
+	return s
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt"
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+func TestPacketSummary_String(t *testing.T) {
+	publish, err := packet.NewPUBLISH(&packet.PUBLISHOptions{
+		QoS:       mqtt.QoS1,
+		Retain:    true,
+		TopicName: []byte("a/b"),
+		PacketID:  1,
+		Message:   []byte("message"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	testCases := []struct {
+		s    *PacketSummary
+		want string
+	}{
+		{
+			s:    newPacketSummary(DirectionSending, publish, 21),
+			want: "send PUBLISH id=1 topic=a/b qos=1 dup=false retain=true payload=7 size=21",
+		},
+		{
+			s:    newPacketSummary(DirectionSending, packet.NewPINGREQ(), 2),
+			want: "send PINGREQ size=2",
+		},
+		{
+			s: &PacketSummary{
+				Type: 0x0F,
+			},
+			want: "send 0x0F size=0",
+		},
+		{
+			s: &PacketSummary{
+				Direction:      DirectionReceiving,
+				Type:           packet.TypeCONNACK,
+				SessionPresent: true,
+				Size:           4,
+			},
+			want: "receive CONNACK sessionPresent=true size=4",
+		},
+		{
+			s: &PacketSummary{
+				Type:     packet.TypeSUBSCRIBE,
+				PacketID: 2,
+				Size:     10,
+			},
+			want: "send SUBSCRIBE id=2 size=10",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.s.String(); got != tc.want {
+			t.Errorf("String() => %q, want => %q", got, tc.want)
+		}
+	}
+}
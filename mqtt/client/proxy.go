@@ -0,0 +1,385 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SOCKS5 protocol values
+const (
+	socks5Version          byte = 0x05
+	socks5AuthNone         byte = 0x00
+	socks5AuthPassword     byte = 0x02
+	socks5AuthNoAcceptable byte = 0xFF
+	socks5PasswordVersion  byte = 0x01
+	socks5CmdConnect       byte = 0x01
+	socks5AtypIPv4         byte = 0x01
+	socks5AtypDomain       byte = 0x03
+	socks5AtypIPv6         byte = 0x04
+	socks5Succeeded        byte = 0x00
+)
+
+// Environment variables which specify the proxy
+var proxyEnvs = []string{"HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"}
+
+// Environment variables which specify the hosts excluded from the proxy
+var noProxyEnvs = []string{"NO_PROXY", "no_proxy"}
+
+// Error values
+var (
+	ErrUnsupportedProxyScheme = errors.New("unsupported proxy scheme")
+	ErrProxyRefused           = errors.New("the proxy refused the connection")
+	ErrInvalidSOCKS5Reply     = errors.New("invalid SOCKS5 reply")
+)
+
+// proxyURL returns the URL of the proxy specified by the options
+// for connecting to the address. It returns nil if no proxy is used.
+func proxyURL(opts *ConnectOptions, address string) (*url.URL, error) {
+	if opts.ProxyURL != nil {
+		return opts.ProxyURL, nil
+	}
+
+	if !opts.ProxyFromEnvironment {
+		return nil, nil
+	}
+
+	// Connect directly to the address excluded by the environment.
+	if !useProxy(address) {
+		return nil, nil
+	}
+
+	for _, env := range proxyEnvs {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+
+		// Regard the proxy without the scheme as an HTTP proxy.
+		if !strings.Contains(v, "://") {
+			v = "http://" + v
+		}
+
+		return url.Parse(v)
+	}
+
+	return nil, nil
+}
+
+// useProxy returns false if the address matches the NO_PROXY environment
+// variable. Its value is a comma-separated list of "*", IP addresses,
+// CIDRs, and domain names which also match their subdomains, each
+// optionally followed by a port.
+func useProxy(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	var noProxy string
+
+	for _, env := range noProxyEnvs {
+		if noProxy = os.Getenv(env); noProxy != "" {
+			break
+		}
+	}
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return false
+		}
+
+		// Match the IP address with the CIDR.
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return false
+			}
+
+			continue
+		}
+
+		// Match the port if the entry has it.
+		if entryHost, entryPort, err := net.SplitHostPort(entry); err == nil {
+			if entryPort != port {
+				continue
+			}
+
+			entry = entryHost
+		}
+
+		// Match the IP address.
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if entryIP.Equal(ip) {
+				return false
+			}
+
+			continue
+		}
+
+		// Match the domain name and its subdomains.
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// proxyDialer returns the Dialer which connects to the address
+// through the proxy of the URL. The proxy is connected by the dialer.
+func proxyDialer(u *url.URL, dialer Dialer) (Dialer, error) {
+	// Define the function which opens the tunnel.
+	var tunnel func(ctx context.Context, conn net.Conn, u *url.URL, address string) (net.Conn, error)
+
+	switch u.Scheme {
+	case "http":
+		tunnel = httpConnect
+	case "socks5", "socks5h":
+		tunnel = socks5Connect
+	default:
+		return nil, ErrUnsupportedProxyScheme
+	}
+
+	// Get the address of the proxy.
+	proxyAddress := u.Host
+
+	if u.Port() == "" {
+		port := "1080"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+
+		proxyAddress = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		// Connect to the proxy.
+		conn, err := dialer(ctx, "tcp", proxyAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		// Open the tunnel to the address.
+		tconn, err := tunnel(ctx, conn, u, address)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return tconn, nil
+	}, nil
+}
+
+// httpConnect opens the tunnel to the address through
+// the HTTP proxy by the CONNECT method.
+func httpConnect(ctx context.Context, conn net.Conn, u *url.URL, address string) (net.Conn, error) {
+	// Interrupt the tunneling when the context is done.
+	defer watchContext(ctx, conn)()
+
+	// Create the CONNECT request.
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+
+		req.SetBasicAuth(u.User.Username(), password)
+
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+
+	// Send the request.
+	if err := req.Write(conn); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	// Receive the response.
+	r := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrProxyRefused, resp.Status)
+	}
+
+	return newBufferedConn(conn, r), nil
+}
+
+// socks5Connect opens the tunnel to the address through
+// the SOCKS5 proxy. The host name of the address is resolved
+// by the proxy.
+func socks5Connect(ctx context.Context, conn net.Conn, u *url.URL, address string) (net.Conn, error) {
+	// Interrupt the tunneling when the context is done.
+	defer watchContext(ctx, conn)()
+
+	if err := socks5Handshake(conn, u.User, address); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	return conn, nil
+}
+
+// socks5Handshake negotiates the authentication method, authenticates
+// and requests the connection to the address.
+func socks5Handshake(conn net.Conn, user *url.Userinfo, address string) error {
+	// Split the address.
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// Negotiate the authentication method.
+	methods := []byte{socks5AuthNone}
+
+	if user != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	var reply [2]byte
+
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+
+	if reply[0] != socks5Version {
+		return ErrInvalidSOCKS5Reply
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if user == nil {
+			return ErrInvalidSOCKS5Reply
+		}
+
+		// Authenticate with the User Name and the Password.
+		username := user.Username()
+		password, _ := user.Password()
+
+		if len(username) > 255 || len(password) > 255 {
+			return ErrProxyRefused
+		}
+
+		b := []byte{socks5PasswordVersion, byte(len(username))}
+		b = append(b, username...)
+		b = append(b, byte(len(password)))
+		b = append(b, password...)
+
+		if _, err := conn.Write(b); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return err
+		}
+
+		if reply[1] != socks5Succeeded {
+			return ErrProxyRefused
+		}
+	case socks5AuthNoAcceptable:
+		return ErrProxyRefused
+	default:
+		return ErrInvalidSOCKS5Reply
+	}
+
+	// Request the connection.
+	b := []byte{socks5Version, socks5CmdConnect, 0x00}
+
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return ErrProxyRefused
+		}
+
+		b = append(b, socks5AtypDomain, byte(len(host)))
+		b = append(b, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append(b, socks5AtypIPv4)
+		b = append(b, ip4...)
+	} else {
+		b = append(b, socks5AtypIPv6)
+		b = append(b, ip.To16()...)
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(port))
+
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+
+	// Receive the reply.
+	var h [4]byte
+
+	if _, err := io.ReadFull(conn, h[:]); err != nil {
+		return err
+	}
+
+	if h[0] != socks5Version {
+		return ErrInvalidSOCKS5Reply
+	}
+
+	if h[1] != socks5Succeeded {
+		return fmt.Errorf("%w: SOCKS5 reply code %d", ErrProxyRefused, h[1])
+	}
+
+	// Discard the bound address and port.
+	var n int
+
+	switch h[3] {
+	case socks5AtypIPv4:
+		n = net.IPv4len
+	case socks5AtypIPv6:
+		n = net.IPv6len
+	case socks5AtypDomain:
+		var l [1]byte
+
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+
+		n = int(l[0])
+	default:
+		return ErrInvalidSOCKS5Reply
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+
+	return err
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// newTestProxy launches a proxy stand-in which accepts the connections,
+// opens the tunnels by the function and relays the data between the
+// Client and the target. It returns the address of the proxy.
+func newTestProxy(t *testing.T, tunnel func(conn net.Conn, r *bufio.Reader) (string, bool)) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+
+				address, ok := tunnel(conn, r)
+				if !ok {
+					return
+				}
+
+				target, err := net.Dial("tcp", address)
+				if err != nil {
+					return
+				}
+
+				defer target.Close()
+
+				go io.Copy(target, r)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+// httpTestTunnel accepts the CONNECT request of the Client.
+func httpTestTunnel(conn net.Conn, r *bufio.Reader) (string, bool) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return "", false
+	}
+
+	if req.Method != "CONNECT" || req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNzd29yZA==" {
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return "", false
+	}
+
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	return req.Host, true
+}
+
+// socks5TestTunnel accepts the SOCKS5 handshake of the Client
+// which authenticates with the User Name and the Password.
+func socks5TestTunnel(conn net.Conn, r *bufio.Reader) (string, bool) {
+	var h [2]byte
+
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return "", false
+	}
+
+	if _, err := io.ReadFull(r, make([]byte, h[1])); err != nil {
+		return "", false
+	}
+
+	conn.Write([]byte{socks5Version, socks5AuthPassword})
+
+	// Authenticate the Client.
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return "", false
+	}
+
+	username := make([]byte, h[1])
+
+	if _, err := io.ReadFull(r, username); err != nil {
+		return "", false
+	}
+
+	l, err := r.ReadByte()
+	if err != nil {
+		return "", false
+	}
+
+	password := make([]byte, l)
+
+	if _, err := io.ReadFull(r, password); err != nil {
+		return "", false
+	}
+
+	if string(username) != "user" || string(password) != "password" {
+		conn.Write([]byte{socks5PasswordVersion, 0x01})
+		return "", false
+	}
+
+	conn.Write([]byte{socks5PasswordVersion, socks5Succeeded})
+
+	// Receive the request.
+	var req [4]byte
+
+	if _, err := io.ReadFull(r, req[:]); err != nil || req[3] != socks5AtypDomain {
+		return "", false
+	}
+
+	if l, err = r.ReadByte(); err != nil {
+		return "", false
+	}
+
+	b := make([]byte, int(l)+2)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", false
+	}
+
+	conn.Write([]byte{socks5Version, socks5Succeeded, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+
+	port := binary.BigEndian.Uint16(b[l:])
+
+	return net.JoinHostPort(string(b[:l]), strconv.Itoa(int(port))), true
+}
+
+func TestClient_Connect_httpProxy(t *testing.T) {
+	srv := newTestWebSocketBroker(t, true)
+	defer srv.Close()
+
+	proxyAddress, closeProxy := newTestProxy(t, httpTestTunnel)
+	defer closeProxy()
+
+	testConnectWebSocket(t, &ConnectOptions{
+		Network:   "wss",
+		Address:   srv.Listener.Addr().String(),
+		TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig,
+		ProxyURL:  &url.URL{Scheme: "http", User: url.UserPassword("user", "password"), Host: proxyAddress},
+	})
+}
+
+func TestClient_Connect_socks5Proxy(t *testing.T) {
+	srv := newTestWebSocketBroker(t, false)
+	defer srv.Close()
+
+	proxyAddress, closeProxy := newTestProxy(t, socks5TestTunnel)
+	defer closeProxy()
+
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("https_proxy", "")
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	t.Setenv("ALL_PROXY", "socks5://user:password@"+proxyAddress)
+
+	testConnectWebSocket(t, &ConnectOptions{
+		Address:              "ws://localhost:" + port + "/mqtt",
+		ProxyFromEnvironment: true,
+	})
+}
+
+func TestClient_Connect_proxyRefused(t *testing.T) {
+	proxyAddress, closeProxy := newTestProxy(t, httpTestTunnel)
+	defer closeProxy()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "tcp",
+		Address:  "localhost:1883",
+		ClientID: []byte("clientID"),
+		ProxyURL: &url.URL{Scheme: "http", Host: proxyAddress},
+	})
+	if !errors.Is(err, ErrProxyRefused) {
+		invalidError(t, err, ErrProxyRefused)
+	}
+}
+
+func Test_proxyDialer_unsupportedScheme(t *testing.T) {
+	if _, err := proxyDialer(&url.URL{Scheme: "ftp", Host: "localhost"}, nil); err != ErrUnsupportedProxyScheme {
+		invalidError(t, err, ErrUnsupportedProxyScheme)
+	}
+}
+
+func Test_proxyURL(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "proxy.example.com:3128")
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+
+	u, err := proxyURL(&ConnectOptions{ProxyFromEnvironment: true}, "broker.example.com:1883")
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if u.String() != "http://proxy.example.com:3128" {
+		t.Errorf("u => %q, want => %q", u, "http://proxy.example.com:3128")
+	}
+
+	if u, _ := proxyURL(&ConnectOptions{}, "broker.example.com:1883"); u != nil {
+		t.Errorf("u => %q, want => nil", u)
+	}
+}
+
+func Test_proxyURL_noProxy(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "proxy.example.com:3128")
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "internal.example.com, .local:1883, 10.0.0.0/8, 192.168.1.1")
+
+	testCases := []struct {
+		address string
+		proxied bool
+	}{
+		{"broker.example.com:1883", true},
+		{"internal.example.com:1883", false},
+		{"broker.internal.example.com:8883", false},
+		{"broker.local:1883", false},
+		{"broker.local:8883", true},
+		{"10.1.2.3:1883", false},
+		{"192.168.1.1:1883", false},
+		{"192.168.1.2:1883", true},
+	}
+
+	for _, tc := range testCases {
+		u, err := proxyURL(&ConnectOptions{ProxyFromEnvironment: true}, tc.address)
+		if err != nil {
+			nilErrorExpected(t, err)
+			continue
+		}
+
+		if proxied := u != nil; proxied != tc.proxied {
+			t.Errorf("proxied(%q) => %t, want => %t", tc.address, proxied, tc.proxied)
+		}
+	}
+
+	t.Setenv("no_proxy", "*")
+
+	if u, _ := proxyURL(&ConnectOptions{ProxyFromEnvironment: true}, "broker.example.com:1883"); u != nil {
+		t.Errorf("u => %q, want => nil", u)
+	}
+}
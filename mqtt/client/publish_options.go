@@ -1,5 +1,10 @@
 package client
 
+import (
+	"io"
+	"time"
+)
+
 // PublishOptions represents options for
 // the Publish method of the Client.
 type PublishOptions struct {
@@ -11,4 +16,17 @@ type PublishOptions struct {
 	TopicName []byte
 	// Message is the Application Message of the payload.
 	Message []byte
+	// MessageReader is read for the Application Message of the payload
+	// instead of Message. The Application Message of MessageLen bytes
+	// is streamed to the Network Connection without being buffered.
+	// It is resent only if MessageReader implements io.Seeker. It is
+	// not written to the Store.
+	MessageReader io.Reader
+	// MessageLen is the length of the Application Message
+	// which is read from MessageReader.
+	MessageLen int
+	// TTL is the time for which the Application Message is kept in the
+	// offline queue while the Client is disconnected. The TTL of the
+	// OfflineQueueOptions is used if this property is zero.
+	TTL time.Duration
 }
@@ -0,0 +1,15 @@
+package client
+
+// QueueFullPolicy represents what the dispatcher does when
+// its queue of the Application Messages is full.
+type QueueFullPolicy byte
+
+// Queue full policies
+const (
+	// QueueFullBlock blocks receiving the Packets from the Server
+	// until the queue has room for the Application Message.
+	QueueFullBlock QueueFullPolicy = iota
+	// QueueFullDrop drops the Application Message and passes
+	// ErrMessageDropped to the error handler.
+	QueueFullDrop
+)
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Default values of the options for the automatic reconnection
+const (
+	defaultInitialInterval = 1 * time.Second
+	defaultMaxInterval     = 2 * time.Minute
+	defaultMultiplier      = 2
+)
+
+// ReconnectOptions represents options for the automatic
+// reconnection of the Client.
+type ReconnectOptions struct {
+	// InitialInterval is the time to wait before the first
+	// reconnection attempt. One second is used if it is zero.
+	InitialInterval time.Duration
+	// MaxInterval is the upper limit of the time to wait
+	// between the reconnection attempts. Two minutes is used
+	// if it is zero.
+	MaxInterval time.Duration
+	// Multiplier is the factor by which the interval grows
+	// after each failed attempt. Two is used if it is less
+	// than one.
+	Multiplier float64
+	// Jitter is the randomization factor between 0 and 1.
+	// Each interval is randomized within the range of
+	// [interval * (1 - Jitter), interval * (1 + Jitter)].
+	Jitter float64
+	// MaxRetries is the maximum number of the reconnection
+	// attempts. The Client retries forever if it is zero.
+	MaxRetries int
+}
+
+// initialInterval returns the time to wait before the first attempt.
+func (opts *ReconnectOptions) initialInterval() time.Duration {
+	if opts.InitialInterval <= 0 {
+		return defaultInitialInterval
+	}
+
+	return opts.InitialInterval
+}
+
+// nextInterval calculates and returns the interval which follows
+// the one specified by the parameter.
+func (opts *ReconnectOptions) nextInterval(interval time.Duration) time.Duration {
+	// Get the multiplier.
+	multiplier := opts.Multiplier
+
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	// Get the upper limit of the interval.
+	maxInterval := opts.MaxInterval
+
+	if maxInterval <= 0 {
+		maxInterval = defaultMaxInterval
+	}
+
+	// Calculate the next interval.
+	next := time.Duration(float64(interval) * multiplier)
+
+	if next > maxInterval || next <= 0 {
+		return maxInterval
+	}
+
+	return next
+}
+
+// jitter randomizes the interval by using the Jitter.
+func (opts *ReconnectOptions) jitter(interval time.Duration) time.Duration {
+	if opts.Jitter <= 0 {
+		return interval
+	}
+
+	// Calculate the maximum deviation.
+	delta := float64(interval) * opts.Jitter
+
+	return time.Duration(float64(interval) - delta + 2*delta*rand.Float64())
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectOptions_initialInterval_default(t *testing.T) {
+	opts := &ReconnectOptions{}
+
+	if got := opts.initialInterval(); got != defaultInitialInterval {
+		t.Errorf("got => %s, want => %s", got, defaultInitialInterval)
+	}
+}
+
+func TestReconnectOptions_initialInterval(t *testing.T) {
+	opts := &ReconnectOptions{
+		InitialInterval: 3 * time.Second,
+	}
+
+	if got := opts.initialInterval(); got != opts.InitialInterval {
+		t.Errorf("got => %s, want => %s", got, opts.InitialInterval)
+	}
+}
+
+func TestReconnectOptions_nextInterval(t *testing.T) {
+	testCases := []struct {
+		opts *ReconnectOptions
+		in   time.Duration
+		out  time.Duration
+	}{
+		{opts: &ReconnectOptions{}, in: time.Second, out: 2 * time.Second},
+		{opts: &ReconnectOptions{}, in: 2 * time.Minute, out: defaultMaxInterval},
+		{opts: &ReconnectOptions{Multiplier: 1.5}, in: 2 * time.Second, out: 3 * time.Second},
+		{opts: &ReconnectOptions{MaxInterval: 5 * time.Second}, in: 4 * time.Second, out: 5 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.opts.nextInterval(tc.in); got != tc.out {
+			t.Errorf("got => %s, want => %s", got, tc.out)
+		}
+	}
+}
+
+func TestReconnectOptions_jitter(t *testing.T) {
+	opts := &ReconnectOptions{
+		Jitter: 0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := opts.jitter(time.Second); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Errorf("got => %s, want => between 500ms and 1.5s", got)
+			return
+		}
+	}
+}
+
+func TestReconnectOptions_jitter_zero(t *testing.T) {
+	opts := &ReconnectOptions{}
+
+	if got := opts.jitter(time.Second); got != time.Second {
+		t.Errorf("got => %s, want => %s", got, time.Second)
+	}
+}
@@ -12,17 +12,162 @@ type session struct {
 	// sendingPackets contains the pairs of the Packet Identifier
 	// and the Packet.
 	sendingPackets map[uint16]packet.Packet
+	// packetIDs allocates the Packet Identifiers
+	// of the Packets in sendingPackets.
+	packetIDs *packetIDAllocator
 	// receivingPackets contains the pairs of the Packet Identifier
 	// and the Packet.
 	receivingPackets map[uint16]packet.Packet
+	// store is the Store which the in-flight Packets
+	// are written through to.
+	store Store
+	// inflight is the number of the PUBLISH and PUBREL
+	// Packets in sendingPackets.
+	inflight int
+	// unackedMessages contains the pairs of the Packet Identifier and
+	// the PUBLISH Packet which has been passed to the message handlers
+	// and not yet acknowledged by them in the manual acknowledgment mode.
+	unackedMessages map[uint16]*packet.PUBLISH
+}
+
+// load loads the in-flight Packets from the Store if the Clean
+// Session is false. Otherwise it discards the Packets of the Store.
+func (sess *session) load() error {
+	// Do nothing if there is no Store.
+	if sess.store == nil {
+		return nil
+	}
+
+	// Discard the previous Session if the Clean Session is true.
+	if sess.cleanSession {
+		return sess.store.Reset()
+	}
+
+	// Load the sending Packets.
+	err := sess.store.ForEach(DirectionSending, func(id uint16, p packet.Packet) error {
+		sess.setSendingPacket(id, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Load the receiving Packets.
+	return sess.store.ForEach(DirectionReceiving, func(id uint16, p packet.Packet) error {
+		sess.receivingPackets[id] = p
+		return nil
+	})
+}
+
+// putSendingPacket sets the Packet to sendingPackets and
+// writes it to the Store if necessary.
+func (sess *session) putSendingPacket(id uint16, p packet.Packet) error {
+	if sess.persistent(p) {
+		if err := sess.store.Put(DirectionSending, id, p); err != nil {
+			return err
+		}
+	}
+
+	sess.setSendingPacket(id, p)
+
+	return nil
+}
+
+// setSendingPacket sets the Packet to sendingPackets
+// and counts the in-flight Packets.
+func (sess *session) setSendingPacket(id uint16, p packet.Packet) {
+	if _, exist := sess.sendingPackets[id]; !exist && inflightPacket(p) {
+		sess.inflight++
+	}
+
+	sess.sendingPackets[id] = p
+	sess.packetIDs.use(id)
+}
+
+// deleteSendingPacket deletes the Packet from sendingPackets
+// and from the Store if necessary.
+func (sess *session) deleteSendingPacket(id uint16) error {
+	p, exist := sess.sendingPackets[id]
+	if !exist {
+		return nil
+	}
+
+	if sess.persistent(p) {
+		if err := sess.store.Delete(DirectionSending, id); err != nil {
+			return err
+		}
+	}
+
+	if inflightPacket(p) {
+		sess.inflight--
+	}
+
+	delete(sess.sendingPackets, id)
+	sess.packetIDs.release(id)
+
+	return nil
+}
+
+// putReceivingPacket sets the Packet to receivingPackets and
+// writes it to the Store if necessary.
+func (sess *session) putReceivingPacket(id uint16, p packet.Packet) error {
+	if sess.persistent(p) {
+		if err := sess.store.Put(DirectionReceiving, id, p); err != nil {
+			return err
+		}
+	}
+
+	sess.receivingPackets[id] = p
+
+	return nil
+}
+
+// deleteReceivingPacket deletes the Packet from receivingPackets
+// and from the Store if necessary.
+func (sess *session) deleteReceivingPacket(id uint16) error {
+	if p, exist := sess.receivingPackets[id]; exist && sess.persistent(p) {
+		if err := sess.store.Delete(DirectionReceiving, id); err != nil {
+			return err
+		}
+	}
+
+	delete(sess.receivingPackets, id)
+
+	return nil
+}
+
+// persistent returns true if the Packet should be written to the Store.
+// Only the in-flight Packets of the Session which is not cleaned are
+// written. The PUBLISH Packet whose Application Message is streamed
+// is not written because its Application Message is not held.
+func (sess *session) persistent(p packet.Packet) bool {
+	if publish, ok := p.(*packet.PUBLISH); ok && publish.MessageReader != nil {
+		return false
+	}
+
+	return !sess.cleanSession && sess.store != nil && inflightPacket(p)
+}
+
+// inflightPacket returns true if the Packet is a PUBLISH or
+// PUBREL Packet which waits for the acknowledgment.
+func inflightPacket(p packet.Packet) bool {
+	ptype, err := p.Type()
+	if err != nil {
+		return false
+	}
+
+	return ptype == packet.TypePUBLISH || ptype == packet.TypePUBREL
 }
 
 // newSession creates and returns a Session.
-func newSession(cleanSession bool, clientID []byte) *session {
+func newSession(cleanSession bool, clientID []byte, store Store) *session {
 	return &session{
 		cleanSession:     cleanSession,
 		clientID:         clientID,
 		sendingPackets:   make(map[uint16]packet.Packet),
+		packetIDs:        newPacketIDAllocator(),
 		receivingPackets: make(map[uint16]packet.Packet),
+		store:            store,
+		unackedMessages:  make(map[uint16]*packet.PUBLISH),
 	}
 }
@@ -1,12 +1,17 @@
 package client
 
-import "testing"
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
 
 func Test_newSession(t *testing.T) {
 	cleanSession := true
 	clientIDStr := "clientID"
 
-	sess := newSession(cleanSession, []byte(clientIDStr))
+	sess := newSession(cleanSession, []byte(clientIDStr), nil)
 
 	if sess.cleanSession != cleanSession {
 		t.Errorf("sess.cleanSession => %t, want => %t", sess.cleanSession, cleanSession)
@@ -17,3 +22,169 @@ func Test_newSession(t *testing.T) {
 		t.Errorf("string(sess.clientID) => %s, want => %s", string(sess.clientID), clientIDStr)
 	}
 }
+
+func Test_session_load(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.Put(DirectionSending, 1, newTestPUBREL(t, 1))
+	store.Put(DirectionReceiving, 2, newTestPUBREL(t, 2))
+
+	sess := newSession(false, []byte("clientID"), store)
+
+	if err := sess.load(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, exist := sess.sendingPackets[1]; !exist {
+		t.Error("sess.sendingPackets[1] should exist")
+	}
+
+	if _, exist := sess.receivingPackets[2]; !exist {
+		t.Error("sess.receivingPackets[2] should exist")
+	}
+}
+
+func Test_session_load_cleanSession(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.Put(DirectionSending, 1, newTestPUBREL(t, 1))
+
+	sess := newSession(true, []byte("clientID"), store)
+
+	if err := sess.load(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if len(sess.sendingPackets) != 0 {
+		t.Errorf("len(sess.sendingPackets) => %d, want => 0", len(sess.sendingPackets))
+	}
+
+	if _, err := store.Get(DirectionSending, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+}
+
+func Test_session_putSendingPacket(t *testing.T) {
+	store := NewMemoryStore()
+
+	sess := newSession(false, []byte("clientID"), store)
+
+	subscribe, err := packet.NewSUBSCRIBE(&packet.SUBSCRIBEOptions{
+		PacketID: 2,
+		SubReqs: []*packet.SubReq{
+			&packet.SubReq{
+				TopicFilter: []byte("a/b"),
+			},
+		},
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if err := sess.putSendingPacket(1, newTestPUBREL(t, 1)); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := sess.putSendingPacket(2, subscribe); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := store.Get(DirectionSending, 1); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := store.Get(DirectionSending, 2); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+
+	if sess.inflight != 1 {
+		t.Errorf("sess.inflight => %d, want => 1", sess.inflight)
+	}
+
+	if err := sess.deleteSendingPacket(1); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := store.Get(DirectionSending, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+
+	if len(sess.sendingPackets) != 1 {
+		t.Errorf("len(sess.sendingPackets) => %d, want => 1", len(sess.sendingPackets))
+	}
+
+	if sess.inflight != 0 {
+		t.Errorf("sess.inflight => %d, want => 0", sess.inflight)
+	}
+}
+
+func Test_session_putReceivingPacket(t *testing.T) {
+	store := NewMemoryStore()
+
+	sess := newSession(false, []byte("clientID"), store)
+
+	if err := sess.putReceivingPacket(1, newTestPUBREL(t, 1)); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := store.Get(DirectionReceiving, 1); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if err := sess.deleteReceivingPacket(1); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := store.Get(DirectionReceiving, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+}
+
+func Test_session_putSendingPacket_cleanSession(t *testing.T) {
+	store := NewMemoryStore()
+
+	sess := newSession(true, []byte("clientID"), store)
+
+	if err := sess.putSendingPacket(1, newTestPUBREL(t, 1)); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, err := store.Get(DirectionSending, 1); err != ErrPacketNotStored {
+		invalidError(t, err, ErrPacketNotStored)
+	}
+}
+
+func Test_session_putSendingPacket_storeNil(t *testing.T) {
+	sess := newSession(false, []byte("clientID"), nil)
+
+	if err := sess.putSendingPacket(1, newTestPUBREL(t, 1)); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	if _, exist := sess.sendingPackets[1]; !exist {
+		t.Error("the Packet was not kept in the Session")
+	}
+
+	if err := sess.deleteSendingPacket(1); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func Test_session_putSendingPacket_storeErr(t *testing.T) {
+	store := newTestFileStore(t, filepath.Join(t.TempDir(), "store"))
+
+	store.Close()
+
+	sess := newSession(false, []byte("clientID"), store)
+
+	if err := sess.putSendingPacket(1, newTestPUBREL(t, 1)); err != ErrFileStoreClosed {
+		invalidError(t, err, ErrFileStoreClosed)
+	}
+
+	if len(sess.sendingPackets) != 0 {
+		t.Errorf("len(sess.sendingPackets) => %d, want => 0", len(sess.sendingPackets))
+	}
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"log"
+	"os"
+)
+
+// StdLogger is a Logger which writes to the standard log package.
+type StdLogger struct {
+	// logger is the logger of the standard log package.
+	logger *log.Logger
+}
+
+// Log writes the message with the log level.
+func (l *StdLogger) Log(level LogLevel, msg string) {
+	l.logger.Printf("[%s] %s", level, msg)
+}
+
+// TracePacket writes the summary of the Packet with the debug level.
+func (l *StdLogger) TracePacket(s *PacketSummary) {
+	l.logger.Printf("[%s] %s", LogLevelDebug, s)
+}
+
+// NewStdLogger creates and returns a StdLogger which writes to
+// the logger. It writes to the standard error if the logger is nil.
+func NewStdLogger(logger *log.Logger) *StdLogger {
+	if logger == nil {
+		logger = log.New(os.Stderr, "gmq: ", log.LstdFlags)
+	}
+
+	return &StdLogger{
+		logger: logger,
+	}
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+func TestStdLogger(t *testing.T) {
+	var bf bytes.Buffer
+
+	l := NewStdLogger(log.New(&bf, "", 0))
+
+	l.Log(LogLevelWarn, "connection lost")
+	l.TracePacket(&PacketSummary{
+		Type: packet.TypePINGREQ,
+		Size: 2,
+	})
+
+	want := "[WARN] connection lost\n[DEBUG] send PINGREQ size=2\n"
+
+	if got := bf.String(); got != want {
+		t.Errorf("output => %q, want => %q", got, want)
+	}
+}
+
+func TestNewStdLogger_nil(t *testing.T) {
+	if l := NewStdLogger(nil); l.logger == nil {
+		t.Error("l.logger => nil, want => not nil")
+	}
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+// Error values
+var (
+	ErrInvalidDirection = errors.New("invalid Direction")
+	ErrPacketNotStored  = errors.New("the Packet is not stored")
+)
+
+// Store represents a storage of the in-flight Packets of a Session.
+// The Client stores the PUBLISH Packets of QoS 1 and QoS 2 and
+// the PUBREL Packets which are not yet acknowledged so that they
+// can be resent after the restart of the process when the Clean
+// Session is false.
+type Store interface {
+	// Put stores the Packet which has the Packet Identifier
+	// in the direction. It replaces the Packet which has
+	// been stored with the same Packet Identifier.
+	Put(dir Direction, id uint16, p packet.Packet) error
+	// Get returns the Packet which has the Packet Identifier in
+	// the direction. It returns ErrPacketNotStored if there is
+	// no such Packet.
+	Get(dir Direction, id uint16) (packet.Packet, error)
+	// Delete deletes the Packet which has the Packet Identifier
+	// in the direction. It does nothing if there is no such Packet.
+	Delete(dir Direction, id uint16) error
+	// ForEach calls the function for each Packet in the direction.
+	// It stops and returns the error if the function returns one.
+	ForEach(dir Direction, fn func(id uint16, p packet.Packet) error) error
+	// Reset deletes all Packets.
+	Reset() error
+}
@@ -0,0 +1,15 @@
+package client
+
+import "fmt"
+
+// SubRefusedError represents the error which notifies that
+// the Server refused a subscription request.
+type SubRefusedError struct {
+	// TopicFilter is the Topic Filter of the refused subscription.
+	TopicFilter []byte
+}
+
+// Error returns the string representation of the error.
+func (e *SubRefusedError) Error() string {
+	return fmt.Sprintf("the subscription to the Topic Filter %q was refused by the Server", e.TopicFilter)
+}
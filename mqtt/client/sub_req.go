@@ -9,4 +9,22 @@ type SubReq struct {
 	// Handler is the handler which handles the Application Message
 	// sent from the Server.
 	Handler MessageHandler
+	// MessageFunc is the handler which handles the Application Message
+	// sent from the Server with its attributes. It is used instead of
+	// Handler if it is not nil.
+	MessageFunc MessageFunc
+}
+
+// messageFunc returns the handler of the subscription.
+// It returns nil if the subscription has no handler.
+func (s *SubReq) messageFunc() MessageFunc {
+	if s.MessageFunc != nil {
+		return s.MessageFunc
+	}
+
+	if s.Handler != nil {
+		return s.Handler.MessageFunc()
+	}
+
+	return nil
 }
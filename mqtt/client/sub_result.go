@@ -0,0 +1,14 @@
+package client
+
+// SubResult represents the result of a subscription request.
+type SubResult struct {
+	// TopicFilter is the Topic Filter of the subscription request.
+	TopicFilter []byte
+	// RequestedQoS is the QoS which the Client requested.
+	RequestedQoS byte
+	// GrantedQoS is the maximum QoS which the Server granted.
+	// It is meaningless if the subscription was refused.
+	GrantedQoS byte
+	// Refused is true if the Server refused the subscription.
+	Refused bool
+}
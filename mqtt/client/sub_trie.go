@@ -0,0 +1,75 @@
+package client
+
+// subTrie is the index of the subscriptions which is
+// a tree of the levels of their Topic Filters.
+type subTrie struct {
+	// root is the root node.
+	root *subTrieNode
+}
+
+// add adds the subscription of the Topic Filter to the trie.
+// It replaces the subscription which has the same Topic Filter.
+func (t *subTrie) add(topicFilter string, s *SubReq) {
+	n := t.root
+
+	for more := true; more; {
+		var level string
+
+		level, topicFilter, more = cutLevel(topicFilter)
+
+		c, exist := n.children[level]
+		if !exist {
+			c = newSubTrieNode()
+			n.children[level] = c
+		}
+
+		n = c
+	}
+
+	n.sub = s
+}
+
+// remove removes the subscription of the Topic Filter from the trie
+// and the nodes which become unnecessary.
+func (t *subTrie) remove(topicFilter string) {
+	// Trace the nodes of the Topic Filter.
+	nodes := []*subTrieNode{t.root}
+	var levels []string
+
+	for more := true; more; {
+		var level string
+
+		level, topicFilter, more = cutLevel(topicFilter)
+
+		c, exist := nodes[len(nodes)-1].children[level]
+		if !exist {
+			return
+		}
+
+		nodes = append(nodes, c)
+		levels = append(levels, level)
+	}
+
+	nodes[len(nodes)-1].sub = nil
+
+	// Delete the nodes which have neither a subscription nor a child.
+	for i := len(nodes) - 1; i > 0; i-- {
+		if nodes[i].sub != nil || len(nodes[i].children) > 0 {
+			break
+		}
+
+		delete(nodes[i-1].children, levels[i-1])
+	}
+}
+
+// match returns the subscriptions which match the Topic Name.
+func (t *subTrie) match(topicName string) []*SubReq {
+	return t.root.match(topicName, true, nil)
+}
+
+// newSubTrie creates and returns a subscription trie.
+func newSubTrie() *subTrie {
+	return &subTrie{
+		root: newSubTrieNode(),
+	}
+}
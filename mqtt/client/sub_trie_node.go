@@ -0,0 +1,81 @@
+package client
+
+import "strings"
+
+// subTrieNode represents a node of the subscription trie
+// which corresponds to a level of the Topic Filters.
+type subTrieNode struct {
+	// children contains the pairs of the level
+	// and the child node.
+	children map[string]*subTrieNode
+	// sub is the subscription whose Topic Filter ends
+	// at the node.
+	sub *SubReq
+}
+
+// match appends the subscriptions which match the Topic Name to
+// subs and returns it. root is true if the node is the root node.
+func (n *subTrieNode) match(topicName string, root bool, subs []*SubReq) []*SubReq {
+	// Extract the first level of the Topic Name.
+	level, rest, more := cutLevel(topicName)
+
+	// The Topic Names beginning with "$" do not match
+	// the Topic Filters beginning with a wildcard.
+	wildcard := !root || !strings.HasPrefix(level, "$")
+
+	if wildcard {
+		// The multi-level wildcard matches the rest of the levels.
+		if c, exist := n.children["#"]; exist && c.sub != nil {
+			subs = append(subs, c.sub)
+		}
+
+		// The single-level wildcard matches the level.
+		if c, exist := n.children["+"]; exist {
+			subs = c.matchRest(rest, more, subs)
+		}
+	}
+
+	if c, exist := n.children[level]; exist {
+		subs = c.matchRest(rest, more, subs)
+	}
+
+	return subs
+}
+
+// matchRest appends the subscriptions which match the rest
+// of the Topic Name to subs and returns it. more is false
+// if the Topic Name has ended at the node.
+func (n *subTrieNode) matchRest(rest string, more bool, subs []*SubReq) []*SubReq {
+	if more {
+		return n.match(rest, false, subs)
+	}
+
+	if n.sub != nil {
+		subs = append(subs, n.sub)
+	}
+
+	// The multi-level wildcard also matches the parent level.
+	if c, exist := n.children["#"]; exist && c.sub != nil {
+		subs = append(subs, c.sub)
+	}
+
+	return subs
+}
+
+// newSubTrieNode creates and returns a node of the subscription trie.
+func newSubTrieNode() *subTrieNode {
+	return &subTrieNode{
+		children: make(map[string]*subTrieNode),
+	}
+}
+
+// cutLevel cuts the Topic Name or the Topic Filter at the first
+// level separator and returns the first level and the rest.
+// more is false if there is no level separator.
+func cutLevel(topic string) (level, rest string, more bool) {
+	if i := strings.IndexByte(topic, '/'); i >= 0 {
+		return topic[:i], topic[i+1:], true
+	}
+
+	return topic, "", false
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// testTopicFilters is the Topic Filters for the tests of subTrie.
+var testTopicFilters = []string{
+	"#",
+	"+",
+	"+/+",
+	"/+",
+	"+/tennis/#",
+	"sport/tennis/player1/#",
+	"sport/tennis/+",
+	"sport/+/player1",
+	"sport/tennis/player1",
+	"$SYS/#",
+	"$SYS/monitor/+",
+	"+/monitor/Clients",
+}
+
+// testTopicNames is the Topic Names for the tests of subTrie.
+var testTopicNames = []string{
+	"",
+	"test",
+	"test/test",
+	"/finance",
+	"/tennis",
+	"test/tennis",
+	"test/tennis/test",
+	"test/tennis2/",
+	"sport/tennis",
+	"sport/tennis/",
+	"sport/tennis/player1",
+	"sport/tennis/player2",
+	"sport/tennis/player1/ranking",
+	"sport//player1",
+	"sport/player1",
+	"$SYS",
+	"$SYS/",
+	"$SYS/test",
+	"$SYS/monitor/",
+	"$SYS/monitor/Clients",
+	"$SYS/monitor/Clients/test",
+}
+
+func Test_subTrie_match(t *testing.T) {
+	trie := newTestSubTrie(testTopicFilters)
+
+	for _, topicName := range testTopicNames {
+		var want []string
+
+		for _, topicFilter := range testTopicFilters {
+			if match(topicName, topicFilter) {
+				want = append(want, topicFilter)
+			}
+		}
+
+		sort.Strings(want)
+
+		if got := matchedTopicFilters(trie, topicName); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("trie.match(%q) => %v, want => %v", topicName, got, want)
+		}
+	}
+}
+
+func Test_subTrie_add_replace(t *testing.T) {
+	trie := newSubTrie()
+
+	s := &SubReq{TopicFilter: []byte("a/b")}
+
+	trie.add("a/b", &SubReq{TopicFilter: []byte("a/b")})
+	trie.add("a/b", s)
+
+	if subs := trie.match("a/b"); len(subs) != 1 || subs[0] != s {
+		t.Errorf("trie.match(\"a/b\") => %v, want => [%v]", subs, s)
+	}
+}
+
+func Test_subTrie_remove(t *testing.T) {
+	trie := newTestSubTrie([]string{"a/b/c", "a/b", "a/#"})
+
+	trie.remove("a/b/c")
+
+	if _, exist := trie.root.children["a"].children["b"].children["c"]; exist {
+		t.Error("the node of \"c\" should be deleted")
+	}
+
+	trie.remove("a/b")
+	trie.remove("a/x")
+
+	if got := matchedTopicFilters(trie, "a/b"); fmt.Sprint(got) != "[a/#]" {
+		t.Errorf("trie.match(\"a/b\") => %v, want => [a/#]", got)
+	}
+
+	trie.remove("a/#")
+
+	if len(trie.root.children) != 0 {
+		t.Errorf("len(trie.root.children) => %d, want => 0", len(trie.root.children))
+	}
+}
+
+func Benchmark_subTrie_match(b *testing.B) {
+	trie := newTestSubTrie(benchTopicFilters(10000))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		trie.match("devices/5000/sensors/temperature")
+	}
+}
+
+func Benchmark_match_linear(b *testing.B) {
+	topicFilters := benchTopicFilters(10000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, topicFilter := range topicFilters {
+			match("devices/5000/sensors/temperature", topicFilter)
+		}
+	}
+}
+
+// benchTopicFilters returns the per-device Topic Filters.
+func benchTopicFilters(n int) []string {
+	topicFilters := make([]string, 0, n+2)
+
+	for i := 0; i < n; i++ {
+		topicFilters = append(topicFilters, fmt.Sprintf("devices/%d/sensors/+", i))
+	}
+
+	return append(topicFilters, "devices/+/status", "alerts/#")
+}
+
+// newTestSubTrie creates a subscription trie which has
+// the subscriptions of the Topic Filters.
+func newTestSubTrie(topicFilters []string) *subTrie {
+	trie := newSubTrie()
+
+	for _, topicFilter := range topicFilters {
+		trie.add(topicFilter, &SubReq{TopicFilter: []byte(topicFilter)})
+	}
+
+	return trie
+}
+
+// matchedTopicFilters returns the sorted Topic Filters of
+// the subscriptions which match the Topic Name.
+func matchedTopicFilters(trie *subTrie, topicName string) []string {
+	var topicFilters []string
+
+	for _, s := range trie.match(topicName) {
+		topicFilters = append(topicFilters, string(s.TopicFilter))
+	}
+
+	sort.Strings(topicFilters)
+
+	return topicFilters
+}
@@ -0,0 +1,42 @@
+package client
+
+// SubscribeToken represents the completion of a subscription
+// which is acknowledged by the SUBACK Packet.
+type SubscribeToken struct {
+	*Token
+	// results is the results of the subscription requests
+	// which are set before the Token is completed.
+	results []*SubResult
+}
+
+// Results returns the results of the subscription requests in the
+// order of the requests. It returns nil if the Token is not completed
+// yet or the subscription failed.
+func (t *SubscribeToken) Results() []*SubResult {
+	select {
+	case <-t.done:
+		return t.results
+	default:
+		return nil
+	}
+}
+
+// refusedError returns a SubRefusedError for the first subscription
+// request which is refused by the Server. It returns nil if the Server
+// accepts all of them.
+func (t *SubscribeToken) refusedError() error {
+	for _, r := range t.Results() {
+		if r.Refused {
+			return &SubRefusedError{TopicFilter: r.TopicFilter}
+		}
+	}
+
+	return nil
+}
+
+// newSubscribeToken creates and returns a SubscribeToken.
+func newSubscribeToken() *SubscribeToken {
+	return &SubscribeToken{
+		Token: newToken(),
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Error value
+var ErrTokenTimeout = errors.New("the Token was not completed within the timeout")
+
+// Token represents the completion of an operation which
+// is acknowledged by the Server.
+type Token struct {
+	// done is closed when the Token is completed.
+	done chan struct{}
+	// err is the error which prevented the operation.
+	err error
+}
+
+// complete completes the Token with the error.
+func (t *Token) complete(err error) {
+	t.err = err
+	close(t.done)
+}
+
+// Done returns a channel which is closed when the Token is completed.
+func (t *Token) Done() <-chan struct{} {
+	return t.done
+}
+
+// Error returns the error which prevented the operation.
+// It returns nil if the Token is not completed yet.
+func (t *Token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the completion of the Token and returns its error.
+func (t *Token) Wait() error {
+	<-t.done
+
+	return t.err
+}
+
+// WaitTimeout waits for the completion of the Token for the duration.
+// It returns ErrTokenTimeout if the Token is not completed within it.
+func (t *Token) WaitTimeout(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-t.done:
+		return t.err
+	case <-timer.C:
+		return ErrTokenTimeout
+	}
+}
+
+// WaitContext waits for the completion of the Token.
+// It returns the context's error if the context is done before.
+func (t *Token) WaitContext(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// follow completes the Token along with the source Token.
+func (t *Token) follow(src *Token) {
+	select {
+	case <-src.done:
+		t.complete(src.err)
+	default:
+		go func() {
+			t.complete(src.Wait())
+		}()
+	}
+}
+
+// newToken creates and returns a Token.
+func newToken() *Token {
+	return &Token{
+		done: make(chan struct{}),
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestToken_Done(t *testing.T) {
+	token := newToken()
+
+	select {
+	case <-token.Done():
+		t.Error("token.Done() should not be closed")
+	default:
+	}
+
+	token.complete(nil)
+
+	select {
+	case <-token.Done():
+	default:
+		t.Error("token.Done() should be closed")
+	}
+}
+
+func TestToken_Error(t *testing.T) {
+	token := newToken()
+
+	if err := token.Error(); err != nil {
+		nilErrorExpected(t, err)
+	}
+
+	token.complete(errTest)
+
+	if err := token.Error(); err != errTest {
+		invalidError(t, err, errTest)
+	}
+}
+
+func TestToken_Wait(t *testing.T) {
+	token := newToken()
+
+	token.complete(errTest)
+
+	if err := token.Wait(); err != errTest {
+		invalidError(t, err, errTest)
+	}
+}
+
+func TestToken_WaitTimeout(t *testing.T) {
+	token := newToken()
+
+	token.complete(errTest)
+
+	if err := token.WaitTimeout(time.Second); err != errTest {
+		invalidError(t, err, errTest)
+	}
+}
+
+func TestToken_WaitTimeout_ErrTokenTimeout(t *testing.T) {
+	token := newToken()
+
+	if err := token.WaitTimeout(time.Millisecond); err != ErrTokenTimeout {
+		invalidError(t, err, ErrTokenTimeout)
+	}
+}
+
+func TestToken_WaitContext(t *testing.T) {
+	token := newToken()
+
+	token.complete(errTest)
+
+	if err := token.WaitContext(context.Background()); err != errTest {
+		invalidError(t, err, errTest)
+	}
+}
+
+func TestToken_WaitContext_ctxDone(t *testing.T) {
+	token := newToken()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := token.WaitContext(ctx); err != context.Canceled {
+		invalidError(t, err, context.Canceled)
+	}
+}
@@ -0,0 +1,354 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// GUID which is concatenated with the Sec-WebSocket-Key
+// to calculate the Sec-WebSocket-Accept
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket subprotocol of MQTT
+const webSocketSubprotocol = "mqtt"
+
+// WebSocket opcodes
+const (
+	webSocketOpContinuation byte = 0x0
+	webSocketOpText         byte = 0x1
+	webSocketOpBinary       byte = 0x2
+	webSocketOpClose        byte = 0x8
+	webSocketOpPing         byte = 0x9
+	webSocketOpPong         byte = 0xA
+)
+
+// Maximum length of the payload of a control frame
+const maxWebSocketControlPayloadLen = 125
+
+// Error values
+var (
+	ErrInvalidWebSocketHandshake = errors.New("invalid WebSocket opening handshake response")
+	ErrInvalidWebSocketFrame     = errors.New("invalid WebSocket frame")
+)
+
+// webSocketConn is a connection which sends and receives
+// the Packets in the binary frames of WebSocket. The Packets
+// may span the frame boundaries.
+type webSocketConn struct {
+	net.Conn
+	// r is the buffered reader of the connection.
+	r *bufio.Reader
+	// remaining is the length of the payload of the current
+	// data frame which has not yet been read.
+	remaining uint64
+	// masked is true if the current data frame is masked.
+	masked bool
+	// maskKey is the masking key of the current data frame.
+	maskKey [4]byte
+	// maskPos is the position of the masking key
+	// for the next byte of the current data frame.
+	maskPos int
+	// muWrite is the Mutex for writing the frames.
+	muWrite sync.Mutex
+	// closeOnce sends the close frame only once.
+	closeOnce sync.Once
+}
+
+// Read reads the payload of the binary and continuation frames.
+// It replies to the ping frames and returns io.EOF when
+// the close frame arrives.
+func (c *webSocketConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.readFrameHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+
+	n, err := c.r.Read(b)
+
+	if c.masked {
+		c.maskPos = maskWebSocketPayload(c.maskKey, c.maskPos, b[:n])
+	}
+
+	c.remaining -= uint64(n)
+
+	return n, err
+}
+
+// Write writes the data as a binary frame.
+func (c *webSocketConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(webSocketOpBinary, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close sends a close frame and closes the connection.
+func (c *webSocketConn) Close() error {
+	c.closeOnce.Do(func() {
+		// Ignore the error because the connection
+		// is going to be closed anyway.
+		c.writeFrame(webSocketOpClose, nil)
+	})
+
+	return c.Conn.Close()
+}
+
+// readFrameHeader reads the header of the next frame. The control
+// frames are handled here and the length of the payload of the data
+// frame is set to remaining.
+func (c *webSocketConn) readFrameHeader() error {
+	// Read the first two bytes.
+	var h [2]byte
+
+	if _, err := io.ReadFull(c.r, h[:]); err != nil {
+		return err
+	}
+
+	op := h[0] & 0x0F
+
+	// Read the length of the payload.
+	length := uint64(h[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var b [2]byte
+
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return err
+		}
+
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return err
+		}
+
+		length = binary.BigEndian.Uint64(b[:])
+	}
+
+	// Read the masking key.
+	masked := h[1]&0x80 != 0
+
+	var maskKey [4]byte
+
+	if masked {
+		if _, err := io.ReadFull(c.r, maskKey[:]); err != nil {
+			return err
+		}
+	}
+
+	switch op {
+	case webSocketOpContinuation, webSocketOpBinary:
+		c.remaining = length
+		c.masked = masked
+		c.maskKey = maskKey
+		c.maskPos = 0
+
+		return nil
+	case webSocketOpClose, webSocketOpPing, webSocketOpPong:
+		// Validate the control frame.
+		if h[0]&0x80 == 0 || length > maxWebSocketControlPayloadLen {
+			return ErrInvalidWebSocketFrame
+		}
+
+		// Read the payload.
+		payload := make([]byte, length)
+
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return err
+		}
+
+		if masked {
+			maskWebSocketPayload(maskKey, 0, payload)
+		}
+
+		switch op {
+		case webSocketOpClose:
+			c.closeOnce.Do(func() {
+				c.writeFrame(webSocketOpClose, payload)
+			})
+
+			return io.EOF
+		case webSocketOpPing:
+			return c.writeFrame(webSocketOpPong, payload)
+		}
+
+		return nil
+	default:
+		return ErrInvalidWebSocketFrame
+	}
+}
+
+// writeFrame writes the payload as a masked frame of the opcode.
+func (c *webSocketConn) writeFrame(op byte, payload []byte) error {
+	// Create the masking key.
+	var maskKey [4]byte
+
+	if _, err := rand.Read(maskKey[:]); err != nil {
+		return err
+	}
+
+	// Create the header.
+	b := make([]byte, 0, 14+len(payload))
+
+	b = append(b, 0x80|op)
+
+	switch {
+	case len(payload) <= 125:
+		b = append(b, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		b = append(b, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		var l [8]byte
+
+		binary.BigEndian.PutUint64(l[:], uint64(len(payload)))
+
+		b = append(b, 0x80|127)
+		b = append(b, l[:]...)
+	}
+
+	b = append(b, maskKey[:]...)
+
+	// Append the masked payload.
+	start := len(b)
+
+	b = append(b, payload...)
+
+	maskWebSocketPayload(maskKey, 0, b[start:])
+
+	// Lock for writing.
+	c.muWrite.Lock()
+
+	// Unlock.
+	defer c.muWrite.Unlock()
+
+	_, err := c.Conn.Write(b)
+
+	return err
+}
+
+// maskWebSocketPayload masks or unmasks the payload in place
+// starting at the position of the masking key and returns the
+// position for the next byte.
+func maskWebSocketPayload(maskKey [4]byte, pos int, b []byte) int {
+	for i := range b {
+		b[i] ^= maskKey[pos&3]
+		pos++
+	}
+
+	return pos & 3
+}
+
+// newWebSocketConn performs the opening handshake of WebSocket
+// on the connection and returns the WebSocket connection. The
+// handshake is interrupted when the context is done.
+func newWebSocketConn(ctx context.Context, conn net.Conn, secure bool, host, path string, header http.Header) (*webSocketConn, error) {
+	// Interrupt the handshake when the context is done.
+	defer watchContext(ctx, conn)()
+
+	// Create the Sec-WebSocket-Key.
+	var k [16]byte
+
+	if _, err := rand.Read(k[:]); err != nil {
+		return nil, err
+	}
+
+	key := base64.StdEncoding.EncodeToString(k[:])
+
+	// Create the opening handshake request.
+	scheme := "ws"
+	if secure {
+		scheme = "wss"
+	}
+
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   path,
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", webSocketSubprotocol)
+
+	// Send the request.
+	if err := req.Write(conn); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	// Receive the response.
+	r := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	resp.Body.Close()
+
+	// Validate the response.
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWebSocketHandshake, resp.Status)
+	}
+
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) ||
+		resp.Header.Get("Sec-WebSocket-Protocol") != webSocketSubprotocol {
+		return nil, ErrInvalidWebSocketHandshake
+	}
+
+	return &webSocketConn{
+		Conn: conn,
+		r:    r,
+	}, nil
+}
+
+// webSocketAccept returns the Sec-WebSocket-Accept for the key.
+func webSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + webSocketGUID))
+
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// ctxErr returns the context's error if the context is done.
+// Otherwise it returns the error.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
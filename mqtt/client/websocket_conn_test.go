@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yosssi/gmq/mqtt"
+	"github.com/yosssi/gmq/mqtt/packet"
+)
+
+// writeTestWebSocketFrame writes an unmasked frame as the Server does.
+func writeTestWebSocketFrame(w *bufio.Writer, fin bool, op byte, payload []byte) {
+	b := op
+
+	if fin {
+		b |= 0x80
+	}
+
+	w.WriteByte(b)
+	w.WriteByte(byte(len(payload)))
+	w.Write(payload)
+	w.Flush()
+}
+
+// newTestWebSocketBroker launches a Server which accepts the connections
+// over WebSocket, splits the CONNACK Packet into several frames and
+// echoes the PUBLISH Packets.
+func newTestWebSocketBroker(t *testing.T, secure bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mqtt" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Protocol") != "mqtt" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\n")
+		rw.WriteString("Connection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n")
+		rw.WriteString("Sec-WebSocket-Protocol: mqtt\r\n\r\n")
+		rw.Flush()
+
+		// Read the masked frames of the Client.
+		r2 := bufio.NewReader(&webSocketConn{Conn: conn, r: rw.Reader})
+
+		// Receive the CONNECT Packet.
+		if _, _, err := readTestPacket(r2); err != nil {
+			return
+		}
+
+		// Send a ping frame and the CONNACK Packet which
+		// spans the frame and message boundaries.
+		writeTestWebSocketFrame(rw.Writer, true, webSocketOpPing, []byte("ping"))
+		writeTestWebSocketFrame(rw.Writer, false, webSocketOpBinary, testCONNACK[:1])
+		writeTestWebSocketFrame(rw.Writer, true, webSocketOpContinuation, testCONNACK[1:3])
+		writeTestWebSocketFrame(rw.Writer, true, webSocketOpBinary, testCONNACK[3:])
+
+		for {
+			b, remaining, err := readTestPacket(r2)
+			if err != nil {
+				return
+			}
+
+			// Echo the PUBLISH Packet.
+			if b>>4 == packet.TypePUBLISH {
+				writeTestWebSocketFrame(rw.Writer, true, webSocketOpBinary, append([]byte{b, byte(len(remaining))}, remaining...))
+			}
+		}
+	})
+
+	if secure {
+		return httptest.NewTLSServer(handler)
+	}
+
+	return httptest.NewServer(handler)
+}
+
+func testConnectWebSocket(t *testing.T, opts *ConnectOptions) {
+	msgc := make(chan *Message, 1)
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+		DefaultMessageHandler: func(msg *Message) {
+			msgc <- msg
+		},
+	})
+
+	defer cli.Terminate()
+
+	opts.ClientID = []byte("clientID")
+	opts.WebSocket = &WebSocketOptions{
+		Header: http.Header{
+			"Authorization": []string{"Bearer token"},
+		},
+	}
+
+	if err := cli.Connect(opts); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	err := cli.Publish(&PublishOptions{
+		QoS:       mqtt.QoS0,
+		TopicName: []byte("a/b"),
+		Message:   []byte("message"),
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if msg := <-msgc; string(msg.Payload) != "message" {
+		t.Errorf("msg.Payload => %q, want => %q", msg.Payload, "message")
+	}
+
+	if err := cli.Disconnect(); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestClient_Connect_webSocketURL(t *testing.T) {
+	srv := newTestWebSocketBroker(t, false)
+	defer srv.Close()
+
+	testConnectWebSocket(t, &ConnectOptions{
+		Address: "ws://" + srv.Listener.Addr().String() + "/mqtt",
+	})
+}
+
+func TestClient_Connect_webSocketSecure(t *testing.T) {
+	srv := newTestWebSocketBroker(t, true)
+	defer srv.Close()
+
+	testConnectWebSocket(t, &ConnectOptions{
+		Network:   "wss",
+		Address:   srv.Listener.Addr().String(),
+		TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig,
+	})
+}
+
+func TestClient_Connect_webSocketHandshakeErr(t *testing.T) {
+	srv := newTestWebSocketBroker(t, false)
+	defer srv.Close()
+
+	cli := New(&Options{
+		ErrorHandler: func(_ error) {},
+	})
+
+	defer cli.Terminate()
+
+	err := cli.Connect(&ConnectOptions{
+		Network:  "ws",
+		Address:  srv.Listener.Addr().String(),
+		ClientID: []byte("clientID"),
+	})
+	if !errors.Is(err, ErrInvalidWebSocketHandshake) {
+		invalidError(t, err, ErrInvalidWebSocketHandshake)
+	}
+}
+
+func Test_webSocketTarget(t *testing.T) {
+	testCases := []struct {
+		opts   *ConnectOptions
+		secure bool
+		host   string
+		path   string
+		ok     bool
+	}{
+		{&ConnectOptions{Network: "tcp", Address: "localhost:1883"}, false, "", "", false},
+		{&ConnectOptions{Network: "ws", Address: "localhost"}, false, "localhost:80", "/mqtt", true},
+		{&ConnectOptions{Network: "wss", Address: "localhost:8443", WebSocket: &WebSocketOptions{Path: "/ws"}}, true, "localhost:8443", "/ws", true},
+		{&ConnectOptions{Address: "wss://localhost/broker"}, true, "localhost:443", "/broker", true},
+		{&ConnectOptions{Address: "ws://localhost:8080"}, false, "localhost:8080", "/mqtt", true},
+	}
+
+	for _, tc := range testCases {
+		secure, host, path, ok := webSocketTarget(tc.opts)
+
+		if secure != tc.secure || host != tc.host || path != tc.path || ok != tc.ok {
+			t.Errorf("webSocketTarget(%+v) => %t, %q, %q, %t, want => %t, %q, %q, %t", tc.opts, secure, host, path, ok, tc.secure, tc.host, tc.path, tc.ok)
+		}
+	}
+}
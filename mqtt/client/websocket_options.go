@@ -0,0 +1,35 @@
+package client
+
+import "net/http"
+
+// Default path of the WebSocket endpoint
+const defaultWebSocketPath = "/mqtt"
+
+// WebSocketOptions represents options for the connection
+// over WebSocket.
+type WebSocketOptions struct {
+	// Path is the path of the WebSocket endpoint of the Server.
+	// "/mqtt" is used if this property is empty.
+	Path string
+	// Header is the HTTP header which is added to the opening
+	// handshake request, e.g. for the authentication.
+	Header http.Header
+}
+
+// path returns the path of the WebSocket endpoint.
+func (opts *WebSocketOptions) path() string {
+	if opts == nil || opts.Path == "" {
+		return defaultWebSocketPath
+	}
+
+	return opts.Path
+}
+
+// header returns the HTTP header of the opening handshake request.
+func (opts *WebSocketOptions) header() http.Header {
+	if opts == nil {
+		return nil
+	}
+
+	return opts.Header
+}
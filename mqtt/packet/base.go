@@ -1,10 +1,40 @@
 package packet
 
 import (
-	"bytes"
 	"io"
+	"net"
+	"sync"
 )
 
+// Minimum length of the payload which is written
+// without being copied into the scratch buffer
+const minLenVectoredPayload = 4096
+
+// Initial and maximum capacities of the pooled scratch buffers
+const (
+	initialCapScratchBuffer = 512
+	maxCapScratchBuffer     = 64 * 1024
+)
+
+// scratchBuffer is the buffer which the Packet data is encoded into.
+type scratchBuffer struct {
+	// b is the encoded data.
+	b []byte
+	// vec is the backing array of bufs.
+	vec [2][]byte
+	// bufs is the data of the vectored write.
+	bufs net.Buffers
+}
+
+// scratchBuffers is the pool of the scratch buffers.
+var scratchBuffers = sync.Pool{
+	New: func() interface{} {
+		return &scratchBuffer{
+			b: make([]byte, 0, initialCapScratchBuffer),
+		}
+	},
+}
+
 // base holds the fields and methods which are common
 // among the MQTT Control Packets.
 type base struct {
@@ -16,23 +46,59 @@ type base struct {
 	payload []byte
 }
 
-// WriteTo writes the Packet data to the writer.
+// AppendTo appends the Packet data to the slice and returns it.
+func (b *base) AppendTo(dst []byte) []byte {
+	dst = append(dst, b.fixedHeader...)
+	dst = append(dst, b.variableHeader...)
+
+	return append(dst, b.payload...)
+}
+
+// WriteTo writes the Packet data to the writer. The Packet data is
+// encoded into a pooled scratch buffer. A large payload is written
+// along with the headers by a vectored write without being copied.
 func (b *base) WriteTo(w io.Writer) (int64, error) {
-	// Create a byte buffer.
-	var bf bytes.Buffer
+	// Get a scratch buffer from the pool.
+	sb := scratchBuffers.Get().(*scratchBuffer)
 
-	// Write the Packet data to the buffer.
-	bf.Write(b.fixedHeader)
-	bf.Write(b.variableHeader)
-	bf.Write(b.payload)
+	// Return the scratch buffer to the pool.
+	defer putScratchBuffer(sb)
 
-	// Write the buffered data to the writer.
-	n, err := w.Write(bf.Bytes())
+	// Write the headers and the large payload by a vectored write.
+	if len(b.payload) >= minLenVectoredPayload {
+		sb.b = append(sb.b[:0], b.fixedHeader...)
+		sb.b = append(sb.b, b.variableHeader...)
+
+		sb.vec = [2][]byte{sb.b, b.payload}
+		sb.bufs = sb.vec[:]
+
+		return sb.bufs.WriteTo(w)
+	}
+
+	// Encode the Packet data into the scratch buffer.
+	sb.b = b.AppendTo(sb.b[:0])
+
+	// Write the encoded data to the writer.
+	n, err := w.Write(sb.b)
 
 	// Return the result.
 	return int64(n), err
 }
 
+// putScratchBuffer returns the scratch buffer to the pool
+// unless it has grown too large to be kept.
+func putScratchBuffer(sb *scratchBuffer) {
+	if cap(sb.b) > maxCapScratchBuffer {
+		return
+	}
+
+	// Release the payload.
+	sb.vec = [2][]byte{}
+	sb.bufs = nil
+
+	scratchBuffers.Put(sb)
+}
+
 // Type extracts the MQTT Control Packet type from
 // the fixed header and returns it.
 func (b *base) Type() (byte, error) {
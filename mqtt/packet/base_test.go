@@ -1,6 +1,8 @@
 package packet
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"testing"
 )
@@ -23,6 +25,62 @@ func Test_base_WriteTo(t *testing.T) {
 	}
 }
 
+func Test_base_WriteTo_vectored(t *testing.T) {
+	b := base{
+		fixedHeader:    []byte{0x01},
+		variableHeader: []byte{0x02, 0x03},
+		payload:        bytes.Repeat([]byte{0x04}, minLenVectoredPayload),
+	}
+
+	var bf bytes.Buffer
+
+	n, err := b.WriteTo(&bf)
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if want := b.AppendTo(nil); n != int64(len(want)) || !bytes.Equal(bf.Bytes(), want) {
+		t.Errorf("n, bf.Bytes() => %d, %X, want => %d, %X", n, bf.Bytes(), len(want), want)
+	}
+}
+
+func Test_base_WriteTo_err(t *testing.T) {
+	b := base{
+		fixedHeader: []byte{0x00},
+	}
+
+	if _, err := b.WriteTo(errWriter{}); err != errTestWrite {
+		t.Errorf("err => %v, want => %v", err, errTestWrite)
+	}
+}
+
+func Test_base_AppendTo(t *testing.T) {
+	b := base{
+		fixedHeader:    []byte{0x01},
+		variableHeader: []byte{0x02, 0x03},
+		payload:        []byte{0x04},
+	}
+
+	if got, want := b.AppendTo([]byte{0x00}), []byte{0x00, 0x01, 0x02, 0x03, 0x04}; !bytes.Equal(got, want) {
+		t.Errorf("b.AppendTo([]byte{0x00}) => %X, want => %X", got, want)
+	}
+}
+
+func Test_putScratchBuffer(t *testing.T) {
+	// The large buffer is discarded.
+	putScratchBuffer(&scratchBuffer{
+		b: make([]byte, 0, maxCapScratchBuffer+1),
+	})
+
+	sb := scratchBuffers.Get().(*scratchBuffer)
+	defer putScratchBuffer(sb)
+
+	if cap(sb.b) > maxCapScratchBuffer {
+		t.Errorf("cap(sb.b) => %d, want => %d or less", cap(sb.b), maxCapScratchBuffer)
+	}
+}
+
 func Test_base_Type(t *testing.T) {
 	b := base{
 		fixedHeader: []byte{TypeCONNECT << 4},
@@ -64,6 +122,15 @@ func Test_appendRemainingLength(t *testing.T) {
 	}
 }
 
+var errTestWrite = errors.New("test write error")
+
+// errWriter is a writer which always fails.
+type errWriter struct{}
+
+func (errWriter) Write(_ []byte) (int, error) {
+	return 0, errTestWrite
+}
+
 func nilErrorExpected(t *testing.T, err error) {
 	t.Errorf("err => %q, want => nil", err)
 }
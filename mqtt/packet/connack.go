@@ -10,12 +10,12 @@ const lenCONNACKVariableHeader = 2
 
 // Connect Return code values
 const (
-	connRetAccepted                    byte = 0x00
-	connRetUnacceptableProtocolVersion byte = 0x01
-	connRetIdentifierRejected          byte = 0x02
-	connRetServerUnavailable           byte = 0x03
-	connRetBadUserNameOrPassword       byte = 0x04
-	connRetNotAuthorized               byte = 0x05
+	ConnRetAccepted                    byte = 0x00
+	ConnRetUnacceptableProtocolVersion byte = 0x01
+	ConnRetIdentifierRejected          byte = 0x02
+	ConnRetServerUnavailable           byte = 0x03
+	ConnRetBadUserNameOrPassword       byte = 0x04
+	ConnRetNotAuthorized               byte = 0x05
 )
 
 // Error values
@@ -31,10 +31,10 @@ var (
 // CONNACK represents a CONNACK Packet.
 type CONNACK struct {
 	base
-	// sessionPresent is the Session Present of the variable header.
-	sessionPresent bool
-	// connectReturnCode is the Connect Return code of the variable header.
-	connectReturnCode byte
+	// SessionPresent is the Session Present of the variable header.
+	SessionPresent bool
+	// ConnectReturnCode is the Connect Return code of the variable header.
+	ConnectReturnCode byte
 }
 
 // NewCONNACKFromBytes creates the CONNACK Packet
@@ -47,8 +47,8 @@ func NewCONNACKFromBytes(fixedHeader FixedHeader, variableHeader []byte) (Packet
 
 	// Create a CONNACK Packet.
 	p := &CONNACK{
-		sessionPresent:    variableHeader[0]<<7 == 0x80,
-		connectReturnCode: variableHeader[1],
+		SessionPresent:    variableHeader[0]<<7 == 0x80,
+		ConnectReturnCode: variableHeader[1],
 	}
 
 	// Set the fixed header to the Packet.
@@ -102,12 +102,12 @@ func validateCONNACKBytes(fixedHeader FixedHeader, variableHeader []byte) error
 	// Check the Connect Return code of the variable header.
 	switch variableHeader[1] {
 	case
-		connRetAccepted,
-		connRetUnacceptableProtocolVersion,
-		connRetIdentifierRejected,
-		connRetServerUnavailable,
-		connRetBadUserNameOrPassword,
-		connRetNotAuthorized:
+		ConnRetAccepted,
+		ConnRetUnacceptableProtocolVersion,
+		ConnRetIdentifierRejected,
+		ConnRetServerUnavailable,
+		ConnRetBadUserNameOrPassword,
+		ConnRetNotAuthorized:
 	default:
 		return ErrInvalidConnectReturnCode
 	}
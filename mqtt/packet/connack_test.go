@@ -79,3 +79,21 @@ func Test_validateCONNACKBytes(t *testing.T) {
 		nilErrorExpected(t, err)
 	}
 }
+
+func TestNewCONNACKFromBytes_sessionPresent(t *testing.T) {
+	p, err := NewCONNACKFromBytes([]byte{TypeCONNACK << 4, 0x02}, []byte{0x01, ConnRetNotAuthorized})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	connack := p.(*CONNACK)
+
+	if !connack.SessionPresent {
+		t.Error("connack.SessionPresent => false, want => true")
+	}
+
+	if connack.ConnectReturnCode != ConnRetNotAuthorized {
+		t.Errorf("connack.ConnectReturnCode => %X, want => %X", connack.ConnectReturnCode, ConnRetNotAuthorized)
+	}
+}
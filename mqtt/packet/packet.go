@@ -11,6 +11,10 @@ var ErrInvalidPacketType = errors.New("invalid MQTT Control Packet type")
 // Packet represents an MQTT Control Packet.
 type Packet interface {
 	io.WriterTo
+	// AppendTo appends the encoded Packet to the slice
+	// and returns the extended slice. It panics for the PUBLISH
+	// Packet whose Application Message is a MessageReader.
+	AppendTo(b []byte) []byte
 	// Type returns the MQTT Control Packet type of the Packet.
 	Type() (byte, error)
 }
@@ -2,6 +2,7 @@ package packet
 
 import (
 	"errors"
+	"io"
 
 	"github.com/yosssi/gmq/mqtt"
 )
@@ -15,8 +16,12 @@ const minLenPUBLISHFixedHeader = 2
 // Minimum length of the variable header of the PUBLISH Packet
 const minLenPUBLISHVariableHeader = 2
 
-// Error value
-var ErrInvalidPacketID = errors.New("invalid Packet Identifier")
+// Error values
+var (
+	ErrInvalidPacketID       = errors.New("invalid Packet Identifier")
+	ErrMessageReaderConsumed = errors.New("the MessageReader has already been read and cannot be rewound")
+	ErrMessageStreamed       = errors.New("the Application Message of the MessageReader cannot be appended to a slice")
+)
 
 // PUBLISH represents a PUBLISH Packet.
 type PUBLISH struct {
@@ -25,14 +30,119 @@ type PUBLISH struct {
 	DUP bool
 	// qos is the QoS of the fixed header.
 	QoS byte
-	// retain is the Retain of the fixed header.
-	retain bool
+	// Retain is the Retain of the fixed header.
+	Retain bool
 	// topicName is the Topic Name of the varible header.
 	TopicName []byte
 	// packetID is the Packet Identifier of the variable header.
 	PacketID uint16
 	// message is the Application Message of the payload.
 	Message []byte
+	// MessageReader is the reader of the Application Message which is
+	// streamed when the Packet is written. For the Packet read by
+	// a Reader as a stream, it reads the Application Message from
+	// the stream.
+	MessageReader io.Reader
+	// MessageLen is the length of the Application Message
+	// of the MessageReader.
+	MessageLen int
+
+	// messageOffset is the offset of the MessageReader at the first
+	// write, to which the MessageReader is rewound on the next write.
+	messageOffset int64
+	// written is true if the Packet has been written
+	// with the MessageReader.
+	written bool
+}
+
+// AppendTo appends the Packet data to the slice and returns it.
+// It must not be called for the Packet which has a MessageReader
+// because the Application Message is streamed only by WriteTo.
+// It panics with ErrMessageStreamed instead of appending
+// a truncated Packet then.
+func (p *PUBLISH) AppendTo(dst []byte) []byte {
+	if p.MessageReader != nil {
+		panic(ErrMessageStreamed)
+	}
+
+	return p.base.AppendTo(dst)
+}
+
+// WriteTo writes the Packet data to the writer. The Application
+// Message of the MessageReader is copied to the writer without being
+// buffered as a whole. The MessageReader is rewound if it is written
+// again and implements io.Seeker.
+func (p *PUBLISH) WriteTo(w io.Writer) (int64, error) {
+	if p.MessageReader == nil {
+		return p.base.WriteTo(w)
+	}
+
+	// Rewind the MessageReader.
+	if err := p.rewind(); err != nil {
+		return 0, err
+	}
+
+	// Write the headers.
+	n, err := p.base.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+
+	// Copy the Application Message.
+	m, err := io.CopyN(w, p.MessageReader, int64(p.MessageLen))
+
+	n += m
+
+	// Return an error if the MessageReader is shorter than the MessageLen.
+	if err == io.EOF {
+		return n, ErrInvalidMessageLen
+	}
+
+	return n, err
+}
+
+// Rewindable returns true if the Packet can be written, which is false
+// only if the MessageReader has been read and does not implement io.Seeker.
+func (p *PUBLISH) Rewindable() bool {
+	if p.MessageReader == nil || !p.written {
+		return true
+	}
+
+	_, ok := p.MessageReader.(io.Seeker)
+
+	return ok
+}
+
+// rewind records the offset of the MessageReader at the first write
+// and rewinds the MessageReader to it at the subsequent writes.
+func (p *PUBLISH) rewind() error {
+	s, ok := p.MessageReader.(io.Seeker)
+
+	if !p.written {
+		p.written = true
+
+		if !ok {
+			return nil
+		}
+
+		// Record the offset.
+		off, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		p.messageOffset = off
+
+		return nil
+	}
+
+	if !ok {
+		return ErrMessageReaderConsumed
+	}
+
+	_, err := s.Seek(p.messageOffset, io.SeekStart)
+
+	return err
 }
 
 // setFixedHeader sets the fixed header to the Packet.
@@ -49,15 +159,18 @@ func (p *PUBLISH) setFixedHeader() {
 	b |= p.QoS << 1
 
 	// Set 1 to the Bit 0 if the Retain is true.
-	if p.retain {
+	if p.Retain {
 		b |= 0x01
 	}
 
 	// Append the first byte to the fixed header.
 	p.fixedHeader = append(p.fixedHeader, b)
 
-	// Append the Remaining Length to the fixed header.
-	p.appendRemainingLength()
+	// Append the Remaining Length, which includes the Application
+	// Message of the MessageReader, to the fixed header.
+	rl := encodeLength(uint32(len(p.variableHeader) + len(p.payload) + p.MessageLen))
+
+	p.fixedHeader = appendRemainingLength(p.fixedHeader, rl)
 }
 
 // setVariableHeader sets the variable header to the Packet.
@@ -71,8 +184,13 @@ func (p *PUBLISH) setVariableHeader() {
 	}
 }
 
-// setPayload sets the payload to the Packet.
+// setPayload sets the payload to the Packet. The Application
+// Message of the MessageReader is not held as the payload.
 func (p *PUBLISH) setPayload() {
+	if p.MessageReader != nil {
+		return
+	}
+
 	p.payload = p.Message
 }
 
@@ -92,12 +210,19 @@ func NewPUBLISH(opts *PUBLISHOptions) (Packet, error) {
 	p := &PUBLISH{
 		DUP:       opts.DUP,
 		QoS:       opts.QoS,
-		retain:    opts.Retain,
+		Retain:    opts.Retain,
 		TopicName: opts.TopicName,
 		PacketID:  opts.PacketID,
 		Message:   opts.Message,
 	}
 
+	// Set the MessageReader to the Packet.
+	if opts.MessageReader != nil {
+		p.Message = nil
+		p.MessageReader = opts.MessageReader
+		p.MessageLen = opts.MessageLen
+	}
+
 	// Set the variable header to the Packet.
 	p.setVariableHeader()
 
@@ -126,7 +251,7 @@ func NewPUBLISHFromBytes(fixedHeader FixedHeader, remaining []byte) (Packet, err
 	p := &PUBLISH{
 		DUP:    b&0x08 == 0x08,
 		QoS:    b & 0x06 >> 1,
-		retain: b&0x01 == 0x01,
+		Retain: b&0x01 == 0x01,
 	}
 
 	// Set the fixed header to the Packet.
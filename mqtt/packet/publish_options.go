@@ -3,6 +3,7 @@ package packet
 import (
 	"bytes"
 	"errors"
+	"io"
 
 	"github.com/yosssi/gmq/mqtt"
 )
@@ -19,9 +20,17 @@ var (
 	ErrInvalidQoS                    = errors.New("the QoS is invalid")
 	ErrTopicNameExceedsMaxStringsLen = errors.New("the length of the Topic Name exceeds the maximum strings legnth")
 	ErrTopicNameContainsWildcards    = errors.New("the Topic Name contains wildcard characters")
-	ErrMessageExceedsMaxStringsLen   = errors.New("the length of the Message exceeds the maximum strings legnth")
+	ErrInvalidMessageLen             = errors.New("the length of the Message is invalid")
+	ErrMessageExceedsMaxRemaining    = errors.New("the length of the Message exceeds the maximum Remaining Length")
 )
 
+// ErrMessageExceedsMaxStringsLen is the error value which was returned
+// when the Message was longer than the maximum strings length.
+//
+// Deprecated: The Message is limited by the maximum Remaining Length
+// and ErrMessageExceedsMaxRemaining is returned instead.
+var ErrMessageExceedsMaxStringsLen = errors.New("the length of the Message exceeds the maximum strings legnth")
+
 // PUBLISHOptions represents options for a PUBLISH Packet.
 type PUBLISHOptions struct {
 	// DUP is the DUP flag of the fixed header.
@@ -36,6 +45,13 @@ type PUBLISHOptions struct {
 	PacketID uint16
 	// Message is the Application Message of the payload.
 	Message []byte
+	// MessageReader is the reader of the Application Message which
+	// is streamed to the writer when the Packet is written. Message
+	// is ignored if this property is not nil.
+	MessageReader io.Reader
+	// MessageLen is the length of the Application Message
+	// which is read from the MessageReader.
+	MessageLen int
 }
 
 // validate validates the options.
@@ -55,9 +71,27 @@ func (opts *PUBLISHOptions) validate() error {
 		return ErrTopicNameContainsWildcards
 	}
 
+	// Get the length of the Application Message.
+	lenMessage := len(opts.Message)
+
+	if opts.MessageReader != nil {
+		if opts.MessageLen < 0 {
+			return ErrInvalidMessageLen
+		}
+
+		lenMessage = opts.MessageLen
+	}
+
+	// Calculate the length of the variable header.
+	lenVariableHeader := 2 + len(opts.TopicName)
+
+	if opts.QoS != mqtt.QoS0 {
+		lenVariableHeader += 2
+	}
+
 	// Check the length of the Application Message.
-	if len(opts.Message) > maxStringsLen {
-		return ErrMessageExceedsMaxStringsLen
+	if lenMessage > maxRemainingLength-lenVariableHeader {
+		return ErrMessageExceedsMaxRemaining
 	}
 
 	// End the validation if the QoS equals to QoS 0.
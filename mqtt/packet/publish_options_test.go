@@ -1,6 +1,7 @@
 package packet
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/yosssi/gmq/mqtt"
@@ -46,13 +47,37 @@ func TestPUBLISHOptions_validate_ErrTopicNameContainsWildcards(t *testing.T) {
 	}
 }
 
-func TestPUBLISHOptions_validate_ErrMessageExceedsMaxStringsLen(t *testing.T) {
+func TestPUBLISHOptions_validate_ErrMessageExceedsMaxRemaining(t *testing.T) {
 	opts := &PUBLISHOptions{
-		Message: make([]byte, maxStringsLen+1),
+		TopicName:     []byte("a"),
+		MessageReader: bytes.NewReader(nil),
+		MessageLen:    maxRemainingLength - 2,
 	}
 
-	if err := opts.validate(); err != ErrMessageExceedsMaxStringsLen {
-		invalidError(t, err, ErrMessageExceedsMaxStringsLen)
+	if err := opts.validate(); err != ErrMessageExceedsMaxRemaining {
+		invalidError(t, err, ErrMessageExceedsMaxRemaining)
+	}
+}
+
+func TestPUBLISHOptions_validate_largeMessage(t *testing.T) {
+	opts := &PUBLISHOptions{
+		TopicName: []byte("a"),
+		Message:   make([]byte, maxStringsLen+1),
+	}
+
+	if err := opts.validate(); err != nil {
+		nilErrorExpected(t, err)
+	}
+}
+
+func TestPUBLISHOptions_validate_ErrInvalidMessageLen(t *testing.T) {
+	opts := &PUBLISHOptions{
+		MessageReader: bytes.NewReader(nil),
+		MessageLen:    -1,
+	}
+
+	if err := opts.validate(); err != ErrInvalidMessageLen {
+		invalidError(t, err, ErrInvalidMessageLen)
 	}
 }
 
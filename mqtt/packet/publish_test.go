@@ -1,6 +1,8 @@
 package packet
 
 import (
+	"bytes"
+	"io/ioutil"
 	"testing"
 
 	"github.com/yosssi/gmq/mqtt"
@@ -9,7 +11,7 @@ import (
 func TestPUBLISH_setFixedHeader(t *testing.T) {
 	p := &PUBLISH{
 		DUP:    true,
-		retain: true,
+		Retain: true,
 	}
 
 	p.variableHeader = []byte{0x00}
@@ -89,6 +91,20 @@ func TestNewPUBLISHFromBytes(t *testing.T) {
 	}
 }
 
+func TestNewPUBLISHFromBytes_flags(t *testing.T) {
+	p, err := NewPUBLISHFromBytes([]byte{TypePUBLISH<<4 | 0x0B, 0x07}, []byte{0x00, 0x03, 0x61, 0x2F, 0x62, 0x00, 0x01})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	publish := p.(*PUBLISH)
+
+	if !publish.DUP || publish.QoS != mqtt.QoS1 || !publish.Retain {
+		t.Errorf("DUP, QoS, Retain => %t, %d, %t, want => true, 1, true", publish.DUP, publish.QoS, publish.Retain)
+	}
+}
+
 func Test_validatePUBLISHBytes_fixedHeaderErrInvalidFixedHeaderLen(t *testing.T) {
 	if err := validatePUBLISHBytes(nil, nil); err != ErrInvalidFixedHeaderLen {
 		invalidError(t, err, ErrInvalidFixedHeaderLen)
@@ -136,3 +152,154 @@ func Test_validatePUBLISHBytes(t *testing.T) {
 		nilErrorExpected(t, err)
 	}
 }
+
+func BenchmarkPUBLISH_WriteTo_small(b *testing.B) {
+	benchmarkPUBLISHWriteTo(b, 64)
+}
+
+func BenchmarkPUBLISH_WriteTo_1MB(b *testing.B) {
+	benchmarkPUBLISHWriteTo(b, 1<<20)
+}
+
+func BenchmarkPUBLISH_AppendTo_small(b *testing.B) {
+	p := newBenchPUBLISH(64)
+
+	buf := make([]byte, 0, 128)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buf = p.AppendTo(buf[:0])
+	}
+}
+
+// benchmarkPUBLISHWriteTo measures writing the PUBLISH
+// Packet which has the payload of the size.
+func benchmarkPUBLISHWriteTo(b *testing.B, size int) {
+	p := newBenchPUBLISH(size)
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := p.WriteTo(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// newBenchPUBLISH creates a PUBLISH Packet which
+// has the payload of the size.
+func newBenchPUBLISH(size int) Packet {
+	p := &PUBLISH{
+		QoS:       mqtt.QoS1,
+		TopicName: []byte("devices/1/telemetry"),
+		PacketID:  1,
+		Message:   make([]byte, size),
+	}
+
+	p.setVariableHeader()
+	p.setPayload()
+	p.setFixedHeader()
+
+	return p
+}
+
+func TestPUBLISH_WriteTo_MessageReader(t *testing.T) {
+	p, err := NewPUBLISH(&PUBLISHOptions{
+		QoS:           mqtt.QoS1,
+		TopicName:     []byte("a"),
+		PacketID:      1,
+		MessageReader: bytes.NewReader([]byte("xmessage")[1:]),
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	want := []byte{TypePUBLISH<<4 | 0x02, 0x0C, 0x00, 0x01, 'a', 0x00, 0x01, 'm', 'e', 's', 's', 'a', 'g', 'e'}
+
+	// The MessageReader is rewound on the second write.
+	for i := 0; i < 2; i++ {
+		var bf bytes.Buffer
+
+		n, err := p.WriteTo(&bf)
+		if err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+
+		if n != int64(len(want)) || !bytes.Equal(bf.Bytes(), want) {
+			t.Errorf("n, bf.Bytes() => %d, %X, want => %d, %X", n, bf.Bytes(), len(want), want)
+		}
+	}
+
+	if !p.(*PUBLISH).Rewindable() {
+		t.Error("p.Rewindable() => false, want => true")
+	}
+
+}
+
+func TestPUBLISH_AppendTo_ErrMessageStreamed(t *testing.T) {
+	p, err := NewPUBLISH(&PUBLISHOptions{
+		TopicName:     []byte("a"),
+		MessageReader: bytes.NewReader([]byte("message")),
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != ErrMessageStreamed {
+			t.Errorf("recover() => %v, want => %v", r, ErrMessageStreamed)
+		}
+	}()
+
+	p.AppendTo(nil)
+}
+
+func TestPUBLISH_WriteTo_ErrMessageReaderConsumed(t *testing.T) {
+	p, err := NewPUBLISH(&PUBLISHOptions{
+		TopicName:     []byte("a"),
+		MessageReader: onlyReader{bytes.NewReader([]byte("message"))},
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, err := p.WriteTo(ioutil.Discard); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if p.(*PUBLISH).Rewindable() {
+		t.Error("p.Rewindable() => true, want => false")
+	}
+
+	if _, err := p.WriteTo(ioutil.Discard); err != ErrMessageReaderConsumed {
+		invalidError(t, err, ErrMessageReaderConsumed)
+	}
+}
+
+func TestPUBLISH_WriteTo_ErrInvalidMessageLen(t *testing.T) {
+	p, err := NewPUBLISH(&PUBLISHOptions{
+		TopicName:     []byte("a"),
+		MessageReader: bytes.NewReader([]byte("short")),
+		MessageLen:    7,
+	})
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, err := p.WriteTo(ioutil.Discard); err != ErrInvalidMessageLen {
+		invalidError(t, err, ErrInvalidMessageLen)
+	}
+}
@@ -0,0 +1,347 @@
+package packet
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Maximum number of the bytes of the Remaining Length
+const maxLenRemainingLength = 4
+
+// Error value
+var ErrPacketTooLarge = errors.New("the Packet exceeds the maximum packet size")
+
+// byteReader is a reader which also reads a single byte.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Reader reads the MQTT Control Packets from a stream.
+type Reader struct {
+	// r is the reader of the stream.
+	r byteReader
+	// reuseBuffer is true if the buffers are reused.
+	reuseBuffer bool
+	// streamThreshold is the Remaining Length above which
+	// the Application Message is read as a stream.
+	streamThreshold int
+	// maxPacketSize is the maximum length of the Packet.
+	maxPacketSize int
+	// message is the reader of the Application Message
+	// of the latest PUBLISH Packet read as a stream.
+	message *messageReader
+	// fixedHeader is the buffer of the fixed header.
+	fixedHeader []byte
+	// remaining is the buffer of the remaining.
+	remaining []byte
+	// consumed is the number of the bytes read from the stream.
+	consumed int64
+}
+
+// ReadFrame reads an MQTT Control Packet from the stream and returns
+// its fixed header and its remaining, which are the variable header
+// and the payload, without decoding them.
+func (r *Reader) ReadFrame() (FixedHeader, []byte, error) {
+	// Read the fixed header.
+	fixedHeader, rl, err := r.readFixedHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create the remaining.
+	var remaining []byte
+
+	if r.reuseBuffer && uint32(cap(r.remaining)) >= rl {
+		remaining = r.remaining[:rl]
+	} else {
+		remaining = make([]byte, rl)
+	}
+
+	// Get the remaining of the Packet.
+	if err := r.readFull(remaining); err != nil {
+		return nil, nil, err
+	}
+
+	// Keep the buffers for the next Packet.
+	if r.reuseBuffer {
+		r.fixedHeader = fixedHeader
+		r.remaining = remaining
+	}
+
+	return fixedHeader, remaining, nil
+}
+
+// readFixedHeader discards the unread part of the Application Message
+// of the previous Packet, reads the fixed header of the next Packet
+// and returns it along with the Remaining Length.
+func (r *Reader) readFixedHeader() (FixedHeader, uint32, error) {
+	// Discard the unread part of the Application Message.
+	if r.message != nil {
+		if _, err := io.Copy(io.Discard, r.message); err != nil {
+			return nil, 0, err
+		}
+
+		r.message = nil
+	}
+
+	// Get the first byte of the Packet.
+	b, err := r.readByte()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create the fixed header.
+	var fixedHeader FixedHeader
+
+	if r.reuseBuffer {
+		fixedHeader = r.fixedHeader[:0]
+	}
+
+	fixedHeader = append(fixedHeader, b)
+
+	// Get and decode the Remaining Length.
+	var mp uint32 = 1 // multiplier
+	var rl uint32     // the Remaining Length
+
+	for {
+		// Get the next byte of the Packet.
+		if b, err = r.readByte(); err != nil {
+			return nil, 0, unexpectedEOF(err)
+		}
+
+		fixedHeader = append(fixedHeader, b)
+
+		rl += uint32(b&0x7F) * mp
+
+		if b&0x80 == 0 {
+			// Return an error if the Remaining Length is not
+			// encoded in the minimum number of the bytes.
+			if b == 0x00 && len(fixedHeader) > 2 {
+				return nil, 0, ErrInvalidRemainingLength
+			}
+
+			break
+		}
+
+		// Return an error if the Remaining Length is too long.
+		if len(fixedHeader) > maxLenRemainingLength {
+			return nil, 0, ErrInvalidRemainingLength
+		}
+
+		mp *= 128
+	}
+
+	// Return an error before reading the remaining
+	// if the Packet exceeds the maximum packet size.
+	if r.maxPacketSize > 0 && len(fixedHeader)+int(rl) > r.maxPacketSize {
+		return nil, 0, ErrPacketTooLarge
+	}
+
+	return fixedHeader, rl, nil
+}
+
+// readPUBLISHStream reads the variable header of the PUBLISH
+// Packet and returns the Packet whose MessageReader reads
+// the Application Message from the stream.
+func (r *Reader) readPUBLISHStream(fixedHeader FixedHeader, rl uint32) (Packet, error) {
+	// Get the length of the Topic Name.
+	var b [2]byte
+
+	if err := r.readFull(b[:]); err != nil {
+		return nil, err
+	}
+
+	lenTopicName, _ := decodeUint16(b[:])
+
+	// Calculate the length of the variable header.
+	lenVariableHeader := 2 + uint32(lenTopicName)
+
+	if fixedHeader[0]&0x06 != 0 {
+		lenVariableHeader += 2
+	}
+
+	if lenVariableHeader > rl {
+		return nil, ErrInvalidRemainingLength
+	}
+
+	// Get the variable header.
+	variableHeader := make([]byte, lenVariableHeader)
+
+	copy(variableHeader, b[:])
+
+	if err := r.readFull(variableHeader[2:]); err != nil {
+		return nil, err
+	}
+
+	// Create a PUBLISH Packet.
+	p, err := NewPUBLISHFromBytes(fixedHeader, variableHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the reader of the Application Message to the Packet.
+	r.message = &messageReader{
+		r: r,
+		n: int64(rl - lenVariableHeader),
+	}
+
+	publish := p.(*PUBLISH)
+	publish.MessageReader = r.message
+	publish.MessageLen = int(rl - lenVariableHeader)
+
+	return publish, nil
+}
+
+// ReadPacket reads an MQTT Control Packet from the stream, decodes
+// it and returns it along with the number of the bytes it consists
+// of. The Packets which are sent from the Server are decoded.
+func (r *Reader) ReadPacket() (Packet, int, error) {
+	// Read the PUBLISH Packet above the threshold as a stream.
+	if r.streamThreshold > 0 {
+		fixedHeader, rl, err := r.readFixedHeader()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if fixedHeader[0]>>4 == TypePUBLISH && rl > uint32(r.streamThreshold) {
+			// Copy the fixed header because the Packet
+			// outlives the buffer of the fixed header.
+			fixedHeader = append(FixedHeader(nil), fixedHeader...)
+
+			p, err := r.readPUBLISHStream(fixedHeader, rl)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			return p, len(fixedHeader) + int(rl), nil
+		}
+
+		return r.decode(fixedHeader, rl)
+	}
+
+	fixedHeader, remaining, err := r.ReadFrame()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return newPacket(fixedHeader, remaining)
+}
+
+// decode reads the remaining of the Packet which has the fixed
+// header and the Remaining Length and decodes the Packet.
+func (r *Reader) decode(fixedHeader FixedHeader, rl uint32) (Packet, int, error) {
+	remaining := make([]byte, rl)
+
+	if err := r.readFull(remaining); err != nil {
+		return nil, 0, err
+	}
+
+	return newPacket(fixedHeader, remaining)
+}
+
+// Consumed returns the number of the bytes which
+// the Reader has read from the stream.
+func (r *Reader) Consumed() int64 {
+	return r.consumed
+}
+
+// readByte reads a byte from the stream.
+func (r *Reader) readByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	r.consumed++
+
+	return b, nil
+}
+
+// readFull reads the byte data of the length of the slice
+// in the middle of the Packet.
+func (r *Reader) readFull(b []byte) error {
+	n, err := io.ReadFull(r.r, b)
+
+	r.consumed += int64(n)
+
+	return unexpectedEOF(err)
+}
+
+// newPacket creates a Packet from the byte data and returns it
+// along with the number of the bytes it consists of.
+func newPacket(fixedHeader FixedHeader, remaining []byte) (Packet, int, error) {
+	p, err := NewFromBytes(fixedHeader, remaining)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return p, len(fixedHeader) + len(remaining), nil
+}
+
+// messageReader reads the Application Message
+// of the PUBLISH Packet from the stream.
+type messageReader struct {
+	// r is the Reader of the stream.
+	r *Reader
+	// n is the number of the bytes left.
+	n int64
+}
+
+// Read reads the Application Message.
+func (m *messageReader) Read(b []byte) (int, error) {
+	// Return io.EOF if the Application Message has been read
+	// or discarded by the next read of the Reader.
+	if m.n <= 0 || m.r.message != m {
+		return 0, io.EOF
+	}
+
+	if int64(len(b)) > m.n {
+		b = b[:m.n]
+	}
+
+	n, err := m.r.r.Read(b)
+
+	m.n -= int64(n)
+	m.r.consumed += int64(n)
+
+	if err == io.EOF && m.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF
+// because the stream ends in the middle of the Packet.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// NewReader creates and returns a Reader which reads the MQTT Control
+// Packets from the reader. The reader is buffered unless it implements
+// io.ByteReader.
+func NewReader(r io.Reader, opts *ReaderOptions) *Reader {
+	// Initialize the options.
+	if opts == nil {
+		opts = &ReaderOptions{}
+	}
+
+	// Buffer the reader if necessary.
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	return &Reader{
+		r:               br,
+		reuseBuffer:     opts.ReuseBuffer,
+		streamThreshold: opts.StreamThreshold,
+		maxPacketSize:   opts.MaxPacketSize,
+	}
+}
@@ -0,0 +1,22 @@
+package packet
+
+// ReaderOptions represents options for a Reader.
+type ReaderOptions struct {
+	// ReuseBuffer makes the Reader reuse the buffers of the fixed
+	// header and the remaining of the previous Packet. It is safe
+	// only if the caller does not retain the byte data and the Packet
+	// returned by a read after the next read.
+	ReuseBuffer bool
+	// StreamThreshold is the Remaining Length in bytes above which
+	// ReadPacket returns the PUBLISH Packet before reading its
+	// Application Message. The MessageReader of the Packet reads the
+	// Application Message from the stream until the next read, which
+	// discards the unread part. It is disabled if it is zero.
+	StreamThreshold int
+	// MaxPacketSize is the maximum length of the Packet in bytes,
+	// including the fixed header. The Reader returns ErrPacketTooLarge
+	// before reading the remaining of a longer Packet. The default is
+	// zero, which leaves the size unlimited: the Packets are limited
+	// only by the maximum Remaining Length of about 256 MB.
+	MaxPacketSize int
+}
@@ -0,0 +1,291 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// testStream is the byte data of a CONNACK Packet
+// and a PUBLISH Packet of QoS 0.
+var testStream = []byte{
+	TypeCONNACK << 4, 0x02, 0x00, 0x00,
+	TypePUBLISH << 4, 0x06, 0x00, 0x01, 'a', 'm', 's', 'g',
+}
+
+// onlyReader hides the io.ByteReader of the reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestReader_ReadPacket(t *testing.T) {
+	r := NewReader(onlyReader{bytes.NewReader(testStream)}, nil)
+
+	p, n, err := r.ReadPacket()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, ok := p.(*CONNACK); !ok || n != 4 {
+		t.Errorf("p, n => %T, %d, want => %T, %d", p, n, &CONNACK{}, 4)
+	}
+
+	p, n, err = r.ReadPacket()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if publish, ok := p.(*PUBLISH); !ok || string(publish.Message) != "msg" || n != 8 {
+		t.Errorf("p, n => %+v, %d, want => the PUBLISH Packet of %q, %d", p, n, "msg", 8)
+	}
+
+	if consumed := r.Consumed(); consumed != int64(len(testStream)) {
+		t.Errorf("r.Consumed() => %d, want => %d", consumed, len(testStream))
+	}
+
+	if _, _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("err => %v, want => %v", err, io.EOF)
+	}
+}
+
+func TestReader_ReadPacket_NewFromBytesErr(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{TypeCONNECT << 4, 0x00}), nil)
+
+	if _, _, err := r.ReadPacket(); err != ErrInvalidPacketType {
+		t.Errorf("err => %v, want => %v", err, ErrInvalidPacketType)
+	}
+}
+
+func TestReader_ReadFrame_ReuseBuffer(t *testing.T) {
+	r := NewReader(bytes.NewReader(append(testStream, testStream...)), &ReaderOptions{
+		ReuseBuffer: true,
+	})
+
+	if _, _, err := r.ReadFrame(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	_, second, err := r.ReadFrame()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if string(second) != string(testStream[6:]) {
+		t.Errorf("second => %X, want => %X", second, testStream[6:])
+	}
+
+	// The buffer is reused for the smaller remaining.
+	_, third, err := r.ReadFrame()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if &third[0] != &second[0] {
+		t.Error("the buffer of the remaining should be reused")
+	}
+}
+
+func TestReader_ReadFrame_ErrInvalidRemainingLength(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{TypePUBLISH << 4, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}), nil)
+
+	if _, _, err := r.ReadFrame(); err != ErrInvalidRemainingLength {
+		t.Errorf("err => %v, want => %v", err, ErrInvalidRemainingLength)
+	}
+}
+
+func TestReader_ReadFrame_nonMinimalRemainingLength(t *testing.T) {
+	for _, b := range [][]byte{
+		{TypePUBACK << 4, 0x82, 0x00, 0x00, 0x01},
+		{TypePINGRESP << 4, 0x80, 0x80, 0x00},
+	} {
+		r := NewReader(bytes.NewReader(b), nil)
+
+		if _, _, err := r.ReadFrame(); err != ErrInvalidRemainingLength {
+			t.Errorf("err => %v, want => %v", err, ErrInvalidRemainingLength)
+		}
+	}
+}
+
+func TestReader_ReadPacket_MaxPacketSize(t *testing.T) {
+	r := NewReader(bytes.NewReader(testStream), &ReaderOptions{
+		MaxPacketSize: 7,
+	})
+
+	if _, _, err := r.ReadPacket(); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// The PUBLISH Packet is one byte longer than the maximum packet size.
+	if _, _, err := r.ReadPacket(); err != ErrPacketTooLarge {
+		t.Errorf("err => %v, want => %v", err, ErrPacketTooLarge)
+	}
+}
+
+func TestReader_ReadPacket_ErrPacketTooLarge(t *testing.T) {
+	// The Remaining Length is the maximum one
+	// and the remaining does not follow.
+	b := []byte{TypePUBLISH << 4, 0xFF, 0xFF, 0xFF, 0x7F}
+
+	for _, opts := range []*ReaderOptions{
+		{MaxPacketSize: 1024},
+		{MaxPacketSize: 1024, StreamThreshold: 64},
+	} {
+		r := NewReader(bytes.NewReader(b), opts)
+
+		if _, _, err := r.ReadPacket(); err != ErrPacketTooLarge {
+			t.Errorf("err => %v, want => %v", err, ErrPacketTooLarge)
+		}
+
+		if consumed := r.Consumed(); consumed != int64(len(b)) {
+			t.Errorf("r.Consumed() => %d, want => %d", consumed, len(b))
+		}
+	}
+}
+
+func TestReader_ReadFrame_ErrUnexpectedEOF(t *testing.T) {
+	for _, b := range [][]byte{
+		{TypePUBLISH << 4},
+		{TypePUBLISH << 4, 0x80},
+		{TypePUBLISH << 4, 0x03, 0x00},
+	} {
+		r := NewReader(bytes.NewReader(b), nil)
+
+		if _, _, err := r.ReadFrame(); err != io.ErrUnexpectedEOF {
+			t.Errorf("err => %v, want => %v", err, io.ErrUnexpectedEOF)
+		}
+
+		if consumed := r.Consumed(); consumed != int64(len(b)) {
+			t.Errorf("r.Consumed() => %d, want => %d", consumed, len(b))
+		}
+	}
+}
+
+func BenchmarkReader_ReadPacket(b *testing.B) {
+	benchmarkReaderReadPacket(b, false)
+}
+
+func BenchmarkReader_ReadPacket_ReuseBuffer(b *testing.B) {
+	benchmarkReaderReadPacket(b, true)
+}
+
+// benchmarkReaderReadPacket measures reading the PUBLISH Packets.
+func benchmarkReaderReadPacket(b *testing.B, reuseBuffer bool) {
+	stream := bytes.Repeat(newBenchPUBLISH(1024).AppendTo(nil), 1024)
+
+	br := bytes.NewReader(stream)
+
+	r := NewReader(br, &ReaderOptions{
+		ReuseBuffer: reuseBuffer,
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if br.Len() == 0 {
+			br.Reset(stream)
+		}
+
+		if _, _, err := r.ReadPacket(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReader_ReadPacket_StreamThreshold(t *testing.T) {
+	large := newBenchPUBLISH(100).AppendTo(nil)
+
+	stream := append(append(append([]byte(nil), large...), large...), testStream...)
+
+	r := NewReader(bytes.NewReader(stream), &ReaderOptions{
+		ReuseBuffer:     true,
+		StreamThreshold: 64,
+	})
+
+	p, n, err := r.ReadPacket()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	publish, ok := p.(*PUBLISH)
+	if !ok || publish.MessageReader == nil || publish.MessageLen != 100 || n != len(large) {
+		t.Errorf("p, n => %+v, %d, want => the PUBLISH Packet with the MessageReader of %d bytes, %d", p, n, 100, len(large))
+		return
+	}
+
+	if string(publish.TopicName) != "devices/1/telemetry" || publish.PacketID != 1 {
+		t.Errorf("publish.TopicName, publish.PacketID => %q, %d, want => %q, %d", publish.TopicName, publish.PacketID, "devices/1/telemetry", 1)
+	}
+
+	// Read the Application Message partially.
+	if _, err := io.ReadFull(publish.MessageReader, make([]byte, 10)); err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	// The unread part is discarded by the next read.
+	p, _, err = r.ReadPacket()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if n, err := publish.MessageReader.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("n, err => %d, %v, want => %d, %v", n, err, 0, io.EOF)
+	}
+
+	// Read the whole Application Message.
+	b, err := io.ReadAll(p.(*PUBLISH).MessageReader)
+	if err != nil || len(b) != 100 {
+		t.Errorf("len(b), err => %d, %v, want => %d, nil", len(b), err, 100)
+	}
+
+	// The small Packets are decoded as usual.
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.ReadPacket(); err != nil {
+			nilErrorExpected(t, err)
+			return
+		}
+	}
+
+	if consumed := r.Consumed(); consumed != int64(len(stream)) {
+		t.Errorf("r.Consumed() => %d, want => %d", consumed, len(stream))
+	}
+}
+
+func TestReader_ReadPacket_StreamThreshold_ErrUnexpectedEOF(t *testing.T) {
+	large := newBenchPUBLISH(100).AppendTo(nil)
+
+	r := NewReader(bytes.NewReader(large[:len(large)-1]), &ReaderOptions{
+		StreamThreshold: 64,
+	})
+
+	p, _, err := r.ReadPacket()
+	if err != nil {
+		nilErrorExpected(t, err)
+		return
+	}
+
+	if _, err := io.ReadAll(p.(*PUBLISH).MessageReader); err != io.ErrUnexpectedEOF {
+		t.Errorf("err => %v, want => %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReader_ReadPacket_StreamThreshold_ErrInvalidRemainingLength(t *testing.T) {
+	b := append([]byte{TypePUBLISH << 4, 0x41, 0x00, 0x50}, make([]byte, 0x3F)...)
+
+	r := NewReader(bytes.NewReader(b), &ReaderOptions{
+		StreamThreshold: 8,
+	})
+
+	if _, _, err := r.ReadPacket(); err != ErrInvalidRemainingLength {
+		t.Errorf("err => %v, want => %v", err, ErrInvalidRemainingLength)
+	}
+}